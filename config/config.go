@@ -0,0 +1,259 @@
+// Package config loads the settings of the sync program from a YAML file,
+// environment variables and command-line flags, in increasing order of
+// precedence.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is the configuration file read when neither -config nor
+// ETIMS_CONFIG names one. It may be absent.
+const DefaultPath = "etims.yaml"
+
+// File is the layout of the YAML configuration file.
+type File struct {
+	// Profile names the entry of Profiles used when none is selected by
+	// environment or flag.
+	Profile  string             `yaml:"profile"`
+	DataDir  string             `yaml:"dataDir"`
+	Secrets  Secrets            `yaml:"secrets"`
+	Redact   Redact             `yaml:"redact"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Secret sources.
+const (
+	SecretsEnv      = "env"
+	SecretsFile     = "file"
+	SecretsKeystore = "keystore"
+)
+
+// Secrets selects where secrets such as CMC keys are loaded from.
+type Secrets struct {
+	// Source is SecretsEnv (the default), SecretsFile or SecretsKeystore.
+	Source string `yaml:"source"`
+	// Dir is the directory of a SecretsFile source.
+	Dir string `yaml:"dir"`
+	// Keystore is the path of a SecretsKeystore source. Its passphrase is
+	// read from ETIMS_KEYSTORE_PASSPHRASE.
+	Keystore string `yaml:"keystore"`
+}
+
+// Redact lists log fields and HTTP headers to hide in addition to the
+// built-in ones.
+type Redact struct {
+	Fields  []string `yaml:"fields"`
+	Headers []string `yaml:"headers"`
+}
+
+// Profile is one eTIMS environment, such as sandbox or production.
+type Profile struct {
+	BaseURL  string   `yaml:"baseURL"`
+	Tin      string   `yaml:"tin"`
+	Branches []Branch `yaml:"branches"`
+}
+
+// Branch is one branch of the taxpayer and the VSCU device it runs.
+type Branch struct {
+	BhfId    string `yaml:"bhfId"`
+	DvcSrlNo string `yaml:"dvcSrlNo"`
+	// CmcKeySecret names the secret holding the branch's CMC key. It
+	// defaults to "cmc-key-<bhfId>".
+	CmcKeySecret string `yaml:"cmcKeySecret"`
+}
+
+// CmcKeyName returns the name of the secret holding the branch's CMC key.
+func (b Branch) CmcKeyName() string {
+	if b.CmcKeySecret != "" {
+		return b.CmcKeySecret
+	}
+	return "cmc-key-" + b.BhfId
+}
+
+// Config is the resolved configuration of one run.
+type Config struct {
+	Profile  string
+	BaseURL  string
+	Tin      string
+	DataDir  string
+	Secrets  Secrets
+	Redact   Redact
+	Branches []Branch
+	// ForceInit re-initializes devices that already have a stored profile.
+	ForceInit bool
+}
+
+var (
+	tinPattern   = regexp.MustCompile(`^[A-Z][0-9]{9}[A-Z]$`)
+	bhfIdPattern = regexp.MustCompile(`^[0-9]{2}$`)
+)
+
+// Load resolves the configuration from args (without the program name)
+// and the environment read through getenv.
+//
+// Flags and ETIMS_* variables override the selected profile. -bhf-id
+// (ETIMS_BHF_ID) restricts the run to one branch, and -dvc-srl-no then
+// applies to that branch; the branch need not be in the file. Secrets are
+// never read from flags, which other users can see in the process list.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	fs := flag.NewFlagSet("etims", flag.ContinueOnError)
+	var (
+		path     = fs.String("config", getenv("ETIMS_CONFIG"), "configuration file")
+		profile  = fs.String("profile", getenv("ETIMS_PROFILE"), "profile to use")
+		dataDir  = fs.String("data-dir", getenv("ETIMS_DATA_DIR"), "directory for local state")
+		baseURL  = fs.String("base-url", getenv("ETIMS_BASE_URL"), "VSCU address")
+		tin      = fs.String("tin", getenv("ETIMS_TIN"), "taxpayer PIN")
+		bhfId    = fs.String("bhf-id", getenv("ETIMS_BHF_ID"), "only sync this branch")
+		dvcSrlNo = fs.String("dvc-srl-no", getenv("ETIMS_DVC_SRL_NO"), "device serial number of the branch")
+		source   = fs.String("secrets", getenv("ETIMS_SECRETS"), "secret source: env, file or keystore")
+		dir      = fs.String("secrets-dir", getenv("ETIMS_SECRETS_DIR"), "directory of the file secret source")
+		keystore = fs.String("keystore", getenv("ETIMS_KEYSTORE"), "path of the keystore secret source")
+		force    = fs.Bool("force-init", getenv("ETIMS_FORCE_INIT") == "true", "re-initialize devices with a stored profile")
+	)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	file := File{}
+	switch {
+	case *path != "":
+		if err := readFile(*path, &file); err != nil {
+			return nil, err
+		}
+	default:
+		err := readFile(DefaultPath, &file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	cfg := &Config{
+		Profile: file.Profile,
+		DataDir: file.DataDir,
+		Secrets: file.Secrets,
+		Redact:  file.Redact,
+
+		ForceInit: *force,
+	}
+	if *profile != "" {
+		cfg.Profile = *profile
+	}
+	if cfg.Profile != "" {
+		p, ok := file.Profiles[cfg.Profile]
+		if !ok {
+			return nil, fmt.Errorf("config: unknown profile %q", cfg.Profile)
+		}
+		cfg.BaseURL = p.BaseURL
+		cfg.Tin = p.Tin
+		cfg.Branches = append(cfg.Branches, p.Branches...)
+	}
+
+	override(&cfg.DataDir, *dataDir)
+	override(&cfg.BaseURL, *baseURL)
+	override(&cfg.Tin, *tin)
+	override(&cfg.Secrets.Source, *source)
+	override(&cfg.Secrets.Dir, *dir)
+	override(&cfg.Secrets.Keystore, *keystore)
+	if cfg.DataDir == "" {
+		cfg.DataDir = "data"
+	}
+	if cfg.Secrets.Source == "" {
+		cfg.Secrets.Source = SecretsEnv
+	}
+
+	if *bhfId != "" {
+		branch := Branch{BhfId: *bhfId}
+		for _, b := range cfg.Branches {
+			if b.BhfId == *bhfId {
+				branch = b
+			}
+		}
+		override(&branch.DvcSrlNo, *dvcSrlNo)
+		cfg.Branches = []Branch{branch}
+	} else if *dvcSrlNo != "" {
+		return nil, errors.New("config: -dvc-srl-no needs -bhf-id")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that the configuration is complete and well formed.
+func (c *Config) Validate() error {
+	var errs []error
+
+	u, err := url.Parse(c.BaseURL)
+	switch {
+	case c.BaseURL == "":
+		errs = append(errs, errors.New("base URL is required"))
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		errs = append(errs, fmt.Errorf("base URL %q is not an http(s) URL", c.BaseURL))
+	}
+	if !tinPattern.MatchString(c.Tin) {
+		errs = append(errs, fmt.Errorf("tin %q is not a KRA PIN", c.Tin))
+	}
+	if len(c.Branches) == 0 {
+		errs = append(errs, errors.New("at least one branch is required"))
+	}
+
+	seen := make(map[string]bool)
+	for _, b := range c.Branches {
+		if !bhfIdPattern.MatchString(b.BhfId) {
+			errs = append(errs, fmt.Errorf("branch ID %q is not two digits", b.BhfId))
+			continue
+		}
+		if seen[b.BhfId] {
+			errs = append(errs, fmt.Errorf("branch %s is listed twice", b.BhfId))
+		}
+		seen[b.BhfId] = true
+		if b.DvcSrlNo == "" {
+			errs = append(errs, fmt.Errorf("branch %s: device serial number is required", b.BhfId))
+		}
+	}
+
+	switch c.Secrets.Source {
+	case SecretsEnv:
+	case SecretsFile:
+		if c.Secrets.Dir == "" {
+			errs = append(errs, errors.New("file secret source needs a directory"))
+		}
+	case SecretsKeystore:
+		if c.Secrets.Keystore == "" {
+			errs = append(errs, errors.New("keystore secret source needs a keystore path"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown secret source %q", c.Secrets.Source))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+func readFile(path string, file *File) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return fmt.Errorf("config: failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func override(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
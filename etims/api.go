@@ -0,0 +1,178 @@
+package etims
+
+import (
+	"context"
+	"errors"
+)
+
+// VSCU routes.
+const (
+	PathSelectInitInfo          = "/initializer/selectInitInfo"
+	PathSelectCodes             = "/code/selectCodes"
+	PathSelectItemsClass        = "/itemClass/selectItemsClass"
+	PathSelectCustomer          = "/customers/selectCustomer"
+	PathSelectBranches          = "/branches/selectBranches"
+	PathSelectNotices           = "/notices/selectNotices"
+	PathSaveBranchCustomers     = "/branches/saveBrancheCustomers"
+	PathSaveBranchUsers         = "/branches/saveBrancheUsers"
+	PathSaveBranchInsurances    = "/branches/saveBrancheInsurances"
+	PathSaveItems               = "/items/saveItems"
+	PathSelectItems             = "/items/selectItems"
+	PathSaveItemComposition     = "/items/saveItemComposition"
+	PathSelectImportItems       = "/imports/selectImportItems"
+	PathUpdateImportItems       = "/imports/updateImportItems"
+	PathSaveSales               = "/trnsSales/saveSales"
+	PathSelectTrnsPurchaseSales = "/trnsPurchase/selectTrnsPurchaseSales"
+	PathSavePurchases           = "/trnsPurchase/savePurchases"
+	PathSelectStockItems        = "/stock/selectStockItems"
+	PathSaveStockItems          = "/stock/saveStockItems"
+	PathSaveStockMaster         = "/stockMaster/saveStockMaster"
+)
+
+// SelectInitInfo initializes the device identified by req.DvcSrlNo.
+func (c *Client) SelectInitInfo(ctx context.Context, req InitRequest) (*Response[InitInfoRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[InitInfoRes](ctx, c, PathSelectInitInfo, req)
+}
+
+// SelectCodes fetches the standard code tables changed since req.LastReqDt.
+func (c *Client) SelectCodes(ctx context.Context, req CodeRequest) (*Response[CodeRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[CodeRes](ctx, c, PathSelectCodes, req)
+}
+
+// SelectItemsClass fetches the item classifications changed since
+// req.LastReqDt.
+func (c *Client) SelectItemsClass(ctx context.Context, req ItemClassRequest) (*Response[ItemClsRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[ItemClsRes](ctx, c, PathSelectItemsClass, req)
+}
+
+// SelectCustomer looks up the taxpayer registered under req.CustmTin.
+func (c *Client) SelectCustomer(ctx context.Context, req CustomerRequest) (*Response[CustRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[CustRes](ctx, c, PathSelectCustomer, req)
+}
+
+// SelectBranches fetches the taxpayer's branches changed since req.LastReqDt.
+func (c *Client) SelectBranches(ctx context.Context, req BranchRequest) (*Response[BhfRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[BhfRes](ctx, c, PathSelectBranches, req)
+}
+
+// SelectNotices fetches the KRA notices published since req.LastReqDt.
+func (c *Client) SelectNotices(ctx context.Context, req NoticeRequest) (*Response[NoticeRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[NoticeRes](ctx, c, PathSelectNotices, req)
+}
+
+// SaveBranchCustomer registers or updates a branch customer.
+func (c *Client) SaveBranchCustomer(ctx context.Context, req BranchCustomerRequest) (*Result, error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return c.save(ctx, PathSaveBranchCustomers, req)
+}
+
+// SaveBranchUser registers or updates a branch user account.
+func (c *Client) SaveBranchUser(ctx context.Context, req BranchUserRequest) (*Result, error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return c.save(ctx, PathSaveBranchUsers, req)
+}
+
+// SaveBranchInsurance registers or updates a branch insurance company.
+func (c *Client) SaveBranchInsurance(ctx context.Context, req BranchInsuranceRequest) (*Result, error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return c.save(ctx, PathSaveBranchInsurances, req)
+}
+
+// SaveItem registers or updates an item.
+func (c *Client) SaveItem(ctx context.Context, req ItemRequest) (*Result, error) {
+	c.identify(&req.Tin, &req.BhfId)
+	if err := c.codes.validateItem(req); err != nil {
+		return nil, err
+	}
+	return c.save(ctx, PathSaveItems, req)
+}
+
+// SelectItems fetches the items changed since req.LastReqDt.
+func (c *Client) SelectItems(ctx context.Context, req GetItemRequest) (*Response[ItemRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[ItemRes](ctx, c, PathSelectItems, req)
+}
+
+// SaveItemComposition registers a component of a composite item.
+func (c *Client) SaveItemComposition(ctx context.Context, req ItemCompositionRequest) (*Result, error) {
+	c.identify(&req.Tin, &req.BhfId)
+	if err := validateQty("cpstQty", req.CpstUnitCd, req.CpstQty); err != nil {
+		return nil, err
+	}
+	return c.save(ctx, PathSaveItemComposition, req)
+}
+
+// SelectImportItems fetches the customs import items changed since
+// req.LastReqDt.
+func (c *Client) SelectImportItems(ctx context.Context, req ImportItemRequest) (*Response[ImptItemRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[ImptItemRes](ctx, c, PathSelectImportItems, req)
+}
+
+// UpdateImportItem reports the conversion status of an imported item.
+func (c *Client) UpdateImportItem(ctx context.Context, req ImportItemUpdateRequest) (*Result, error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return c.save(ctx, PathUpdateImportItems, req)
+}
+
+// SaveSales declares a sales transaction.
+func (c *Client) SaveSales(ctx context.Context, req TrnsSalesSaveWrReq) (*Response[TrnsSalesSaveRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	if req.InvcNo <= 0 {
+		return nil, errors.New("etims: sales invoice needs an invcNo")
+	}
+	if err := c.codes.validateSales(req); err != nil {
+		return nil, err
+	}
+	return post[TrnsSalesSaveRes](ctx, c, PathSaveSales, req)
+}
+
+// SelectTrnsPurchaseSales fetches the sales suppliers declared against this
+// taxpayer since req.LastReqDt.
+func (c *Client) SelectTrnsPurchaseSales(ctx context.Context, req PurchaseRequest) (*Response[TrnsPurchaseSalesRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[TrnsPurchaseSalesRes](ctx, c, PathSelectTrnsPurchaseSales, req)
+}
+
+// SavePurchase declares a purchase, e.g. one converted from a supplier
+// invoice with PurchaseDeclaration.
+func (c *Client) SavePurchase(ctx context.Context, req TrnsPurchaseSaveReq) (*Result, error) {
+	c.identify(&req.Tin, &req.BhfId)
+	if err := checkPurchase(req); err != nil {
+		return nil, err
+	}
+	if err := c.codes.validatePurchase(req); err != nil {
+		return nil, err
+	}
+	return c.save(ctx, PathSavePurchases, req)
+}
+
+// SelectStockItems fetches the stock movements declared since req.LastReqDt.
+func (c *Client) SelectStockItems(ctx context.Context, req StockMovementRequest) (*Response[StockMoveRes], error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return post[StockMoveRes](ctx, c, PathSelectStockItems, req)
+}
+
+// SaveStockItems declares a stock in/out movement.
+func (c *Client) SaveStockItems(ctx context.Context, req StockIOSaveReq) (*Result, error) {
+	c.identify(&req.Tin, &req.BhfId)
+	if err := checkStockIO(req); err != nil {
+		return nil, err
+	}
+	if err := c.codes.validateStockItems(req); err != nil {
+		return nil, err
+	}
+	return c.save(ctx, PathSaveStockItems, req)
+}
+
+// SaveStockMaster reports the remaining quantity of an item.
+func (c *Client) SaveStockMaster(ctx context.Context, req StockMasterRequest) (*Result, error) {
+	c.identify(&req.Tin, &req.BhfId)
+	return c.save(ctx, PathSaveStockMaster, req)
+}
@@ -0,0 +1,326 @@
+// Package etims is a client for the KRA eTIMS Virtual Sales Control Unit
+// (VSCU) REST API.
+package etims
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const userAgent = "etims-client/1.0"
+
+// Client talks to a single VSCU on behalf of one taxpayer branch.
+type Client struct {
+	baseURL    string
+	tin        string
+	bhfId      string
+	httpClient *http.Client
+	logger     logrus.FieldLogger
+	redactor   *Redactor
+	codes      *CodeRepository
+	retry      RetryPolicy
+	timeouts   map[EndpointClass]Timeouts
+
+	// mu guards cmcKey, which Initialize replaces when the VSCU rotates it.
+	mu     sync.RWMutex
+	cmcKey string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL sets the address of the VSCU, e.g. "http://127.0.0.1:8088".
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithTIN sets the taxpayer PIN used for requests that leave it empty.
+func WithTIN(tin string) Option {
+	return func(c *Client) {
+		c.tin = tin
+	}
+}
+
+// WithBranchID sets the branch ID used for requests that leave it empty.
+func WithBranchID(bhfId string) Option {
+	return func(c *Client) {
+		c.bhfId = bhfId
+	}
+}
+
+// WithCMCKey sets the communication key sent in the CMC-KEY header.
+func WithCMCKey(cmcKey string) Option {
+	return func(c *Client) {
+		c.cmcKey = cmcKey
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to reach the VSCU instead of the
+// client's own pooled one.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithLogger sets the logger used for request and response tracing.
+func WithLogger(logger logrus.FieldLogger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithRedactor sets the Redactor that hides secrets, such as the CMC-KEY
+// header, in the requests and responses the client logs. The default hides
+// DefaultRedactedFields and DefaultRedactedHeaders.
+func WithRedactor(r *Redactor) Option {
+	return func(c *Client) {
+		c.redactor = r
+	}
+}
+
+// WithCodeRepository makes the client check code-valued fields such as
+// pkgUnitCd, qtyUnitCd and taxTyCd against the downloaded code tables
+// before sending a save request.
+func WithCodeRepository(codes *CodeRepository) Option {
+	return func(c *Client) {
+		c.codes = codes
+	}
+}
+
+// WithRetryPolicy sets how transient failures are retried. The default is
+// DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// New returns a Client configured by opts.
+func New(opts ...Option) (*Client, error) {
+	c := &Client{
+		logger:   logrus.StandardLogger(),
+		retry:    DefaultRetryPolicy,
+		timeouts: make(map[EndpointClass]Timeouts, len(DefaultTimeouts)),
+	}
+	for class, t := range DefaultTimeouts {
+		c.timeouts[class] = t
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = newHTTPClient()
+	}
+	if c.redactor == nil {
+		c.redactor = NewRedactor(nil, nil)
+	}
+
+	if c.baseURL == "" {
+		return nil, errors.New("etims: base URL is required")
+	}
+	return c, nil
+}
+
+// TIN returns the taxpayer PIN the client was configured with.
+func (c *Client) TIN() string {
+	return c.tin
+}
+
+// BranchID returns the branch ID the client was configured with.
+func (c *Client) BranchID() string {
+	return c.bhfId
+}
+
+// identify fills in the configured TIN and branch ID where a request left
+// them empty.
+func (c *Client) identify(tin, bhfId *string) {
+	if *tin == "" {
+		*tin = c.tin
+	}
+	if bhfId != nil && *bhfId == "" {
+		*bhfId = c.bhfId
+	}
+}
+
+// Do posts payload as JSON to path and decodes the response envelope into
+// out, which must be a *Result or a *Response. It returns a *ResultError
+// when the VSCU rejects the request and a *TransportError when the VSCU
+// could not be reached.
+//
+// Transport errors and retryable result codes are retried under the
+// client's RetryPolicy with the same X-Request-ID. If a retried save is
+// answered with 994, the earlier attempt reached the VSCU and Do reports
+// success. Do is the escape hatch for routes or payload shapes without a
+// typed method.
+func (c *Client) Do(ctx context.Context, path string, payload interface{}, out envelope) error {
+	requestBody, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", path, err)
+	}
+	id := requestID(path, requestBody)
+
+	for attempt := 1; ; attempt++ {
+		err = c.do(ctx, path, id, requestBody, out)
+		if attempt > 1 && isSave(path) && IsDuplicate(err) {
+			return nil
+		}
+		if err == nil || !retryable(err) || attempt >= c.retry.MaxAttempts {
+			return err
+		}
+
+		c.logger.WithError(err).WithFields(logrus.Fields{
+			"path":       path,
+			"request_id": id,
+			"attempt":    attempt,
+		}).Warn("Retrying request")
+		if err := c.retry.wait(ctx, attempt+1); err != nil {
+			return &TransportError{Path: path, Err: err}
+		}
+	}
+}
+
+// do makes a single attempt at a request within the timeouts of its
+// endpoint class.
+func (c *Client) do(ctx context.Context, path, requestID string, requestBody []byte, out envelope) error {
+	t := c.timeouts[endpointClass(path)]
+	if t.Overall > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Overall)
+		defer cancel()
+	}
+	if t.Dial > 0 {
+		ctx = context.WithValue(ctx, dialTimeoutKey{}, t.Dial)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var headerTimer *time.Timer
+	if t.Header > 0 {
+		headerTimer = time.AfterFunc(t.Header, func() { cancel(errHeaderTimeout) })
+	}
+	response, err := c.sendRequest(ctx, c.baseURL+path, requestID, requestBody)
+	if headerTimer != nil {
+		headerTimer.Stop()
+	}
+	if err != nil {
+		if cause := context.Cause(ctx); errors.Is(cause, errHeaderTimeout) {
+			err = cause
+		}
+		return &TransportError{Path: path, Err: err}
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return &TransportError{Path: path, Err: fmt.Errorf("failed to read response body: %w", err)}
+	}
+
+	if response.StatusCode != http.StatusOK {
+		if response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests {
+			// A proxy that lost the VSCU, or a VSCU too busy to answer,
+			// typically with an HTML page rather than a result: the
+			// request may succeed later.
+			return &TransportError{Path: path, Err: fmt.Errorf("request failed with status code: %d", response.StatusCode)}
+		}
+		return fmt.Errorf("%s request failed with status code: %d", path, response.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode %s response body: %w", path, err)
+	}
+
+	result := out.result()
+	c.logger.WithFields(logrus.Fields{
+		"path":       path,
+		"result_cd":  result.ResultCd,
+		"result_msg": result.ResultMsg,
+		"result_dt":  result.ResultDt,
+	}).Info("Received result")
+
+	return checkResult(path, result)
+}
+
+// post sends req to path and returns the decoded response.
+func post[T any](ctx context.Context, c *Client, path string, req interface{}) (*Response[T], error) {
+	var res Response[T]
+	if err := c.Do(ctx, path, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// save sends req to a route that returns no data.
+func (c *Client) save(ctx context.Context, path string, req interface{}) (*Result, error) {
+	var res Result
+	if err := c.Do(ctx, path, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) sendRequest(ctx context.Context, url, requestID string, requestBody []byte) (*http.Response, error) {
+	log := c.logger.WithFields(logrus.Fields{
+		"url":    url,
+		"method": "POST",
+	})
+
+	log = log.WithField("request_id", requestID)
+
+	// Create request
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set default headers
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Request-ID", requestID)
+	c.mu.RLock()
+	req.Header.Set("CMC-KEY", c.cmcKey)
+	c.mu.RUnlock()
+	req.Header.Set("User-Agent", userAgent)
+
+	// Log request details without secrets, whatever hooks the logger has
+	log.WithFields(logrus.Fields{
+		"body_size":       len(requestBody),
+		"body":            c.redactor.json(string(requestBody)),
+		"request_headers": c.redactor.header(req.Header),
+	}).Info("Sending request")
+
+	// Record start time for request duration
+	start := time.Now()
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.WithError(err).Error("Request failed")
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	// Calculate request duration
+	duration := time.Since(start)
+
+	// Log response details
+	log.WithFields(logrus.Fields{
+		"status_code":      resp.StatusCode,
+		"duration_ms":      duration.Milliseconds(),
+		"content_length":   resp.ContentLength,
+		"response_headers": c.redactor.header(resp.Header),
+		"content_type":     resp.Header.Get("Content-Type"),
+	}).Info("Received response")
+
+	return resp, nil
+}
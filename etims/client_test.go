@@ -0,0 +1,56 @@
+package etims
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestClientRedactsLogs(t *testing.T) {
+	const cmcKey, pwd = "secret-cmc-key", "secret-password"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"resultCd":"000","resultMsg":"test","resultDt":"20240101000000"}`)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "default redactor"},
+		{name: "given redactor", opts: []Option{WithRedactor(NewRedactor([]string{"userNm"}, nil))}},
+	}
+	for _, tt := range tests {
+		// A logger without a Redactor hook.
+		var buf bytes.Buffer
+		logger := logrus.New()
+		logger.SetOutput(&buf)
+		c, err := New(append([]Option{
+			WithBaseURL(srv.URL),
+			WithTIN(testTin),
+			WithBranchID(testBhfId),
+			WithCMCKey(cmcKey),
+			WithLogger(logger),
+		}, tt.opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.SaveBranchUser(context.Background(), BranchUserRequest{UserId: "user001", UserNm: "Test User", Pwd: pwd}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, secret := range []string{cmcKey, pwd} {
+			if strings.Contains(buf.String(), secret) {
+				t.Errorf("%s: log contains %q:\n%s", tt.name, secret, buf.String())
+			}
+		}
+		if !strings.Contains(buf.String(), "user001") {
+			t.Errorf("%s: log lacks the request body:\n%s", tt.name, buf.String())
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Code classes of the standard code tables (spec chapter 4).
+const (
+	CodeClsTaxType             = "04"
+	CodeClsNation              = "05"
+	CodeClsPaymentMethod       = "07"
+	CodeClsQuantityUnit        = "10"
+	CodeClsTransactionProgress = "11"
+	CodeClsStockIOType         = "12"
+	CodeClsTransactionType     = "14"
+	CodeClsTaxpayerStatus      = "15"
+	CodeClsPackagingUnit       = "17"
+	CodeClsProductType         = "24"
+	CodeClsImportItemStatus    = "26"
+	CodeClsRegistrationType    = "31"
+	CodeClsCreditNoteReason    = "32"
+	CodeClsCurrency            = "33"
+	CodeClsSalesReceiptType    = "37"
+	CodeClsPurchaseReceiptType = "38"
+)
+
+// ErrUnknownCode is returned when a request carries a code that is not an
+// active entry of its code table.
+var ErrUnknownCode = errors.New("etims: unknown code")
+
+// CodeTable is one downloaded code class and its codes.
+type CodeTable struct {
+	CodeCls
+	codes map[string]CodeDtl
+}
+
+// Lookup returns the active code cd. Codes deactivated with useYn = N are
+// not returned.
+func (t *CodeTable) Lookup(cd string) (CodeDtl, bool) {
+	if t == nil {
+		return CodeDtl{}, false
+	}
+	dtl, ok := t.codes[cd]
+	if !ok || dtl.UseYn == "N" {
+		return CodeDtl{}, false
+	}
+	return dtl, true
+}
+
+// Codes returns the active codes in sort order.
+func (t *CodeTable) Codes() []CodeDtl {
+	if t == nil {
+		return nil
+	}
+	codes := make([]CodeDtl, 0, len(t.codes))
+	for _, dtl := range t.codes {
+		if dtl.UseYn != "N" {
+			codes = append(codes, dtl)
+		}
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].SrtOrd != codes[j].SrtOrd {
+			return codes[i].SrtOrd < codes[j].SrtOrd
+		}
+		return codes[i].Cd < codes[j].Cd
+	})
+	return codes
+}
+
+// CodeRepository is a local mirror of the code tables downloaded from
+// /code/selectCodes, persisted as a JSON file.
+type CodeRepository struct {
+	file jsonFile
+
+	mu     sync.RWMutex
+	tables map[string]*CodeTable
+}
+
+// NewCodeRepository opens the repository at path, creating it on first
+// Save.
+func NewCodeRepository(path string) (*CodeRepository, error) {
+	r := &CodeRepository{
+		file:   jsonFile{path: path, name: "code tables"},
+		tables: make(map[string]*CodeTable),
+	}
+
+	var classes []CodeCls
+	if err := r.file.load(&classes); err != nil {
+		return nil, err
+	}
+	r.merge(classes)
+	return r, nil
+}
+
+// CodeTable returns the table for code class cdCls, or nil if the class was
+// never downloaded. Lookup on a nil table finds nothing.
+func (r *CodeRepository) CodeTable(cdCls string) *CodeTable {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.tables[cdCls]
+}
+
+// Save merges an incremental /code/selectCodes download into the repository
+// and persists it. It has the SaveFunc signature so it can be handed to
+// Syncer.SyncCodes directly.
+func (r *CodeRepository) Save(ctx context.Context, data *CodeRes) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.merge(data.ClsList)
+
+	classes := make([]CodeCls, 0, len(r.tables))
+	for _, t := range r.tables {
+		cls := t.CodeCls
+		cls.DtlList = make([]CodeDtl, 0, len(t.codes))
+		for _, dtl := range t.codes {
+			cls.DtlList = append(cls.DtlList, dtl)
+		}
+		sort.Slice(cls.DtlList, func(i, j int) bool { return cls.DtlList[i].Cd < cls.DtlList[j].Cd })
+		classes = append(classes, cls)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].CdCls < classes[j].CdCls })
+
+	return r.file.write(classes)
+}
+
+// merge applies classes over the current tables. Codes missing from an
+// update are kept; codes sent with useYn = N stay stored but inactive.
+// Tables are replaced rather than modified, so a *CodeTable handed out
+// earlier never changes underneath its reader.
+func (r *CodeRepository) merge(classes []CodeCls) {
+	for _, cls := range classes {
+		t := &CodeTable{CodeCls: cls, codes: make(map[string]CodeDtl)}
+		t.DtlList = nil
+		if old, ok := r.tables[cls.CdCls]; ok {
+			for cd, dtl := range old.codes {
+				t.codes[cd] = dtl
+			}
+		}
+		for _, dtl := range cls.DtlList {
+			t.codes[dtl.Cd] = dtl
+		}
+		r.tables[cls.CdCls] = t
+	}
+}
+
+// codeField is a code-valued request field to validate.
+type codeField struct {
+	name  string
+	cdCls string
+	cd    string
+}
+
+// validate checks every non-empty field against its code table. Classes
+// that have not been downloaded yet are not checked.
+func (r *CodeRepository) validate(fields ...codeField) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, f := range fields {
+		t, ok := r.tables[f.cdCls]
+		if f.cd == "" || !ok {
+			continue
+		}
+		if _, ok := t.Lookup(f.cd); !ok {
+			return fmt.Errorf("%w: %s %q is not in code class %s", ErrUnknownCode, f.name, f.cd, f.cdCls)
+		}
+	}
+	return nil
+}
+
+func (r *CodeRepository) validateItem(req ItemRequest) error {
+	return r.validate(
+		codeField{"itemTyCd", CodeClsProductType, req.ItemTyCd},
+		codeField{"orgnNatCd", CodeClsNation, req.OrgnNatCd},
+		codeField{"pkgUnitCd", CodeClsPackagingUnit, req.PkgUnitCd},
+		codeField{"qtyUnitCd", CodeClsQuantityUnit, req.QtyUnitCd},
+		codeField{"taxTyCd", CodeClsTaxType, req.TaxTyCd},
+	)
+}
+
+func (r *CodeRepository) validateSales(req TrnsSalesSaveWrReq) error {
+	if err := r.validate(
+		codeField{"salesTyCd", CodeClsTransactionType, req.SalesTyCd},
+		codeField{"rcptTyCd", CodeClsSalesReceiptType, req.RcptTyCd},
+		codeField{"pmtTyCd", CodeClsPaymentMethod, req.PmtTyCd},
+		codeField{"salesSttsCd", CodeClsTransactionProgress, req.SalesSttsCd},
+		codeField{"rfdRsnCd", CodeClsCreditNoteReason, req.RfdRsnCd},
+	); err != nil {
+		return err
+	}
+	for _, item := range req.ItemList {
+		if err := r.validate(
+			codeField{"pkgUnitCd", CodeClsPackagingUnit, item.PkgUnitCd},
+			codeField{"qtyUnitCd", CodeClsQuantityUnit, item.QtyUnitCd},
+			codeField{"taxTyCd", CodeClsTaxType, item.TaxTyCd},
+		); err != nil {
+			return fmt.Errorf("item %d: %w", item.ItemSeq, err)
+		}
+		if err := validateQty("qty", item.QtyUnitCd, item.Qty); err != nil {
+			return fmt.Errorf("item %d: %w", item.ItemSeq, err)
+		}
+	}
+	return nil
+}
+
+func (r *CodeRepository) validatePurchase(req TrnsPurchaseSaveReq) error {
+	if err := r.validate(
+		codeField{"regTyCd", CodeClsRegistrationType, req.RegTyCd},
+		codeField{"pchsTyCd", CodeClsTransactionType, req.PchsTyCd},
+		codeField{"rcptTyCd", CodeClsPurchaseReceiptType, req.RcptTyCd},
+		codeField{"pmtTyCd", CodeClsPaymentMethod, req.PmtTyCd},
+		codeField{"pchsSttsCd", CodeClsTransactionProgress, req.PchsSttsCd},
+	); err != nil {
+		return err
+	}
+	for _, item := range req.ItemList {
+		if err := r.validate(
+			codeField{"pkgUnitCd", CodeClsPackagingUnit, item.PkgUnitCd},
+			codeField{"qtyUnitCd", CodeClsQuantityUnit, item.QtyUnitCd},
+			codeField{"taxTyCd", CodeClsTaxType, item.TaxTyCd},
+		); err != nil {
+			return fmt.Errorf("item %d: %w", item.ItemSeq, err)
+		}
+		if err := validateQty("qty", item.QtyUnitCd, item.Qty); err != nil {
+			return fmt.Errorf("item %d: %w", item.ItemSeq, err)
+		}
+	}
+	return nil
+}
+
+func (r *CodeRepository) validateStockItems(req StockIOSaveReq) error {
+	if err := r.validate(
+		codeField{"regTyCd", CodeClsRegistrationType, req.RegTyCd},
+		codeField{"sarTyCd", CodeClsStockIOType, req.SarTyCd},
+	); err != nil {
+		return err
+	}
+	for _, item := range req.ItemList {
+		if err := r.validate(
+			codeField{"pkgUnitCd", CodeClsPackagingUnit, item.PkgUnitCd},
+			codeField{"qtyUnitCd", CodeClsQuantityUnit, item.QtyUnitCd},
+			codeField{"taxTyCd", CodeClsTaxType, item.TaxTyCd},
+		); err != nil {
+			return fmt.Errorf("item %d: %w", item.ItemSeq, err)
+		}
+		if err := validateQty("qty", item.QtyUnitCd, item.Qty); err != nil {
+			return fmt.Errorf("item %d: %w", item.ItemSeq, err)
+		}
+	}
+	return nil
+}
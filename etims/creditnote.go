@@ -0,0 +1,261 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Credit note reasons (spec 4.16).
+const (
+	CreditNoteMissingQuantity     = "01"
+	CreditNoteMissingItem         = "02"
+	CreditNoteDamaged             = "03"
+	CreditNoteWasted              = "04"
+	CreditNoteRawMaterialShortage = "05"
+	CreditNoteRefund              = "06"
+	CreditNoteWrongCustomerPIN    = "07"
+	CreditNoteWrongCustomerName   = "08"
+	CreditNoteWrongAmount         = "09"
+	CreditNoteWrongQuantity       = "10"
+	CreditNoteWrongItems          = "11"
+	CreditNoteWrongTaxType        = "12"
+	CreditNoteOther               = "13"
+)
+
+var creditNoteReasons = []string{
+	CreditNoteMissingQuantity, CreditNoteMissingItem, CreditNoteDamaged,
+	CreditNoteWasted, CreditNoteRawMaterialShortage, CreditNoteRefund,
+	CreditNoteWrongCustomerPIN, CreditNoteWrongCustomerName, CreditNoteWrongAmount,
+	CreditNoteWrongQuantity, CreditNoteWrongItems, CreditNoteWrongTaxType,
+	CreditNoteOther,
+}
+
+// ErrRefundExceedsSale is returned when a credit note would refund more of
+// an invoice line than was sold, counting earlier credit notes.
+var ErrRefundExceedsSale = errors.New("etims: refund exceeds sale")
+
+// ErrCreditNoteOutstanding is returned when an earlier credit note against
+// an invoice has a number but is neither in the sales history nor settled,
+// so what it refunds cannot be counted.
+var ErrCreditNoteOutstanding = errors.New("etims: credit note outstanding")
+
+// CreditNoteLine is the quantity of one line of the original invoice that
+// is refunded.
+type CreditNoteLine struct {
+	ItemSeq int
+	Qty     Decimal
+}
+
+// CreditNote is a credit note issued by CreateCreditNote.
+type CreditNote struct {
+	Request TrnsSalesSaveWrReq
+	// Response is nil if the credit note could not be delivered.
+	Response *Response[TrnsSalesSaveRes]
+}
+
+// CreateCreditNote refunds lines of invoice orgInvcNo, which must be in
+// history, for reason rfdRsnCd.
+//
+// The lines keep the itemSeq of the invoice line they refund. Their amounts
+// are the share of the invoice line's amounts for the quantity returned; the
+// credit note that returns the last of a line refunds exactly what is left
+// of it, so rounding never refunds more than was paid. Amounts are positive:
+// the receipt type R is what makes the invoice a refund.
+//
+// The credit note takes the next number of the branch's invoice sequence in
+// invoices and is held in history, so later credit notes count it before it
+// is delivered. Once accepted, its number is confirmed and it is recorded in
+// history. If the VSCU cannot be reached, CreateCreditNote returns the
+// credit note with a TransportError, and its number stays allocated and the
+// credit note held until the caller delivers it, e.g. through the outbox. If
+// it is rejected, the number is voided and the credit note released.
+func (c *Client) CreateCreditNote(ctx context.Context, history *SalesHistory, invoices *Sequencer, orgInvcNo int64, lines []CreditNoteLine, rfdRsnCd string) (*CreditNote, error) {
+	if !slices.Contains(creditNoteReasons, rfdRsnCd) {
+		return nil, fmt.Errorf("%w: rfdRsnCd %q is not a credit note reason", ErrUnknownCode, rfdRsnCd)
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("etims: credit note has no lines")
+	}
+	org, ok := history.Sale(c.tin, c.bhfId, orgInvcNo)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownInvoice, orgInvcNo)
+	}
+	if org.Sale.RcptTyCd == ReceiptTypeCreditNote {
+		return nil, fmt.Errorf("etims: invoice %d is a credit note", orgInvcNo)
+	}
+
+	// A credit note numbered before Hold was introduced, or before a crash,
+	// may have refunded anything.
+	key := SequenceKey{Tin: c.tin, BhfId: c.bhfId, Kind: SequenceInvoice}
+	for _, n := range invoices.Audit(key).Pending {
+		if !strings.HasPrefix(n.Ref, creditNoteRef(orgInvcNo, "")) {
+			continue
+		}
+		if _, ok := history.Sale(c.tin, c.bhfId, n.No); !ok {
+			return nil, fmt.Errorf("%w: %d against invoice %d", ErrCreditNoteOutstanding, n.No, orgInvcNo)
+		}
+	}
+
+	// What earlier credit notes refunded, by invoice line, counting those
+	// held while they wait to be delivered.
+	refunded := make(map[int]TrnsSalesSaveWrItem)
+	for _, note := range history.CreditNotes(c.tin, c.bhfId, orgInvcNo) {
+		for _, item := range note.ItemList {
+			r := refunded[item.ItemSeq]
+			r.Qty = r.Qty.Add(item.Qty)
+			r.Pkg = r.Pkg.Add(item.Pkg)
+			r.SplyAmt = r.SplyAmt.Add(item.SplyAmt)
+			r.DcAmt = r.DcAmt.Add(item.DcAmt)
+			r.TaxblAmt = r.TaxblAmt.Add(item.TaxblAmt)
+			r.TaxAmt = r.TaxAmt.Add(item.TaxAmt)
+			r.TotAmt = r.TotAmt.Add(item.TotAmt)
+			if item.IsrcAmt != nil {
+				isrcAmt := item.IsrcAmt.Add(deref(r.IsrcAmt))
+				r.IsrcAmt = &isrcAmt
+			}
+			refunded[item.ItemSeq] = r
+		}
+	}
+
+	now := time.Now()
+	sale := org.Sale
+	req := TrnsSalesSaveWrReq{
+		Tin:          sale.Tin,
+		BhfId:        sale.BhfId,
+		TrdInvcNo:    creditNoteRef(orgInvcNo, now.Format("20060102150405.000000")),
+		OrgInvcNo:    orgInvcNo,
+		CustTin:      sale.CustTin,
+		CustNm:       sale.CustNm,
+		SalesTyCd:    sale.SalesTyCd,
+		RcptTyCd:     ReceiptTypeCreditNote,
+		PmtTyCd:      sale.PmtTyCd,
+		SalesSttsCd:  sale.SalesSttsCd,
+		CfmDt:        now.Format("20060102150405"),
+		SalesDt:      now.Format("20060102"),
+		RfdDt:        now.Format("20060102150405"),
+		RfdRsnCd:     rfdRsnCd,
+		PrchrAcptcYn: sale.PrchrAcptcYn,
+		RegrId:       sale.RegrId,
+		RegrNm:       sale.RegrNm,
+		ModrId:       sale.ModrId,
+		ModrNm:       sale.ModrNm,
+		Receipt:      sale.Receipt,
+	}
+
+	s := TaxSummary{
+		A: TaxBucket{TaxRt: sale.TaxRtA},
+		B: TaxBucket{TaxRt: sale.TaxRtB},
+		C: TaxBucket{TaxRt: sale.TaxRtC},
+		D: TaxBucket{TaxRt: sale.TaxRtD},
+		E: TaxBucket{TaxRt: sale.TaxRtE},
+	}
+	seen := make(map[int]bool)
+	for _, line := range lines {
+		if seen[line.ItemSeq] {
+			return nil, fmt.Errorf("etims: item %d is refunded twice", line.ItemSeq)
+		}
+		seen[line.ItemSeq] = true
+
+		i := slices.IndexFunc(sale.ItemList, func(item TrnsSalesSaveWrItem) bool { return item.ItemSeq == line.ItemSeq })
+		if i < 0 {
+			return nil, fmt.Errorf("etims: invoice %d has no item %d", orgInvcNo, line.ItemSeq)
+		}
+		item, err := refundLine(sale.ItemList[i], refunded[line.ItemSeq], line.Qty)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", line.ItemSeq, err)
+		}
+		req.ItemList = append(req.ItemList, item)
+		s.add(item.TaxTyCd, TaxLine{SplyAmt: item.SplyAmt, DcAmt: item.DcAmt, TaxblAmt: item.TaxblAmt, TaxAmt: item.TaxAmt, TotAmt: item.TotAmt})
+	}
+	s.fill(&req)
+
+	invcNo, err := invoices.Next(ctx, key, req.TrdInvcNo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate credit note number: %w", err)
+	}
+	req.InvcNo = invcNo
+	note := &CreditNote{Request: req}
+	if err := history.Hold(ctx, req); err != nil {
+		return nil, errors.Join(err, invoices.Void(ctx, key, req.InvcNo, err.Error()))
+	}
+
+	res, err := c.SaveSales(ctx, req)
+	if IsTransport(err) {
+		return note, err
+	}
+	if err != nil {
+		if verr := errors.Join(invoices.Void(ctx, key, req.InvcNo, err.Error()), history.Release(ctx, req.Tin, req.BhfId, req.InvcNo)); verr != nil {
+			return nil, errors.Join(err, verr)
+		}
+		return nil, err
+	}
+	note.Response = res
+	if err := invoices.Confirm(ctx, key, req.InvcNo); err != nil {
+		return note, err
+	}
+	if err := history.Record(ctx, req, res.Data); err != nil {
+		return note, err
+	}
+	return note, nil
+}
+
+// creditNoteRef returns the trdInvcNo of a credit note against invoice
+// orgInvcNo issued at stamp.
+func creditNoteRef(orgInvcNo int64, stamp string) string {
+	return fmt.Sprintf("CN-%d-%s", orgInvcNo, stamp)
+}
+
+// refundLine returns the credit note line refunding qty of item, of which
+// prev was refunded before. Shares too large for a Decimal fail with
+// ErrDecimalRange.
+func refundLine(item, prev TrnsSalesSaveWrItem, qty Decimal) (TrnsSalesSaveWrItem, error) {
+	left := item.Qty.Sub(prev.Qty)
+	if qty.Sign() <= 0 {
+		return TrnsSalesSaveWrItem{}, fmt.Errorf("etims: refunded qty %s is not positive", qty)
+	}
+	if qty.Cmp(left) > 0 {
+		return TrnsSalesSaveWrItem{}, fmt.Errorf("%w: qty %s refunded, %s of %s left", ErrRefundExceedsSale, qty, left, item.Qty)
+	}
+
+	var err error
+	share := func(sold, refunded Decimal) Decimal {
+		if qty == left {
+			return sold.Sub(refunded)
+		}
+		d, serr := sold.MulDiv(qty, item.Qty, RoundHalfUp)
+		if serr != nil && err == nil {
+			err = serr
+		}
+		return d
+	}
+	out := item
+	out.Qty = qty
+	out.Pkg = share(item.Pkg, prev.Pkg)
+	out.SplyAmt = share(item.SplyAmt, prev.SplyAmt)
+	out.DcAmt = share(item.DcAmt, prev.DcAmt)
+	out.TaxblAmt = share(item.TaxblAmt, prev.TaxblAmt)
+	out.TaxAmt = share(item.TaxAmt, prev.TaxAmt)
+	out.TotAmt = share(item.TotAmt, prev.TotAmt)
+	if item.IsrcAmt != nil {
+		isrcAmt := share(*item.IsrcAmt, deref(prev.IsrcAmt))
+		out.IsrcAmt = &isrcAmt
+	}
+	if err != nil {
+		return TrnsSalesSaveWrItem{}, err
+	}
+	if out.TotAmt.Cmp(item.TotAmt.Sub(prev.TotAmt)) > 0 {
+		return TrnsSalesSaveWrItem{}, fmt.Errorf("%w: totAmt %s refunded, %s left", ErrRefundExceedsSale, out.TotAmt, item.TotAmt.Sub(prev.TotAmt))
+	}
+	return out, nil
+}
+
+func deref(d *Decimal) Decimal {
+	if d == nil {
+		return Zero
+	}
+	return *d
+}
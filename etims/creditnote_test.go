@@ -0,0 +1,319 @@
+package etims
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeSalesVSCU answers saveSales for invcNo with the HTTP status or result
+// code in answers, and everything else with 000.
+func fakeSalesVSCU(t *testing.T, answers map[int64]string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req TrnsSalesSaveWrReq
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		answer, ok := answers[req.InvcNo]
+		if !ok {
+			answer = ResultSuccess
+		}
+		if answer == "500" {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		data := "null"
+		if answer == ResultSuccess {
+			data = fmt.Sprintf(`{"rcptNo":%d,"rcptSign":"SIGN-%d"}`, req.InvcNo, req.InvcNo)
+		}
+		fmt.Fprintf(w, `{"resultCd":%q,"resultMsg":"test","resultDt":"20240101000000","data":%s}`, answer, data)
+	}))
+	t.Cleanup(srv.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	c, err := New(
+		WithBaseURL(srv.URL),
+		WithTIN(testTin),
+		WithBranchID(testBhfId),
+		WithLogger(logger),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// testSale is invoice 1: three units for 100.00, tax included, so that a
+// third of it does not round evenly.
+func testSale() TrnsSalesSaveWrReq {
+	item := TrnsSalesSaveWrItem{
+		ItemSeq:  1,
+		ItemCd:   "KE1NTXU0000001",
+		ItemNm:   "Test Item",
+		Pkg:      NewDecimal(3),
+		Qty:      NewDecimal(3),
+		Prc:      MustParseDecimal("33.33"),
+		SplyAmt:  NewDecimal(100),
+		TaxTyCd:  TaxTypeB,
+		TaxblAmt: NewDecimal(100),
+		TaxAmt:   MustParseDecimal("13.79"),
+		TotAmt:   NewDecimal(100),
+	}
+	return TrnsSalesSaveWrReq{
+		Tin:         testTin,
+		BhfId:       testBhfId,
+		InvcNo:      1,
+		TrdInvcNo:   "INV-1",
+		RcptTyCd:    ReceiptTypeSale,
+		TaxRtB:      NewDecimal(16),
+		TotItemCnt:  1,
+		TaxblAmtB:   item.TaxblAmt,
+		TaxAmtB:     item.TaxAmt,
+		TotTaxblAmt: item.TaxblAmt,
+		TotTaxAmt:   item.TaxAmt,
+		TotAmt:      item.TotAmt,
+		ItemList:    []TrnsSalesSaveWrItem{item},
+	}
+}
+
+// numberState returns the state of number no in a.
+func numberState(a SequenceAudit, no int64) string {
+	for _, n := range a.Pending {
+		if n.No == no {
+			return NumberAllocated
+		}
+	}
+	for _, n := range a.Voided {
+		if n.No == no {
+			return NumberVoided
+		}
+	}
+	if no <= a.Last && !slices.Contains(a.Missing, no) {
+		return NumberConfirmed
+	}
+	return ""
+}
+
+func TestCreateCreditNote(t *testing.T) {
+	ctx := context.Background()
+	key := SequenceKey{Tin: testTin, BhfId: testBhfId, Kind: SequenceInvoice}
+
+	type step struct {
+		qty string
+		// discard releases the held credit note and voids its number
+		// afterwards, as when it is discarded from the outbox.
+		discard bool
+		wantErr error
+		// transport is true if the credit note could not be delivered.
+		transport bool
+		// rejected is true if the VSCU refuses the credit note.
+		rejected bool
+		// no is the credit note's number, and state its state afterwards.
+		no     int64
+		state  string
+		totAmt string
+		taxAmt string
+	}
+	tests := []struct {
+		name    string
+		answers map[int64]string
+		steps   []step
+	}{
+		{
+			name: "partial refund",
+			steps: []step{
+				{qty: "1", no: 2, state: NumberConfirmed, totAmt: "33.33", taxAmt: "4.60"},
+			},
+		},
+		{
+			name: "last refund takes the remainder",
+			steps: []step{
+				{qty: "1", no: 2, state: NumberConfirmed, totAmt: "33.33", taxAmt: "4.60"},
+				{qty: "1", no: 3, state: NumberConfirmed, totAmt: "33.33", taxAmt: "4.60"},
+				{qty: "1", no: 4, state: NumberConfirmed, totAmt: "33.34", taxAmt: "4.59"},
+			},
+		},
+		{
+			name: "whole line",
+			steps: []step{
+				{qty: "3", no: 2, state: NumberConfirmed, totAmt: "100.00", taxAmt: "13.79"},
+			},
+		},
+		{
+			name: "refund exceeds sale",
+			steps: []step{
+				{qty: "4", wantErr: ErrRefundExceedsSale},
+			},
+		},
+		{
+			name: "refund exceeds what is left",
+			steps: []step{
+				{qty: "2", no: 2, state: NumberConfirmed, totAmt: "66.67", taxAmt: "9.19"},
+				{qty: "2", wantErr: ErrRefundExceedsSale},
+				{qty: "1", no: 3, state: NumberConfirmed, totAmt: "33.33", taxAmt: "4.60"},
+				{qty: "1", wantErr: ErrRefundExceedsSale},
+			},
+		},
+		{
+			name:    "held credit note counts",
+			answers: map[int64]string{2: "500"},
+			steps: []step{
+				{qty: "2", transport: true, no: 2, state: NumberAllocated, totAmt: "66.67", taxAmt: "9.19"},
+				{qty: "2", wantErr: ErrRefundExceedsSale},
+				{qty: "1", no: 3, state: NumberConfirmed, totAmt: "33.33", taxAmt: "4.60"},
+			},
+		},
+		{
+			name:    "discarded credit note is released",
+			answers: map[int64]string{2: "500"},
+			steps: []step{
+				{qty: "2", transport: true, discard: true, no: 2, state: NumberVoided, totAmt: "66.67", taxAmt: "9.19"},
+				{qty: "3", no: 3, state: NumberConfirmed, totAmt: "100.00", taxAmt: "13.79"},
+			},
+		},
+		{
+			name:    "rejected credit note is released",
+			answers: map[int64]string{2: ResultParameter},
+			steps: []step{
+				{qty: "2", rejected: true, no: 2, state: NumberVoided},
+				{qty: "3", no: 3, state: NumberConfirmed, totAmt: "100.00", taxAmt: "13.79"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		history, err := NewSalesHistory(filepath.Join(dir, "sales.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		invoices, err := OpenSequencer(filepath.Join(dir, "sequences.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sale := testSale()
+		if _, err := invoices.Next(ctx, key, sale.TrdInvcNo); err != nil {
+			t.Fatal(err)
+		}
+		if err := invoices.Confirm(ctx, key, sale.InvcNo); err != nil {
+			t.Fatal(err)
+		}
+		if err := history.Record(ctx, sale, nil); err != nil {
+			t.Fatal(err)
+		}
+		c := fakeSalesVSCU(t, tt.answers)
+
+		for i, s := range tt.steps {
+			lines := []CreditNoteLine{{ItemSeq: 1, Qty: MustParseDecimal(s.qty)}}
+			note, err := c.CreateCreditNote(ctx, history, invoices, sale.InvcNo, lines, CreditNoteRefund)
+			switch {
+			case s.wantErr != nil:
+				if !errors.Is(err, s.wantErr) {
+					t.Errorf("%s: step %d: error %v, want %v", tt.name, i, err, s.wantErr)
+				}
+				continue
+			case s.transport:
+				if !IsTransport(err) || note == nil {
+					t.Errorf("%s: step %d: %v, %v, want a held credit note", tt.name, i, note, err)
+					continue
+				}
+			case s.rejected:
+				if err == nil || IsTransport(err) || note != nil {
+					t.Errorf("%s: step %d: %v, %v, want a rejection", tt.name, i, note, err)
+				}
+			default:
+				if err != nil {
+					t.Errorf("%s: step %d: %v", tt.name, i, err)
+					continue
+				}
+			}
+
+			if s.discard {
+				if err := history.Release(ctx, testTin, testBhfId, s.no); err != nil {
+					t.Fatal(err)
+				}
+				if err := invoices.Void(ctx, key, s.no, "discarded"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := numberState(invoices.Audit(key), s.no); got != s.state {
+				t.Errorf("%s: step %d: number %d is %q, want %q", tt.name, i, s.no, got, s.state)
+			}
+			rec, ok := history.Sale(testTin, testBhfId, s.no)
+			if wantOk := !s.rejected && !s.discard; ok != wantOk || ok && rec.Held != s.transport {
+				t.Errorf("%s: step %d: credit note %d in history %v, held %v", tt.name, i, s.no, ok, rec.Held)
+			}
+			if note == nil {
+				continue
+			}
+			item := note.Request.ItemList[0]
+			if note.Request.InvcNo != s.no || item.TotAmt.String() != s.totAmt || item.TaxAmt.String() != s.taxAmt {
+				t.Errorf("%s: step %d: credit note %d refunds totAmt %s, taxAmt %s, want %d refunding %s, %s",
+					tt.name, i, note.Request.InvcNo, item.TotAmt, item.TaxAmt, s.no, s.totAmt, s.taxAmt)
+			}
+			if note.Request.TotAmt != item.TotAmt || note.Request.TaxAmtB != item.TaxAmt {
+				t.Errorf("%s: step %d: totals totAmt %s, taxAmtB %s, want the line's", tt.name, i, note.Request.TotAmt, note.Request.TaxAmtB)
+			}
+		}
+		invoices.Close()
+	}
+}
+
+func TestRefundLine(t *testing.T) {
+	item := testSale().ItemList[0]
+	third := func() TrnsSalesSaveWrItem {
+		return TrnsSalesSaveWrItem{Qty: NewDecimal(1), Pkg: NewDecimal(1), SplyAmt: MustParseDecimal("33.33"), TaxblAmt: MustParseDecimal("33.33"), TaxAmt: MustParseDecimal("4.60"), TotAmt: MustParseDecimal("33.33")}
+	}
+	twoThirds := third()
+	for _, d := range []*Decimal{&twoThirds.Qty, &twoThirds.Pkg, &twoThirds.SplyAmt, &twoThirds.TaxblAmt, &twoThirds.TaxAmt, &twoThirds.TotAmt} {
+		*d = d.Add(*d)
+	}
+
+	tests := []struct {
+		name    string
+		prev    TrnsSalesSaveWrItem
+		qty     string
+		totAmt  string
+		taxAmt  string
+		wantErr error
+	}{
+		{name: "first third", qty: "1", totAmt: "33.33", taxAmt: "4.60"},
+		{name: "second third", prev: third(), qty: "1", totAmt: "33.33", taxAmt: "4.60"},
+		{name: "last third", prev: twoThirds, qty: "1", totAmt: "33.34", taxAmt: "4.59"},
+		{name: "rest after a third", prev: third(), qty: "2", totAmt: "66.67", taxAmt: "9.19"},
+		{name: "fractional quantity", qty: "0.5", totAmt: "16.67", taxAmt: "2.30"},
+		{name: "more than sold", qty: "3.01", wantErr: ErrRefundExceedsSale},
+		{name: "more than left", prev: twoThirds, qty: "2", wantErr: ErrRefundExceedsSale},
+		{name: "amount refunded beyond the sale", prev: TrnsSalesSaveWrItem{TotAmt: NewDecimal(100)}, qty: "1", wantErr: ErrRefundExceedsSale},
+	}
+	for _, tt := range tests {
+		got, err := refundLine(item, tt.prev, MustParseDecimal(tt.qty))
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.TotAmt.String() != tt.totAmt || got.TaxAmt.String() != tt.taxAmt || got.Qty.String() != MustParseDecimal(tt.qty).String() {
+			t.Errorf("%s: qty %s, totAmt %s, taxAmt %s, want %s, %s", tt.name, got.Qty, got.TotAmt, got.TaxAmt, tt.totAmt, tt.taxAmt)
+		}
+	}
+
+	if _, err := refundLine(item, TrnsSalesSaveWrItem{}, Zero); err == nil {
+		t.Error("refunding nothing succeeded")
+	}
+}
@@ -0,0 +1,246 @@
+package etims
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rounding is how a Decimal result is rounded to the cent.
+type Rounding int
+
+const (
+	// RoundHalfUp rounds halves away from zero, as KRA does.
+	RoundHalfUp Rounding = iota
+	// RoundHalfEven rounds halves to the even cent (banker's rounding).
+	RoundHalfEven
+)
+
+// Decimal is an exact amount with two decimals, the NUMBER(18,2) and
+// NUMBER(7,2) of the spec. It is marshalled as a JSON number with exactly
+// two decimals. The zero value is 0.00.
+type Decimal struct {
+	cents int64
+}
+
+// Common decimals.
+var (
+	Zero    = Decimal{}
+	Hundred = NewDecimal(100)
+)
+
+// ErrDecimalRange is returned when a value does not fit a Decimal, whose
+// cents are an int64.
+var ErrDecimalRange = errors.New("etims: decimal out of range")
+
+// NewDecimal returns the whole number n. It panics if n does not fit a
+// Decimal.
+func NewDecimal(n int64) Decimal {
+	if n > math.MaxInt64/100 || n < math.MinInt64/100 {
+		panic(fmt.Errorf("%w: %d", ErrDecimalRange, n))
+	}
+	return Decimal{cents: n * 100}
+}
+
+// Cents returns the decimal n/100.
+func Cents(n int64) Decimal {
+	return Decimal{cents: n}
+}
+
+// plainDecimal is the only syntax ParseDecimal accepts: an optional sign,
+// digits and optional decimals, with no exponent, base prefix or fraction.
+var plainDecimal = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+// ParseDecimal parses a decimal such as "1160", "-3.5" or "16.00". Digits
+// beyond the cent are rounded with r.
+func ParseDecimal(s string, r Rounding) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if !plainDecimal.MatchString(s) {
+		return Decimal{}, fmt.Errorf("etims: invalid decimal %q", s)
+	}
+	rat, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("etims: invalid decimal %q", s)
+	}
+	num := new(big.Int).Mul(rat.Num(), big.NewInt(100))
+	d, ok := roundQuo(num, rat.Denom(), r)
+	if !ok {
+		return Decimal{}, fmt.Errorf("%w: %s", ErrDecimalRange, s)
+	}
+	return d, nil
+}
+
+// MustParseDecimal is ParseDecimal with RoundHalfUp that panics on a
+// malformed s. It is meant for constants.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s, RoundHalfUp)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// DecimalFromFloat returns f rounded to the cent with r. It fails if f is
+// NaN, infinite or does not fit a Decimal.
+func DecimalFromFloat(f float64, r Rounding) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}, fmt.Errorf("etims: invalid decimal %v", f)
+	}
+	return ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64), r)
+}
+
+// Cents returns d in cents.
+func (d Decimal) Cents() int64 {
+	return d.cents
+}
+
+// Float64 returns d as a float, for display and statistics only.
+func (d Decimal) Float64() float64 {
+	return float64(d.cents) / 100
+}
+
+func (d Decimal) Add(e Decimal) Decimal {
+	return Decimal{cents: d.cents + e.cents}
+}
+
+func (d Decimal) Sub(e Decimal) Decimal {
+	return Decimal{cents: d.cents - e.cents}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{cents: -d.cents}
+}
+
+// Mul returns d*e rounded to the cent with r. It fails with
+// ErrDecimalRange if the result does not fit a Decimal.
+func (d Decimal) Mul(e Decimal, r Rounding) (Decimal, error) {
+	return d.MulDiv(e, NewDecimal(1), r)
+}
+
+// Div returns d/e rounded to the cent with r. It fails if e is zero or the
+// result does not fit a Decimal.
+func (d Decimal) Div(e Decimal, r Rounding) (Decimal, error) {
+	return d.MulDiv(NewDecimal(1), e, r)
+}
+
+// MulDiv returns d*num/den with a single rounding to the cent, so that
+// e.g. the tax in a tax-inclusive amount, amt*rate/(100+rate), is not
+// rounded twice. It fails if den is zero, and with ErrDecimalRange if the
+// result does not fit a Decimal.
+func (d Decimal) MulDiv(num, den Decimal, r Rounding) (Decimal, error) {
+	if den.IsZero() {
+		return Decimal{}, fmt.Errorf("etims: %s*%s divided by zero", d, num)
+	}
+	n := new(big.Int).Mul(big.NewInt(d.cents), big.NewInt(num.cents))
+	q, ok := roundQuo(n, big.NewInt(den.cents), r)
+	if !ok {
+		return Decimal{}, fmt.Errorf("%w: %s*%s/%s", ErrDecimalRange, d, num, den)
+	}
+	return q, nil
+}
+
+// Percent returns rate percent of d, rounded to the cent with r. It fails
+// with ErrDecimalRange if the result does not fit a Decimal.
+func (d Decimal) Percent(rate Decimal, r Rounding) (Decimal, error) {
+	return d.MulDiv(rate, Hundred, r)
+}
+
+// Cmp returns -1, 0 or +1 as d is less than, equal to or greater than e.
+func (d Decimal) Cmp(e Decimal) int {
+	switch {
+	case d.cents < e.cents:
+		return -1
+	case d.cents > e.cents:
+		return 1
+	}
+	return 0
+}
+
+// Sign returns -1, 0 or +1 as d is negative, zero or positive.
+func (d Decimal) Sign() int {
+	return d.Cmp(Zero)
+}
+
+func (d Decimal) IsZero() bool {
+	return d.cents == 0
+}
+
+// String formats d with exactly two decimals, e.g. "1160.00".
+func (d Decimal) String() string {
+	sign := ""
+	// In uint64, so that negating the smallest Decimal does not overflow.
+	c := uint64(d.cents)
+	if d.cents < 0 {
+		sign, c = "-", -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number, a numeric string or null, which is
+// zero. Digits beyond the cent, as floats sent by the VSCU can have, are
+// rounded half up.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		*d = Decimal{}
+		return nil
+	}
+	s := string(data)
+	if unq, err := strconv.Unquote(s); err == nil {
+		s = unq
+		if s == "" {
+			*d = Decimal{}
+			return nil
+		}
+	}
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("etims: invalid decimal %s", data)
+		}
+		v, err := DecimalFromFloat(f, RoundHalfUp)
+		if err != nil {
+			return err
+		}
+		*d = v
+		return nil
+	}
+	v, err := ParseDecimal(s, RoundHalfUp)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// roundQuo returns the decimal of num/den cents, rounded with r. ok is
+// false if it does not fit a Decimal.
+func roundQuo(num, den *big.Int, r Rounding) (d Decimal, ok bool) {
+	if den.Sign() < 0 {
+		num, den = new(big.Int).Neg(num), new(big.Int).Neg(den)
+	}
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		// Compare twice the remainder with the divisor to find which cent
+		// is nearer.
+		twice := new(big.Int).Abs(rem)
+		twice.Lsh(twice, 1)
+		c := twice.Cmp(den)
+		if c > 0 || c == 0 && (r == RoundHalfUp || q.Bit(0) == 1) {
+			q.Add(q, big.NewInt(int64(num.Sign())))
+		}
+	}
+	if !q.IsInt64() {
+		return Decimal{}, false
+	}
+	return Decimal{cents: q.Int64()}, true
+}
@@ -0,0 +1,182 @@
+package etims
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in      string
+		r       Rounding
+		want    string
+		wantErr error
+	}{
+		{in: "1160", want: "1160.00"},
+		{in: "-3.5", want: "-3.50"},
+		{in: " 16.00 ", want: "16.00"},
+		{in: "+0.1", want: "0.10"},
+		{in: "0.005", want: "0.01"},
+		{in: "-0.005", want: "-0.01"},
+		{in: "0.005", r: RoundHalfEven, want: "0.00"},
+		{in: "0.015", r: RoundHalfEven, want: "0.02"},
+		{in: "0.0049999", want: "0.00"},
+		{in: "92233720368547758.07", want: "92233720368547758.07"},
+		{in: "-92233720368547758.08", want: "-92233720368547758.08"},
+		{in: "92233720368547758.08", wantErr: ErrDecimalRange},
+		{in: "1e3"},
+		{in: "0x10"},
+		{in: "1/3"},
+		{in: ".5"},
+		{in: "5."},
+		{in: ""},
+		{in: "abc"},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.in, tt.r)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseDecimal(%q) = %s, want error", tt.in, got)
+			} else if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseDecimal(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDecimal(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseDecimal(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func() (Decimal, error)
+		want string
+	}{
+		{"mul", func() (Decimal, error) { return MustParseDecimal("3.33").Mul(NewDecimal(3), RoundHalfUp) }, "9.99"},
+		{"mul rounds", func() (Decimal, error) { return MustParseDecimal("0.35").Mul(MustParseDecimal("0.5"), RoundHalfUp) }, "0.18"},
+		{"mul rounds even", func() (Decimal, error) { return MustParseDecimal("0.35").Mul(MustParseDecimal("0.5"), RoundHalfEven) }, "0.18"},
+		{"mul rounds even down", func() (Decimal, error) { return MustParseDecimal("0.25").Mul(MustParseDecimal("0.5"), RoundHalfEven) }, "0.12"},
+		{"div", func() (Decimal, error) { return NewDecimal(10).Div(NewDecimal(3), RoundHalfUp) }, "3.33"},
+		{"div negative", func() (Decimal, error) { return NewDecimal(-10).Div(NewDecimal(6), RoundHalfUp) }, "-1.67"},
+		{"div by negative", func() (Decimal, error) { return NewDecimal(10).Div(NewDecimal(-6), RoundHalfUp) }, "-1.67"},
+		{"tax in inclusive amount", func() (Decimal, error) {
+			return NewDecimal(1160).MulDiv(NewDecimal(16), NewDecimal(116), RoundHalfUp)
+		}, "160.00"},
+		{"single rounding", func() (Decimal, error) { return NewDecimal(100).MulDiv(NewDecimal(16), NewDecimal(116), RoundHalfUp) }, "13.79"},
+		{"percent", func() (Decimal, error) { return MustParseDecimal("999.99").Percent(NewDecimal(16), RoundHalfUp) }, "160.00"},
+		{"percent of negative", func() (Decimal, error) { return MustParseDecimal("-0.03").Percent(NewDecimal(50), RoundHalfUp) }, "-0.02"},
+	}
+	for _, tt := range tests {
+		got, err := tt.f()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecimalOverflow(t *testing.T) {
+	max := Cents(math.MaxInt64)
+	func() {
+		defer func() {
+			err, _ := recover().(error)
+			if !errors.Is(err, ErrDecimalRange) {
+				t.Errorf("new: recovered %v, want %v", err, ErrDecimalRange)
+			}
+		}()
+		NewDecimal(math.MaxInt64 / 10)
+	}()
+
+	tests := []struct {
+		name    string
+		f       func() (Decimal, error)
+		wantErr error
+	}{
+		{"mul", func() (Decimal, error) { return max.Mul(NewDecimal(2), RoundHalfUp) }, ErrDecimalRange},
+		{"div", func() (Decimal, error) { return max.Div(MustParseDecimal("0.5"), RoundHalfUp) }, ErrDecimalRange},
+		{"muldiv", func() (Decimal, error) { return max.MulDiv(NewDecimal(3), NewDecimal(2), RoundHalfUp) }, ErrDecimalRange},
+		{"percent", func() (Decimal, error) { return max.Percent(NewDecimal(200), RoundHalfUp) }, ErrDecimalRange},
+		{"div by zero", func() (Decimal, error) { return NewDecimal(1).Div(Zero, RoundHalfUp) }, nil},
+	}
+	for _, tt := range tests {
+		_, err := tt.f()
+		if err == nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDecimalFromFloat(t *testing.T) {
+	tests := []struct {
+		in      float64
+		want    string
+		wantErr bool
+	}{
+		{in: 274576.27, want: "274576.27"},
+		{in: 0.125, want: "0.13"},
+		{in: -1.005, want: "-1.01"},
+		{in: 1e20, wantErr: true},
+		{in: math.NaN(), wantErr: true},
+		{in: math.Inf(1), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := DecimalFromFloat(tt.in, RoundHalfUp)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("DecimalFromFloat(%v) = %s, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("DecimalFromFloat(%v) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: `1800000`, want: "1800000.00"},
+		{in: `274576.27`, want: "274576.27"},
+		{in: `274576.2712`, want: "274576.27"},
+		{in: `"16.5"`, want: "16.50"},
+		{in: `""`, want: "0.00"},
+		{in: `null`, want: "0.00"},
+		{in: `1.5e2`, want: "150.00"},
+		{in: `"1e400"`, wantErr: true},
+		{in: `"12abc"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var d Decimal
+		err := json.Unmarshal([]byte(tt.in), &d)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unmarshal %s = %s, want error", tt.in, d)
+			}
+			continue
+		}
+		if err != nil || d.String() != tt.want {
+			t.Errorf("unmarshal %s = %s, %v, want %s", tt.in, d, err, tt.want)
+			continue
+		}
+		out, err := json.Marshal(d)
+		if err != nil || string(out) != tt.want {
+			t.Errorf("marshal %s = %s, %v, want %s", d, out, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"testapi/secrets"
+)
+
+// DeviceProfile is what the VSCU reported when a device was initialized:
+// the taxpayer, branch and manager details printed on receipts, the device
+// identifiers, and the keys issued to the device.
+type DeviceProfile struct {
+	DvcSrlNo string `json:"dvcSrlNo"`
+	// Info is the device information without its keys, which are in Keys.
+	Info InitInfo `json:"info"`
+	// Keys are never written with the profile; a DeviceStore keeps them
+	// apart, e.g. in a secret source.
+	Keys          DeviceKeys `json:"-"`
+	InitializedAt time.Time  `json:"initializedAt"`
+}
+
+// DeviceKeys are the keys the VSCU issues to a device at initialization.
+type DeviceKeys struct {
+	CmcKey   string
+	IntrlKey string
+	SignKey  string
+}
+
+// takeKeys moves the keys of p.Info to p.Keys.
+func (p *DeviceProfile) takeKeys() {
+	if p.Info.CmcKey != "" {
+		p.Keys.CmcKey = p.Info.CmcKey
+	}
+	if p.Info.IntrlKey != "" {
+		p.Keys.IntrlKey = p.Info.IntrlKey
+	}
+	if p.Info.SignKey != "" {
+		p.Keys.SignKey = p.Info.SignKey
+	}
+	p.Info.CmcKey, p.Info.IntrlKey, p.Info.SignKey = "", "", ""
+}
+
+// ReceiptHeader is the part of a device profile printed at the top of every
+// receipt.
+type ReceiptHeader struct {
+	TaxprNm string
+	Tin     string
+	BhfNm   string
+	Address string
+	MgrTel  string
+	MgrMail string
+	SdcId   string
+	MrcNo   string
+}
+
+// ReceiptHeader returns the receipt header for the device's branch.
+func (p *DeviceProfile) ReceiptHeader() ReceiptHeader {
+	var addr []string
+	for _, s := range []string{p.Info.LocDesc, p.Info.SctrNm, p.Info.DstrtNm, p.Info.PrvncNm} {
+		if s != "" {
+			addr = append(addr, s)
+		}
+	}
+	return ReceiptHeader{
+		TaxprNm: p.Info.TaxprNm,
+		Tin:     p.Info.Tin,
+		BhfNm:   p.Info.BhfNm,
+		Address: strings.Join(addr, ", "),
+		MgrTel:  p.Info.MgrTelNo,
+		MgrMail: p.Info.MgrEmail,
+		SdcId:   p.Info.SdcId,
+		MrcNo:   p.Info.MrcNo,
+	}
+}
+
+// DeviceStore keeps the device profile of each branch.
+type DeviceStore interface {
+	// Load returns the stored profile, or nil if there is none.
+	Load(ctx context.Context, tin, bhfId string) (*DeviceProfile, error)
+	Save(ctx context.Context, p *DeviceProfile) error
+}
+
+// KeySource looks up the device keys by name. secrets.Source satisfies it;
+// a source that can also Set, such as secrets.Keystore, stores the keys of
+// newly initialized devices.
+type KeySource interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+type keySetter interface {
+	Set(name, value string) error
+}
+
+// DeviceKeyName returns the name of device key kind ("cmc", "intrl" or
+// "sign") of branch bhfId in a KeySource, e.g. "intrl-key-00".
+func DeviceKeyName(kind, bhfId string) string {
+	return kind + "-key-" + bhfId
+}
+
+// FileDeviceStore is a DeviceStore backed by a JSON file. The device keys
+// are not written to the file but kept in a KeySource. Keys issued to a
+// device that the source cannot store, e.g. a rotated CMC key with secrets
+// in the environment, are kept in a second file next to it, readable only
+// by its owner, and take precedence over the source until the source
+// stores them.
+type FileDeviceStore struct {
+	file    jsonFile
+	keys    KeySource
+	keyName func(kind, bhfId string) string
+	keyFile jsonFile
+
+	mu       sync.Mutex
+	profiles map[string]*DeviceProfile
+	// issued are the keys kept in keyFile, by name.
+	issued map[string]string
+}
+
+// NewFileDeviceStore opens the store at path, creating it on first Save.
+// keyName names the keys in keys; DeviceKeyName is used if it is nil. Keys
+// the source cannot store are kept at path with the extension .keys.json.
+func NewFileDeviceStore(path string, keys KeySource, keyName func(kind, bhfId string) string) (*FileDeviceStore, error) {
+	if keyName == nil {
+		keyName = DeviceKeyName
+	}
+	s := &FileDeviceStore{
+		file:     jsonFile{path: path, name: "device profiles", perm: 0o600},
+		keys:     keys,
+		keyName:  keyName,
+		keyFile:  jsonFile{path: strings.TrimSuffix(path, filepath.Ext(path)) + ".keys.json", name: "device keys", perm: 0o600},
+		profiles: make(map[string]*DeviceProfile),
+		issued:   make(map[string]string),
+	}
+	if err := s.file.load(&s.profiles); err != nil {
+		return nil, err
+	}
+	if err := s.keyFile.load(&s.issued); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// KeyFile returns the path of the file keeping the keys the source cannot
+// store.
+func (s *FileDeviceStore) KeyFile() string {
+	return s.keyFile.path
+}
+
+func (s *FileDeviceStore) Load(ctx context.Context, tin, bhfId string) (*DeviceProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.profiles[branchKey(tin, bhfId)]
+	if !ok {
+		return nil, nil
+	}
+	cp := *p
+	issued := maps.Clone(s.issued)
+	for _, k := range []struct {
+		kind string
+		v    *string
+	}{{"cmc", &cp.Keys.CmcKey}, {"intrl", &cp.Keys.IntrlKey}, {"sign", &cp.Keys.SignKey}} {
+		name := s.keyName(k.kind, bhfId)
+		v, err := s.keys.Secret(ctx, name)
+		if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+			return nil, fmt.Errorf("failed to load device %s key: %w", k.kind, err)
+		}
+		if kept, ok := issued[name]; ok {
+			if kept != v {
+				*k.v = kept
+				continue
+			}
+			// The operator stored the key in the source.
+			delete(issued, name)
+		}
+		if err == nil {
+			*k.v = v
+		}
+	}
+	if err := s.writeIssued(issued); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (s *FileDeviceStore) Save(ctx context.Context, p *DeviceProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *p
+	cp.takeKeys()
+	if err := s.saveKeys(&cp); err != nil {
+		return err
+	}
+
+	key := branchKey(cp.Info.Tin, cp.Info.BhfId)
+	previous, existed := s.profiles[key]
+	s.profiles[key] = &cp
+	if err := s.file.write(s.profiles); err != nil {
+		if existed {
+			s.profiles[key] = previous
+		} else {
+			delete(s.profiles, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// saveKeys stores the keys of p in the key source if it can store them, and
+// in the key file otherwise. s.mu must be held.
+func (s *FileDeviceStore) saveKeys(p *DeviceProfile) error {
+	set, canSet := s.keys.(keySetter)
+	issued := maps.Clone(s.issued)
+	for kind, v := range map[string]string{"cmc": p.Keys.CmcKey, "intrl": p.Keys.IntrlKey, "sign": p.Keys.SignKey} {
+		if v == "" {
+			continue
+		}
+		name := s.keyName(kind, p.Info.BhfId)
+		if !canSet {
+			issued[name] = v
+			continue
+		}
+		if err := set.Set(name, v); err != nil {
+			return fmt.Errorf("failed to store device %s key: %w", kind, err)
+		}
+		delete(issued, name)
+	}
+	return s.writeIssued(issued)
+}
+
+// writeIssued replaces the keys kept in the key file with issued, if they
+// changed. s.mu must be held.
+func (s *FileDeviceStore) writeIssued(issued map[string]string) error {
+	if maps.Equal(issued, s.issued) {
+		return nil
+	}
+	if err := s.keyFile.write(issued); err != nil {
+		return err
+	}
+	s.issued = issued
+	return nil
+}
+
+// Initialize makes sure the client's device is initialized and returns its
+// profile.
+//
+// If store already holds a profile for dvcSrlNo, Initialize returns it
+// without calling the VSCU unless force is set. Otherwise it calls
+// /initializer/selectInitInfo and stores the returned profile. A 902
+// "This device is installed" answer means the device was initialized
+// earlier; Initialize then returns the stored profile, or one carrying only
+// the identifiers if there is none, and no error.
+//
+// The client switches to the CMC key of the returned profile, so a key
+// rotated by initialization is used for every later request.
+func (c *Client) Initialize(ctx context.Context, store DeviceStore, dvcSrlNo string, force bool) (*DeviceProfile, error) {
+	stored, err := store.Load(ctx, c.tin, c.bhfId)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil && stored.DvcSrlNo != dvcSrlNo {
+		stored = nil
+	}
+
+	if stored != nil && !force {
+		c.useProfile(stored)
+		return stored, nil
+	}
+
+	res, err := c.SelectInitInfo(ctx, InitRequest{DvcSrlNo: dvcSrlNo})
+	if errors.Is(err, ErrDeviceInstalled) {
+		if stored == nil {
+			stored = &DeviceProfile{DvcSrlNo: dvcSrlNo, Info: InitInfo{Tin: c.tin, BhfId: c.bhfId}}
+		}
+		c.useProfile(stored)
+		return stored, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.Data == nil {
+		return nil, fmt.Errorf("%s: response has no device information", PathSelectInitInfo)
+	}
+
+	p := &DeviceProfile{
+		DvcSrlNo:      dvcSrlNo,
+		Info:          res.Data.Info,
+		InitializedAt: time.Now(),
+	}
+	p.takeKeys()
+	if p.Info.Tin == "" {
+		p.Info.Tin = c.tin
+	}
+	if p.Info.BhfId == "" {
+		p.Info.BhfId = c.bhfId
+	}
+	if err := store.Save(ctx, p); err != nil {
+		return nil, err
+	}
+	c.useProfile(p)
+	return p, nil
+}
+
+// useProfile switches to the CMC key issued to the device, if any.
+func (c *Client) useProfile(p *DeviceProfile) {
+	if p.Keys.CmcKey == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cmcKey = p.Keys.CmcKey
+}
@@ -0,0 +1,111 @@
+package etims
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"testapi/secrets"
+)
+
+func TestFileDeviceStoreKeys(t *testing.T) {
+	ctx := context.Background()
+	// The CMC key is named as a branch's cmcKeySecret would name it.
+	keyName := func(kind, bhfId string) string {
+		if kind == "cmc" {
+			return "shop-cmc-" + bhfId
+		}
+		return DeviceKeyName(kind, bhfId)
+	}
+	profile := &DeviceProfile{
+		DvcSrlNo: "dvc1",
+		Info:     InitInfo{Tin: testTin, BhfId: testBhfId, CmcKey: "rotated", IntrlKey: "intrl", SignKey: "sign"},
+	}
+
+	tests := []struct {
+		name   string
+		source func(t *testing.T, dir string) KeySource
+		// stored is what the operator puts in the source after Save.
+		stored string
+		want   string
+		// kept is true if the keys are in the key file afterwards.
+		kept bool
+	}{
+		{
+			name:   "env keeps the rotated key",
+			source: func(t *testing.T, dir string) KeySource { return secrets.EnvSource{Prefix: "DEVICE_TEST_"} },
+			stored: "old",
+			want:   "rotated",
+			kept:   true,
+		},
+		{
+			name:   "env stored the rotated key",
+			source: func(t *testing.T, dir string) KeySource { return secrets.EnvSource{Prefix: "DEVICE_TEST_"} },
+			stored: "rotated",
+			want:   "rotated",
+		},
+		{
+			name:   "file keeps the rotated key",
+			source: func(t *testing.T, dir string) KeySource { return secrets.FileSource{Dir: dir} },
+			want:   "rotated",
+			kept:   true,
+		},
+		{
+			name: "keystore stores the rotated key",
+			source: func(t *testing.T, dir string) KeySource {
+				ks, err := secrets.OpenKeystore(filepath.Join(dir, "keystore.json"), "passphrase")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return ks
+			},
+			want: "rotated",
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		source := tt.source(t, dir)
+		path := filepath.Join(dir, "devices.json")
+		s, err := NewFileDeviceStore(path, source, keyName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := *profile
+		p.takeKeys()
+		if err := s.Save(ctx, &p); err != nil {
+			t.Fatalf("%s: Save: %v", tt.name, err)
+		}
+		if tt.stored != "" {
+			t.Setenv("DEVICE_TEST_SHOP_CMC_"+testBhfId, tt.stored)
+		}
+
+		s, err = NewFileDeviceStore(path, source, keyName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Load(ctx, testTin, testBhfId)
+		if err != nil {
+			t.Fatalf("%s: Load: %v", tt.name, err)
+		}
+		if want := (DeviceKeys{CmcKey: tt.want, IntrlKey: "intrl", SignKey: "sign"}); got.Keys != want {
+			t.Errorf("%s: keys %+v, want %+v", tt.name, got.Keys, want)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "rotated") {
+			t.Errorf("%s: profile file holds the key:\n%s", tt.name, data)
+		}
+		data, err = os.ReadFile(s.KeyFile())
+		if kept := err == nil && strings.Contains(string(data), "rotated"); kept != tt.kept {
+			t.Errorf("%s: key file holds the key %v, want %v", tt.name, kept, tt.kept)
+		}
+		if fi, err := os.Stat(s.KeyFile()); err == nil && fi.Mode().Perm() != 0o600 {
+			t.Errorf("%s: key file mode %v, want 0600", tt.name, fi.Mode().Perm())
+		}
+	}
+}
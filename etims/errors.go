@@ -0,0 +1,214 @@
+package etims
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Result codes from the VSCU API Response Code table (spec section 4.14).
+// Codes 891-899 are raised by the VSCU client side, 900-999 by the eTIMS
+// server.
+const (
+	ResultURLCreation        = "891"
+	ResultHeaderCreation     = "892"
+	ResultBodyCreation       = "893"
+	ResultCommunication      = "894"
+	ResultMethodNotAllowed   = "895"
+	ResultRequestStatus      = "896"
+	ResultClient             = "899"
+	ResultNoHeader           = "900"
+	ResultInvalidDevice      = "901"
+	ResultDeviceInstalled    = "902"
+	ResultNotVSCUDevice      = "903"
+	ResultParameter          = "910"
+	ResultNoRequestBody      = "911"
+	ResultRequestMethod      = "912"
+	ResultSalesDeclared      = "921"
+	ResultSalesNotReceived   = "922"
+	ResultViewLimitExceeded  = "990"
+	ResultRegistrationFailed = "991"
+	ResultModificationFailed = "992"
+	ResultDeletionFailed     = "993"
+	ResultOverlappedData     = "994"
+	ResultNoDownloadedFile   = "995"
+	ResultUnknown            = "999"
+)
+
+// Sentinel errors for every rejecting result code. A *ResultError matches
+// the sentinel with the same code under errors.Is, so callers can write
+// errors.Is(err, etims.ErrOverlappedData).
+var (
+	ErrURLCreation        = newSentinel(ResultURLCreation, "An error occurred while Request URL is created.")
+	ErrHeaderCreation     = newSentinel(ResultHeaderCreation, "An error occurred while Request Header data is created.")
+	ErrBodyCreation       = newSentinel(ResultBodyCreation, "An error occurred while Request Body data is created.")
+	ErrCommunication      = newSentinel(ResultCommunication, "An error regarding server communication occurred.")
+	ErrMethodNotAllowed   = newSentinel(ResultMethodNotAllowed, "An error regarding unallowed Request Method occurred.")
+	ErrRequestStatus      = newSentinel(ResultRequestStatus, "An error regarding Request Status occurred.")
+	ErrClient             = newSentinel(ResultClient, "An error regarding Client occurred.")
+	ErrNoHeader           = newSentinel(ResultNoHeader, "There is no Header information")
+	ErrInvalidDevice      = newSentinel(ResultInvalidDevice, "It is not valid device")
+	ErrDeviceInstalled    = newSentinel(ResultDeviceInstalled, "This device is installed")
+	ErrNotVSCUDevice      = newSentinel(ResultNotVSCUDevice, "Only VSCU device can be verified.")
+	ErrParameter          = newSentinel(ResultParameter, "Request parameter error")
+	ErrNoRequestBody      = newSentinel(ResultNoRequestBody, "There is no request full text")
+	ErrRequestMethod      = newSentinel(ResultRequestMethod, "There is a request Method error.")
+	ErrSalesDeclared      = newSentinel(ResultSalesDeclared, "Sales or sales invoice data which is declared cannot be received.")
+	ErrSalesNotReceived   = newSentinel(ResultSalesNotReceived, "Sales invoice data can be received after receiving the sales data.")
+	ErrViewLimitExceeded  = newSentinel(ResultViewLimitExceeded, "The maxium number of views are exceeded")
+	ErrRegistrationFailed = newSentinel(ResultRegistrationFailed, "There is an error during registration")
+	ErrModificationFailed = newSentinel(ResultModificationFailed, "There is an error during modification")
+	ErrDeletionFailed     = newSentinel(ResultDeletionFailed, "There is an error during deletion")
+	ErrOverlappedData     = newSentinel(ResultOverlappedData, "There is an overlapped Data")
+	ErrNoDownloadedFile   = newSentinel(ResultNoDownloadedFile, "There is no downloaded file")
+	ErrUnknown            = newSentinel(ResultUnknown, "There is an unknown error. Please ask it administrator")
+)
+
+func newSentinel(code, msg string) *ResultError {
+	return &ResultError{ResultCd: code, ResultMsg: msg}
+}
+
+// ErrorClass groups result codes by how a caller should react to them.
+type ErrorClass int
+
+const (
+	// ClassUnknown is a code the taxonomy does not recognise.
+	ClassUnknown ErrorClass = iota
+	// ClassRetryable failures are transient; the same request may succeed
+	// if sent again later.
+	ClassRetryable
+	// ClassDuplicate means the VSCU already holds the data being sent.
+	ClassDuplicate
+	// ClassDevice means the device is not, or is already, initialized or
+	// is not allowed to talk to eTIMS.
+	ClassDevice
+	// ClassValidation means the request itself is wrong and must be fixed
+	// before it is sent again.
+	ClassValidation
+	// ClassServer is a server-side failure that retrying will not clear.
+	ClassServer
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassRetryable:
+		return "retryable"
+	case ClassDuplicate:
+		return "duplicate"
+	case ClassDevice:
+		return "device"
+	case ClassValidation:
+		return "validation"
+	case ClassServer:
+		return "server"
+	}
+	return "unknown"
+}
+
+var resultClasses = map[string]ErrorClass{
+	ResultURLCreation:        ClassValidation,
+	ResultHeaderCreation:     ClassValidation,
+	ResultBodyCreation:       ClassValidation,
+	ResultCommunication:      ClassRetryable,
+	ResultMethodNotAllowed:   ClassValidation,
+	ResultRequestStatus:      ClassRetryable,
+	ResultClient:             ClassUnknown,
+	ResultNoHeader:           ClassDevice,
+	ResultInvalidDevice:      ClassDevice,
+	ResultDeviceInstalled:    ClassDevice,
+	ResultNotVSCUDevice:      ClassDevice,
+	ResultParameter:          ClassValidation,
+	ResultNoRequestBody:      ClassValidation,
+	ResultRequestMethod:      ClassValidation,
+	ResultSalesDeclared:      ClassValidation,
+	ResultSalesNotReceived:   ClassValidation,
+	ResultViewLimitExceeded:  ClassServer,
+	ResultRegistrationFailed: ClassServer,
+	ResultModificationFailed: ClassServer,
+	ResultDeletionFailed:     ClassServer,
+	ResultOverlappedData:     ClassDuplicate,
+	ResultNoDownloadedFile:   ClassServer,
+	ResultUnknown:            ClassRetryable,
+}
+
+// ResultError is returned when the VSCU answers with a result code other
+// than 000 or 001.
+type ResultError struct {
+	Path      string
+	ResultCd  string
+	ResultMsg string
+	ResultDt  string
+}
+
+func (e *ResultError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("result code %s: %s", e.ResultCd, e.ResultMsg)
+	}
+	return fmt.Sprintf("%s: result code %s: %s", e.Path, e.ResultCd, e.ResultMsg)
+}
+
+// Is reports whether target is a *ResultError with the same result code.
+func (e *ResultError) Is(target error) bool {
+	t, ok := target.(*ResultError)
+	return ok && t.ResultCd == e.ResultCd
+}
+
+// Class classifies the result code.
+func (e *ResultError) Class() ErrorClass {
+	return resultClasses[e.ResultCd]
+}
+
+// ClassOf classifies err if it wraps a *ResultError and returns
+// ClassUnknown otherwise.
+func ClassOf(err error) ErrorClass {
+	var re *ResultError
+	if errors.As(err, &re) {
+		return re.Class()
+	}
+	return ClassUnknown
+}
+
+// IsRetryable reports whether err wraps a result code worth retrying.
+func IsRetryable(err error) bool {
+	return ClassOf(err) == ClassRetryable
+}
+
+// IsDuplicate reports whether err means the VSCU already holds the data.
+func IsDuplicate(err error) bool {
+	return ClassOf(err) == ClassDuplicate
+}
+
+// TransportError is returned when a request could not be sent, its
+// response could not be read, or it was answered with a server error
+// (5xx) or 429 status. The VSCU may or may not have processed the request.
+type TransportError struct {
+	Path string
+	Err  error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransport reports whether err means the VSCU could not be reached.
+func IsTransport(err error) bool {
+	var te *TransportError
+	return errors.As(err, &te)
+}
+
+// checkResult returns a *ResultError unless r reports success.
+func checkResult(path string, r *Result) error {
+	switch r.ResultCd {
+	case ResultSuccess, ResultNoSearchResult:
+		return nil
+	}
+	return &ResultError{
+		Path:      path,
+		ResultCd:  r.ResultCd,
+		ResultMsg: r.ResultMsg,
+		ResultDt:  r.ResultDt,
+	}
+}
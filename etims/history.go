@@ -0,0 +1,179 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sales receipt types (spec 4.9).
+const (
+	ReceiptTypeSale       = "S"
+	ReceiptTypeCreditNote = "R"
+)
+
+// ErrUnknownInvoice is returned when an invoice is not in the sales
+// history.
+var ErrUnknownInvoice = errors.New("etims: invoice not in sales history")
+
+// SaleRecord is a sales invoice accepted by the VSCU, or a credit note
+// held until it is.
+type SaleRecord struct {
+	Sale TrnsSalesSaveWrReq `json:"sale"`
+	// Receipt is what the VSCU returned for the invoice. It is nil for
+	// invoices delivered from the outbox.
+	Receipt *TrnsSalesSaveRes `json:"receipt,omitempty"`
+	// CreditNotes are the invoice numbers of the credit notes issued
+	// against the invoice, in order.
+	CreditNotes []int64 `json:"creditNotes,omitempty"`
+	// Held is true for a credit note that has its number but has not been
+	// accepted yet, e.g. because it waits in the outbox. It still counts
+	// against the invoice it refunds.
+	Held       bool      `json:"held,omitempty"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// SalesHistory keeps the sales invoices and credit notes of every branch,
+// persisted as a JSON file, so that a credit note can be checked against
+// the invoice it refunds.
+type SalesHistory struct {
+	file jsonFile
+
+	mu    sync.Mutex
+	sales map[string]*SaleRecord
+}
+
+// NewSalesHistory opens the history at path, creating it on first Record.
+func NewSalesHistory(path string) (*SalesHistory, error) {
+	h := &SalesHistory{
+		file:  jsonFile{path: path, name: "sales history"},
+		sales: make(map[string]*SaleRecord),
+	}
+	if err := h.file.load(&h.sales); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func saleKey(tin, bhfId string, invcNo int64) string {
+	return branchKey(tin, bhfId) + "/" + strconv.FormatInt(invcNo, 10)
+}
+
+// Record adds an accepted invoice to the history. A credit note is also
+// linked to the invoice it refunds. Recording an invoice again replaces it.
+func (h *SalesHistory) Record(ctx context.Context, sale TrnsSalesSaveWrReq, receipt *TrnsSalesSaveRes) error {
+	return h.record(sale, receipt, false)
+}
+
+// Hold adds a numbered credit note before it is sent, so that it counts
+// against the invoice it refunds until it is recorded or released.
+func (h *SalesHistory) Hold(ctx context.Context, note TrnsSalesSaveWrReq) error {
+	if note.RcptTyCd != ReceiptTypeCreditNote {
+		return fmt.Errorf("etims: invoice %d is not a credit note", note.InvcNo)
+	}
+	return h.record(note, nil, true)
+}
+
+func (h *SalesHistory) record(sale TrnsSalesSaveWrReq, receipt *TrnsSalesSaveRes, held bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := saleKey(sale.Tin, sale.BhfId, sale.InvcNo)
+	previous, existed := h.sales[key]
+	h.sales[key] = &SaleRecord{Sale: sale, Receipt: receipt, Held: held, RecordedAt: time.Now()}
+	if existed {
+		h.sales[key].CreditNotes = previous.CreditNotes
+	}
+
+	var org *SaleRecord
+	var orgNotes []int64
+	if sale.RcptTyCd == ReceiptTypeCreditNote {
+		org = h.sales[saleKey(sale.Tin, sale.BhfId, sale.OrgInvcNo)]
+		if org != nil && !slices.Contains(org.CreditNotes, sale.InvcNo) {
+			orgNotes = org.CreditNotes
+			org.CreditNotes = append(append([]int64(nil), orgNotes...), sale.InvcNo)
+		} else {
+			org = nil
+		}
+	}
+
+	if err := h.file.write(h.sales); err != nil {
+		if existed {
+			h.sales[key] = previous
+		} else {
+			delete(h.sales, key)
+		}
+		if org != nil {
+			org.CreditNotes = orgNotes
+		}
+		return err
+	}
+	return nil
+}
+
+// Release removes credit note invcNo of the branch if it is still held,
+// once it will not be declared.
+func (h *SalesHistory) Release(ctx context.Context, tin, bhfId string, invcNo int64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := saleKey(tin, bhfId, invcNo)
+	note, ok := h.sales[key]
+	if !ok || !note.Held {
+		return nil
+	}
+	delete(h.sales, key)
+
+	org := h.sales[saleKey(tin, bhfId, note.Sale.OrgInvcNo)]
+	var orgNotes []int64
+	if org != nil {
+		orgNotes = org.CreditNotes
+		org.CreditNotes = slices.DeleteFunc(slices.Clone(orgNotes), func(no int64) bool { return no == invcNo })
+	}
+
+	if err := h.file.write(h.sales); err != nil {
+		h.sales[key] = note
+		if org != nil {
+			org.CreditNotes = orgNotes
+		}
+		return err
+	}
+	return nil
+}
+
+// Sale returns invoice invcNo of the branch.
+func (h *SalesHistory) Sale(tin, bhfId string, invcNo int64) (SaleRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rec, ok := h.sales[saleKey(tin, bhfId, invcNo)]
+	if !ok {
+		return SaleRecord{}, false
+	}
+	return *rec, true
+}
+
+// CreditNotes returns the credit notes issued against invoice invcNo of the
+// branch, including held ones, in order.
+func (h *SalesHistory) CreditNotes(tin, bhfId string, invcNo int64) []TrnsSalesSaveWrReq {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rec, ok := h.sales[saleKey(tin, bhfId, invcNo)]
+	if !ok {
+		return nil
+	}
+	notes := make([]TrnsSalesSaveWrReq, 0, len(rec.CreditNotes))
+	for _, no := range rec.CreditNotes {
+		if note, ok := h.sales[saleKey(tin, bhfId, no)]; ok {
+			notes = append(notes, note.Sale)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].InvcNo < notes[j].InvcNo })
+	return notes
+}
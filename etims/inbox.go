@@ -0,0 +1,224 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+)
+
+// Statuses of a supplier invoice in the purchase inbox.
+const (
+	// PurchasePending invoices wait for accounts payable to match them to
+	// goods received.
+	PurchasePending = "pending"
+	// PurchaseAccepted invoices are to be declared as purchases.
+	PurchaseAccepted = "accepted"
+	// PurchaseRejected invoices are to be declared as canceled.
+	PurchaseRejected = "rejected"
+	// PurchaseDeclared invoices were declared to the VSCU.
+	PurchaseDeclared = "declared"
+)
+
+var (
+	// ErrUnknownPurchase is returned when a supplier invoice is not in the
+	// purchase inbox.
+	ErrUnknownPurchase = errors.New("etims: supplier invoice not in purchase inbox")
+	// ErrPurchaseDeclared is returned when reviewing a supplier invoice
+	// that was already declared.
+	ErrPurchaseDeclared = errors.New("etims: supplier invoice already declared")
+)
+
+// PurchaseKey identifies a supplier invoice received by one branch.
+type PurchaseKey struct {
+	Tin         string
+	BhfId       string
+	SpplrTin    string
+	SpplrBhfId  string
+	SpplrInvcNo int64
+}
+
+func (k PurchaseKey) String() string {
+	return branchKey(k.Tin, k.BhfId) + "/" + k.SpplrTin + "/" + k.SpplrBhfId + "/" + strconv.FormatInt(k.SpplrInvcNo, 10)
+}
+
+// InboxPurchase is a supplier invoice KRA reports the branch received.
+type InboxPurchase struct {
+	Tin    string            `json:"tin"`
+	BhfId  string            `json:"bhfId"`
+	Sale   TrnsPurchaseSales `json:"sale"`
+	Status string            `json:"status"`
+	// Note is the reviewer's remark, or why the declaration was rejected.
+	Note string `json:"note,omitempty"`
+	// Reviews counts the decisions made on the invoice, so that each one
+	// is declared under its own reference.
+	Reviews int `json:"reviews,omitempty"`
+	// PchsSttsCd and PchsInvcNo are the declaration of the invoice, once
+	// declared.
+	PchsSttsCd string    `json:"pchsSttsCd,omitempty"`
+	PchsInvcNo int64     `json:"pchsInvcNo,omitempty"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Key returns the key of the invoice.
+func (p InboxPurchase) Key() PurchaseKey {
+	return PurchaseKey{
+		Tin:         p.Tin,
+		BhfId:       p.BhfId,
+		SpplrTin:    p.Sale.SpplrTin,
+		SpplrBhfId:  p.Sale.SpplrBhfId,
+		SpplrInvcNo: p.Sale.SpplrInvcNo,
+	}
+}
+
+// Ref is the sequence reference of the invoice's current declaration.
+func (p InboxPurchase) Ref() string {
+	return p.Key().String() + "#" + strconv.Itoa(p.Reviews)
+}
+
+// Declaration returns the declaration of an accepted or rejected invoice.
+func (p InboxPurchase) Declaration() (TrnsPurchaseSaveReq, error) {
+	var pchsSttsCd string
+	switch p.Status {
+	case PurchaseAccepted:
+		pchsSttsCd = TransactionApproved
+	case PurchaseRejected:
+		pchsSttsCd = TransactionCanceled
+	default:
+		return TrnsPurchaseSaveReq{}, fmt.Errorf("etims: supplier invoice %s is %s", p.Key(), p.Status)
+	}
+	req := PurchaseDeclaration(p.Sale, pchsSttsCd)
+	req.Tin, req.BhfId = p.Tin, p.BhfId
+	return req, nil
+}
+
+func (p InboxPurchase) inboxKey() string {
+	return p.Key().String()
+}
+
+func (p InboxPurchase) branch() (tin, bhfId string) {
+	return p.Tin, p.BhfId
+}
+
+func (p InboxPurchase) status() string {
+	return p.Status
+}
+
+func (p InboxPurchase) receivedAt() time.Time {
+	return p.ReceivedAt
+}
+
+func (p *InboxPurchase) touch(now time.Time) {
+	p.UpdatedAt = now
+}
+
+// PurchaseInbox keeps the supplier invoices of every branch, persisted as a
+// JSON file, until accounts payable has reviewed and declared them.
+type PurchaseInbox struct {
+	purchases *inbox[InboxPurchase, *InboxPurchase]
+}
+
+// NewPurchaseInbox opens the inbox at path, creating it on first write.
+func NewPurchaseInbox(path string) (*PurchaseInbox, error) {
+	purchases, err := openInbox[InboxPurchase](path, "purchase inbox", ErrUnknownPurchase)
+	if err != nil {
+		return nil, err
+	}
+	return &PurchaseInbox{purchases: purchases}, nil
+}
+
+// Add stores the supplier invoices received by the branch as pending and
+// returns how many were new. Invoices already in the inbox are left as
+// they are, so retrieving the same list again changes nothing.
+func (in *PurchaseInbox) Add(ctx context.Context, tin, bhfId string, sales []TrnsPurchaseSales) (int, error) {
+	now := time.Now()
+	purchases := make([]InboxPurchase, 0, len(sales))
+	for _, sale := range sales {
+		purchases = append(purchases, InboxPurchase{
+			Tin:        tin,
+			BhfId:      bhfId,
+			Sale:       sale,
+			Status:     PurchasePending,
+			ReceivedAt: now,
+			UpdatedAt:  now,
+		})
+	}
+	return in.purchases.add(purchases)
+}
+
+// Accept marks an invoice as matching goods received, to be declared as a
+// purchase.
+func (in *PurchaseInbox) Accept(ctx context.Context, key PurchaseKey, note string) error {
+	return in.review(key, PurchaseAccepted, note)
+}
+
+// Reject marks an invoice as not received, to be declared as canceled.
+func (in *PurchaseInbox) Reject(ctx context.Context, key PurchaseKey, note string) error {
+	return in.review(key, PurchaseRejected, note)
+}
+
+// Reopen returns an invoice whose declaration was refused by the VSCU to
+// pending, with the reason as its note.
+func (in *PurchaseInbox) Reopen(ctx context.Context, key PurchaseKey, reason string) error {
+	return in.review(key, PurchasePending, reason)
+}
+
+func (in *PurchaseInbox) review(key PurchaseKey, status, note string) error {
+	return in.purchases.update(key, func(p *InboxPurchase) error {
+		if p.Status == PurchaseDeclared {
+			return fmt.Errorf("%w: %s", ErrPurchaseDeclared, key)
+		}
+		if status != PurchasePending {
+			p.Reviews++
+		}
+		p.Status, p.Note = status, note
+		return nil
+	})
+}
+
+// MarkDeclared records that the invoice was declared as pchsInvcNo with
+// progress pchsSttsCd.
+func (in *PurchaseInbox) MarkDeclared(ctx context.Context, key PurchaseKey, pchsSttsCd string, pchsInvcNo int64) error {
+	return in.purchases.update(key, func(p *InboxPurchase) error {
+		p.Status = PurchaseDeclared
+		p.PchsSttsCd, p.PchsInvcNo = pchsSttsCd, pchsInvcNo
+		return nil
+	})
+}
+
+// Purchase returns a supplier invoice of the inbox.
+func (in *PurchaseInbox) Purchase(key PurchaseKey) (InboxPurchase, bool) {
+	return in.purchases.get(key)
+}
+
+// Covering returns the supplier invoice of the branch that a stock movement
+// from another taxpayer delivered the goods of: the oldest invoice of the
+// sending branch listing the same items in the same quantities.
+func (in *PurchaseInbox) Covering(tin, bhfId string, move StockMove) (InboxPurchase, bool) {
+	moved := make(map[string]Decimal)
+	for _, item := range move.ItemList {
+		moved[item.ItemCd] = moved[item.ItemCd].Add(item.Qty)
+	}
+	for _, p := range in.List(tin, bhfId) {
+		if p.Sale.SpplrTin != move.CustTin || p.Sale.SpplrBhfId != move.CustBhfId {
+			continue
+		}
+		invoiced := make(map[string]Decimal)
+		for _, item := range p.Sale.ItemList {
+			invoiced[item.ItemCd] = invoiced[item.ItemCd].Add(item.Qty)
+		}
+		if maps.Equal(invoiced, moved) {
+			return p, true
+		}
+	}
+	return InboxPurchase{}, false
+}
+
+// List returns the supplier invoices of the branch with the given
+// statuses, or all of them if none are given, oldest first.
+func (in *PurchaseInbox) List(tin, bhfId string, statuses ...string) []InboxPurchase {
+	return in.purchases.list(tin, bhfId, statuses...)
+}
@@ -0,0 +1,138 @@
+package etims
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// inboxEntry is a document received by one branch that waits in an inbox
+// for review, such as an InboxPurchase or an InboxStockMove.
+type inboxEntry interface {
+	inboxKey() string
+	branch() (tin, bhfId string)
+	status() string
+	receivedAt() time.Time
+	touch(now time.Time)
+}
+
+// inbox is the store under PurchaseInbox and StockMoveInbox: the entries
+// of every branch by key, persisted as a JSON file. P is *E.
+type inbox[E any, P interface {
+	*E
+	inboxEntry
+}] struct {
+	file jsonFile
+	// unknown is returned, wrapped, for a key not in the inbox.
+	unknown error
+
+	mu      sync.Mutex
+	entries map[string]*E
+}
+
+// openInbox opens the inbox persisted at path, creating it on first write.
+func openInbox[E any, P interface {
+	*E
+	inboxEntry
+}](path, name string, unknown error) (*inbox[E, P], error) {
+	in := &inbox[E, P]{
+		file:    jsonFile{path: path, name: name},
+		unknown: unknown,
+		entries: make(map[string]*E),
+	}
+	if err := in.file.load(&in.entries); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// add stores the entries that are not in the inbox yet and returns how
+// many there were. Entries already in it are left as they are.
+func (in *inbox[E, P]) add(entries []E) (int, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	var added []string
+	for i := range entries {
+		e := &entries[i]
+		key := P(e).inboxKey()
+		if _, ok := in.entries[key]; ok {
+			continue
+		}
+		in.entries[key] = e
+		added = append(added, key)
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+	if err := in.file.write(in.entries); err != nil {
+		for _, key := range added {
+			delete(in.entries, key)
+		}
+		return 0, err
+	}
+	return len(added), nil
+}
+
+// update applies change to entry key and persists the inbox, leaving the
+// entry unchanged if either fails.
+func (in *inbox[E, P]) update(key fmt.Stringer, change func(P) error) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	e, ok := in.entries[key.String()]
+	if !ok {
+		return fmt.Errorf("%w: %s", in.unknown, key)
+	}
+	previous := *e
+	if err := change(P(e)); err != nil {
+		return err
+	}
+	P(e).touch(time.Now())
+	if err := in.file.write(in.entries); err != nil {
+		*e = previous
+		return err
+	}
+	return nil
+}
+
+// get returns entry key.
+func (in *inbox[E, P]) get(key fmt.Stringer) (E, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	e, ok := in.entries[key.String()]
+	if !ok {
+		var zero E
+		return zero, false
+	}
+	return *e, true
+}
+
+// list returns the entries of the branch with the given statuses, or all
+// of them if none are given, oldest first.
+func (in *inbox[E, P]) list(tin, bhfId string, statuses ...string) []E {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	var list []E
+	for _, e := range in.entries {
+		if t, b := P(e).branch(); t != tin || b != bhfId {
+			continue
+		}
+		if len(statuses) > 0 && !slices.Contains(statuses, P(e).status()) {
+			continue
+		}
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := P(&list[i]), P(&list[j])
+		if !a.receivedAt().Equal(b.receivedAt()) {
+			return a.receivedAt().Before(b.receivedAt())
+		}
+		return a.inboxKey() < b.inboxKey()
+	})
+	return list
+}
@@ -0,0 +1,243 @@
+package etims
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ItemClassNode is one classification in an ItemClassTree.
+type ItemClassNode struct {
+	ItemCls
+	// Parent is the itemClsCd of the closest broader classification, or ""
+	// for a top-level classification.
+	Parent   string
+	Children []string
+
+	tokens []string
+}
+
+// ItemClassTree is a local cache of the item classifications downloaded
+// from /itemClass/selectItemsClass. Classifications form a hierarchy by
+// code prefix: "50221108" (level 4) is the parent of "5022110801" (level 5).
+type ItemClassTree struct {
+	file jsonFile
+
+	mu    sync.RWMutex
+	nodes map[string]*ItemClassNode
+}
+
+// NewItemClassTree opens the tree persisted at path, creating it on first
+// Save.
+func NewItemClassTree(path string) (*ItemClassTree, error) {
+	t := &ItemClassTree{
+		file:  jsonFile{path: path, name: "item classifications"},
+		nodes: make(map[string]*ItemClassNode),
+	}
+
+	var classes []ItemCls
+	if err := t.file.load(&classes); err != nil {
+		return nil, err
+	}
+	t.merge(classes)
+	return t, nil
+}
+
+// Save merges an incremental /itemClass/selectItemsClass download into the
+// tree and persists it. It has the SaveFunc signature so it can be handed to
+// Syncer.SyncItemClasses directly.
+func (t *ItemClassTree) Save(ctx context.Context, data *ItemClsRes) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.merge(data.ItemClsList)
+
+	classes := make([]ItemCls, 0, len(t.nodes))
+	for _, n := range t.nodes {
+		classes = append(classes, n.ItemCls)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].ItemClsCd < classes[j].ItemClsCd })
+
+	return t.file.write(classes)
+}
+
+// merge applies classes and relinks the hierarchy.
+func (t *ItemClassTree) merge(classes []ItemCls) {
+	for _, cls := range classes {
+		t.nodes[cls.ItemClsCd] = &ItemClassNode{ItemCls: cls, tokens: tokenize(cls.ItemClsNm)}
+	}
+
+	for _, n := range t.nodes {
+		n.Parent = ""
+		n.Children = nil
+	}
+	for code, n := range t.nodes {
+		for i := len(code) - 1; i > 0; i-- {
+			if p, ok := t.nodes[code[:i]]; ok && p.ItemClsLvl < n.ItemClsLvl {
+				n.Parent = p.ItemClsCd
+				p.Children = append(p.Children, code)
+				break
+			}
+		}
+	}
+	for _, n := range t.nodes {
+		sort.Strings(n.Children)
+	}
+}
+
+// Lookup returns the active classification with code itemClsCd.
+func (t *ItemClassTree) Lookup(itemClsCd string) (ItemClassNode, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n, ok := t.nodes[itemClsCd]
+	if !ok || n.UseYn == "N" {
+		return ItemClassNode{}, false
+	}
+	return *n, true
+}
+
+// Ancestors returns the broader classifications of itemClsCd, top level
+// first.
+func (t *ItemClassTree) Ancestors(itemClsCd string) []ItemCls {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var path []ItemCls
+	n, ok := t.nodes[itemClsCd]
+	for ok && n.Parent != "" {
+		n = t.nodes[n.Parent]
+		path = append([]ItemCls{n.ItemCls}, path...)
+	}
+	return path
+}
+
+// Children returns the active classifications directly below itemClsCd, or
+// the top-level classifications if itemClsCd is "".
+func (t *ItemClassTree) Children(itemClsCd string) []ItemCls {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var codes []string
+	if itemClsCd == "" {
+		for code, n := range t.nodes {
+			if n.Parent == "" {
+				codes = append(codes, code)
+			}
+		}
+		sort.Strings(codes)
+	} else if n, ok := t.nodes[itemClsCd]; ok {
+		codes = n.Children
+	}
+	return t.active(codes)
+}
+
+// DefaultTaxType returns the taxTyCd of itemClsCd, inherited from the
+// closest broader classification that has one.
+func (t *ItemClassTree) DefaultTaxType(itemClsCd string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for n, ok := t.nodes[itemClsCd]; ok; n, ok = t.nodes[n.Parent] {
+		if n.TaxTyCd != "" {
+			return n.TaxTyCd
+		}
+	}
+	return ""
+}
+
+// SearchPrefix returns the active classifications whose code starts with
+// prefix, in code order.
+func (t *ItemClassTree) SearchPrefix(prefix string, limit int) []ItemCls {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var codes []string
+	for code := range t.nodes {
+		if strings.HasPrefix(code, prefix) {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return truncate(t.active(codes), limit)
+}
+
+// Search returns the active classifications whose name contains a word
+// starting with each word of query, e.g. "net cab" finds "Network cables".
+// Frequently used classifications (mjrTgYn = Y) rank first, then the most
+// specific ones.
+func (t *ItemClassTree) Search(query string, limit int) []ItemCls {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var matches []*ItemClassNode
+	for _, n := range t.nodes {
+		if n.UseYn != "N" && matchesAll(n.tokens, terms) {
+			matches = append(matches, n)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if (a.MjrTgYn == "Y") != (b.MjrTgYn == "Y") {
+			return a.MjrTgYn == "Y"
+		}
+		if a.ItemClsLvl != b.ItemClsLvl {
+			return a.ItemClsLvl > b.ItemClsLvl
+		}
+		return a.ItemClsCd < b.ItemClsCd
+	})
+
+	classes := make([]ItemCls, len(matches))
+	for i, n := range matches {
+		classes[i] = n.ItemCls
+	}
+	return truncate(classes, limit)
+}
+
+func (t *ItemClassTree) active(codes []string) []ItemCls {
+	var classes []ItemCls
+	for _, code := range codes {
+		if n := t.nodes[code]; n.UseYn != "N" {
+			classes = append(classes, n.ItemCls)
+		}
+	}
+	return classes
+}
+
+// truncate caps classes at limit entries; a limit of 0 or less means no
+// limit.
+func truncate(classes []ItemCls, limit int) []ItemCls {
+	if limit > 0 && len(classes) > limit {
+		return classes[:limit]
+	}
+	return classes
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func matchesAll(tokens, terms []string) bool {
+	for _, term := range terms {
+		found := false
+		for _, token := range tokens {
+			if strings.HasPrefix(token, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
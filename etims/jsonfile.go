@@ -0,0 +1,50 @@
+package etims
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// jsonFile is the state of a store persisted as one JSON file, rewritten
+// whole on every change.
+type jsonFile struct {
+	path string
+	// name describes the store in errors, e.g. "stock ledger".
+	name string
+	// perm is the mode of the file, 0o644 if zero.
+	perm os.FileMode
+}
+
+// load decodes the file into v, leaving v as it is if the file does not
+// exist yet.
+func (f jsonFile) load(v any) error {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", f.name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s %s: %w", f.name, f.path, err)
+	}
+	return nil
+}
+
+// write replaces the file with v.
+func (f jsonFile) write(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", f.name, err)
+	}
+	perm := f.perm
+	if perm == 0 {
+		perm = 0o644
+	}
+	if err := writeFileAtomic(f.path, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package etims
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StockEntry is one line of a stock movement posted to the ledger.
+type StockEntry struct {
+	SarNo   int64  `json:"sarNo"`
+	SarTyCd string `json:"sarTyCd"`
+	ItemSeq int    `json:"itemSeq"`
+	// Qty is positive for stock in and negative for stock out.
+	Qty      Decimal   `json:"qty"`
+	OcrnDt   string    `json:"ocrnDt"`
+	PostedAt time.Time `json:"postedAt"`
+}
+
+// StockItemLedger is the stock of one item at one branch.
+type StockItemLedger struct {
+	Tin    string `json:"tin"`
+	BhfId  string `json:"bhfId"`
+	ItemCd string `json:"itemCd"`
+	// RsdQty is the remaining quantity, the sum of the entries.
+	RsdQty  Decimal      `json:"rsdQty"`
+	Entries []StockEntry `json:"entries"`
+}
+
+// StockLedger is a perpetual inventory of every item of every branch,
+// persisted as a JSON file. It is kept from the stock movements accepted by
+// the VSCU, so the remaining quantities reported with saveStockMaster
+// follow the declared movements.
+type StockLedger struct {
+	file jsonFile
+
+	mu     sync.Mutex
+	items  map[string]*StockItemLedger
+	posted map[string]bool
+}
+
+// NewStockLedger opens the ledger at path, creating it on first Post.
+func NewStockLedger(path string) (*StockLedger, error) {
+	l := &StockLedger{
+		file:   jsonFile{path: path, name: "stock ledger"},
+		items:  make(map[string]*StockItemLedger),
+		posted: make(map[string]bool),
+	}
+	if err := l.file.load(&l.items); err != nil {
+		return nil, err
+	}
+	for _, item := range l.items {
+		for _, e := range item.Entries {
+			l.posted[movementKey(item.Tin, item.BhfId, e.SarNo)] = true
+		}
+	}
+	return l, nil
+}
+
+func stockItemKey(tin, bhfId, itemCd string) string {
+	return branchKey(tin, bhfId) + "/" + itemCd
+}
+
+func movementKey(tin, bhfId string, sarNo int64) string {
+	return branchKey(tin, bhfId) + "/" + strconv.FormatInt(sarNo, 10)
+}
+
+// Post records an accepted stock movement. Posting a sarNo of the branch
+// again changes nothing, so a movement delivered twice is counted once.
+func (l *StockLedger) Post(ctx context.Context, req StockIOSaveReq) error {
+	out := IsStockOut(req.SarTyCd)
+	if !out && !IsStockIn(req.SarTyCd) {
+		return fmt.Errorf("etims: sarTyCd %q is not a stock in/out type", req.SarTyCd)
+	}
+	for _, item := range req.ItemList {
+		if item.ItemCd == "" {
+			return fmt.Errorf("etims: item %d of stock movement %d has no itemCd", item.ItemSeq, req.SarNo)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	mk := movementKey(req.Tin, req.BhfId, req.SarNo)
+	if l.posted[mk] {
+		return nil
+	}
+
+	previous := make(map[string]*StockItemLedger)
+	now := time.Now()
+	for _, item := range req.ItemList {
+		key := stockItemKey(req.Tin, req.BhfId, item.ItemCd)
+		s, ok := l.items[key]
+		if _, saved := previous[key]; !saved {
+			if ok {
+				old := *s
+				previous[key] = &old
+			} else {
+				previous[key] = nil
+			}
+		}
+		if !ok {
+			s = &StockItemLedger{Tin: req.Tin, BhfId: req.BhfId, ItemCd: item.ItemCd}
+			l.items[key] = s
+		}
+		qty := item.Qty
+		if out {
+			qty = qty.Neg()
+		}
+		s.RsdQty = s.RsdQty.Add(qty)
+		s.Entries = append(s.Entries[:len(s.Entries):len(s.Entries)], StockEntry{
+			SarNo:    req.SarNo,
+			SarTyCd:  req.SarTyCd,
+			ItemSeq:  item.ItemSeq,
+			Qty:      qty,
+			OcrnDt:   req.OcrnDt,
+			PostedAt: now,
+		})
+	}
+	l.posted[mk] = true
+
+	if err := l.file.write(l.items); err != nil {
+		for key, old := range previous {
+			if old == nil {
+				delete(l.items, key)
+			} else {
+				l.items[key] = old
+			}
+		}
+		delete(l.posted, mk)
+		return err
+	}
+	return nil
+}
+
+// Item returns the stock of an item of the branch.
+func (l *StockLedger) Item(tin, bhfId, itemCd string) (StockItemLedger, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.items[stockItemKey(tin, bhfId, itemCd)]
+	if !ok {
+		return StockItemLedger{}, false
+	}
+	return *s, true
+}
+
+// RsdQty returns the remaining quantity of an item of the branch.
+func (l *StockLedger) RsdQty(tin, bhfId, itemCd string) Decimal {
+	s, _ := l.Item(tin, bhfId, itemCd)
+	return s.RsdQty
+}
+
+// StockMaster returns the saveStockMaster requests reporting the remaining
+// quantity of every item moved by req, in the order they appear in it.
+func (l *StockLedger) StockMaster(req StockIOSaveReq) []StockMasterRequest {
+	var reqs []StockMasterRequest
+	seen := make(map[string]bool)
+	for _, item := range req.ItemList {
+		if seen[item.ItemCd] {
+			continue
+		}
+		seen[item.ItemCd] = true
+		reqs = append(reqs, StockMasterRequest{
+			Tin:    req.Tin,
+			BhfId:  req.BhfId,
+			ItemCd: item.ItemCd,
+			RsdQty: l.RsdQty(req.Tin, req.BhfId, item.ItemCd),
+			RegrId: req.RegrId,
+			RegrNm: req.RegrNm,
+			ModrId: req.ModrId,
+			ModrNm: req.ModrNm,
+		})
+	}
+	return reqs
+}
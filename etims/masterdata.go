@@ -0,0 +1,188 @@
+package etims
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MasterData keeps the notices, branches, items and import items retrieved
+// by the incremental syncs, persisted as a JSON file. Each sync only
+// returns what changed since its watermark, so what it returns must be
+// stored before the watermark moves on or it is never seen again.
+type MasterData struct {
+	file jsonFile
+
+	mu   sync.Mutex
+	data masterData
+}
+
+type masterData struct {
+	Notices     map[string]Notice     `json:"notices"`
+	Branches    map[string]Bhf        `json:"branches"`
+	Items       map[string]Item       `json:"items"`
+	ImportItems map[string]ImportItem `json:"importItems"`
+}
+
+// NewMasterData opens the store at path, creating it on first save.
+func NewMasterData(path string) (*MasterData, error) {
+	m := &MasterData{file: jsonFile{path: path, name: "master data"}}
+	if err := m.file.load(&m.data); err != nil {
+		return nil, err
+	}
+	if m.data.Notices == nil {
+		m.data.Notices = make(map[string]Notice)
+	}
+	if m.data.Branches == nil {
+		m.data.Branches = make(map[string]Bhf)
+	}
+	if m.data.Items == nil {
+		m.data.Items = make(map[string]Item)
+	}
+	if m.data.ImportItems == nil {
+		m.data.ImportItems = make(map[string]ImportItem)
+	}
+	return m, nil
+}
+
+// SaveNotices stores the notices of a notice sync.
+func (m *MasterData) SaveNotices(ctx context.Context, data *NoticeRes) error {
+	return save(m, m.data.Notices, data.NoticeList, func(n Notice) string {
+		return strconv.FormatInt(n.NoticeNo, 10)
+	})
+}
+
+// SaveBranches stores the branches of a branch sync.
+func (m *MasterData) SaveBranches(ctx context.Context, data *BhfRes) error {
+	return save(m, m.data.Branches, data.BhfList, func(b Bhf) string {
+		return branchKey(b.Tin, b.BhfId)
+	})
+}
+
+// SaveItems stores the items of an item sync.
+func (m *MasterData) SaveItems(ctx context.Context, data *ItemRes) error {
+	return save(m, m.data.Items, data.ItemList, func(i Item) string {
+		return i.Tin + "/" + i.ItemCd
+	})
+}
+
+// SaveImportItems stores the import items of branch bhfId of taxpayer tin
+// returned by an import item sync.
+func (m *MasterData) SaveImportItems(ctx context.Context, tin, bhfId string, data *ImptItemRes) error {
+	return save(m, m.data.ImportItems, data.ItemList, func(i ImportItem) string {
+		return importItemKey(tin, bhfId, i)
+	})
+}
+
+func importItemKey(tin, bhfId string, i ImportItem) string {
+	return branchKey(tin, bhfId) + "/" + i.TaskCd + "/" + i.DclDe + "/" + strconv.Itoa(i.ItemSeq)
+}
+
+// save replaces the records of list in records, keyed by key, and writes
+// the store, leaving records as it was if the write fails.
+func save[V any](m *MasterData, records map[string]V, list []V, key func(V) string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type previous struct {
+		v  V
+		ok bool
+	}
+	saved := make(map[string]previous)
+	for _, v := range list {
+		k := key(v)
+		if _, seen := saved[k]; !seen {
+			old, ok := records[k]
+			saved[k] = previous{old, ok}
+		}
+		records[k] = v
+	}
+	if len(saved) == 0 {
+		return nil
+	}
+	if err := m.file.write(m.data); err != nil {
+		for k, p := range saved {
+			if p.ok {
+				records[k] = p.v
+			} else {
+				delete(records, k)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Notices returns the stored notices by number.
+func (m *MasterData) Notices() []Notice {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	notices := make([]Notice, 0, len(m.data.Notices))
+	for _, n := range m.data.Notices {
+		notices = append(notices, n)
+	}
+	sort.Slice(notices, func(i, j int) bool { return notices[i].NoticeNo < notices[j].NoticeNo })
+	return notices
+}
+
+// Branches returns the stored branches of taxpayer tin by bhfId.
+func (m *MasterData) Branches(tin string) []Bhf {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var branches []Bhf
+	for _, b := range m.data.Branches {
+		if b.Tin == tin {
+			branches = append(branches, b)
+		}
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].BhfId < branches[j].BhfId })
+	return branches
+}
+
+// Item returns a stored item of taxpayer tin.
+func (m *MasterData) Item(tin, itemCd string) (Item, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.data.Items[tin+"/"+itemCd]
+	return i, ok
+}
+
+// ImportItem returns item itemSeq of import declaration taskCd of dclDe
+// stored for the branch.
+func (m *MasterData) ImportItem(tin, bhfId, taskCd, dclDe string, itemSeq int) (ImportItem, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.data.ImportItems[importItemKey(tin, bhfId, ImportItem{TaskCd: taskCd, DclDe: dclDe, ItemSeq: itemSeq})]
+	return i, ok
+}
+
+// ImportItems returns the stored import items of the branch by
+// declaration and itemSeq.
+func (m *MasterData) ImportItems(tin, bhfId string) []ImportItem {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix := branchKey(tin, bhfId) + "/"
+	var items []ImportItem
+	for k, i := range m.data.ImportItems {
+		if strings.HasPrefix(k, prefix) {
+			items = append(items, i)
+		}
+	}
+	sort.Slice(items, func(a, b int) bool {
+		if items[a].DclDe != items[b].DclDe {
+			return items[a].DclDe < items[b].DclDe
+		}
+		if items[a].TaskCd != items[b].TaskCd {
+			return items[a].TaskCd < items[b].TaskCd
+		}
+		return items[a].ItemSeq < items[b].ItemSeq
+	})
+	return items
+}
@@ -0,0 +1,524 @@
+package etims
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OfflineLimit is how long the VSCU keeps issuing receipt numbers without
+// reaching the eTIMS server (spec section 2.2).
+const OfflineLimit = 24 * time.Hour
+
+// OutboxEntry is a declaration waiting to be sent to the VSCU.
+type OutboxEntry struct {
+	Seq        uint64          `json:"seq"`
+	Tin        string          `json:"tin"`
+	BhfId      string          `json:"bhfId"`
+	Path       string          `json:"path"`
+	Payload    json.RawMessage `json:"payload"`
+	EnqueuedAt time.Time       `json:"enqueuedAt"`
+}
+
+// RejectedEntry is an outbox entry the VSCU refused. It is taken off the
+// queue so later declarations of the branch are not held up, and kept until
+// an operator resubmits it once the cause is fixed (e.g. the item is
+// registered) or discards it.
+type RejectedEntry struct {
+	OutboxEntry
+	ResultCd   string    `json:"resultCd"`
+	ResultMsg  string    `json:"resultMsg"`
+	RejectedAt time.Time `json:"rejectedAt"`
+}
+
+// OutboxStatus is the backlog of one branch.
+type OutboxStatus struct {
+	Tin     string
+	BhfId   string
+	Pending int
+	// Oldest is when the oldest pending entry was queued, which is when the
+	// branch lost contact with the VSCU.
+	Oldest time.Time
+}
+
+// Deadline is when the branch reaches OfflineLimit.
+func (s OutboxStatus) Deadline() time.Time {
+	return s.Oldest.Add(OfflineLimit)
+}
+
+// Remaining returns the time left before the branch reaches OfflineLimit,
+// or a negative duration once it has.
+func (s OutboxStatus) Remaining(now time.Time) time.Duration {
+	return s.Deadline().Sub(now)
+}
+
+// Outbox ops recorded in the write-ahead log.
+const (
+	outboxEnqueue = "enqueue"
+	outboxAck     = "ack"
+	outboxReject  = "reject"
+	// outboxResubmit takes rejected entry Seq back onto the queue as Entry.
+	outboxResubmit = "resubmit"
+	// outboxDiscard drops rejected entry Seq.
+	outboxDiscard = "discard"
+)
+
+// ErrUnknownRejected is returned when a sequence number is not among the
+// rejected entries of the outbox.
+var ErrUnknownRejected = errors.New("etims: no rejected outbox entry")
+
+type outboxRecord struct {
+	Op       string         `json:"op"`
+	Entry    *OutboxEntry   `json:"entry,omitempty"`
+	Rejected *RejectedEntry `json:"rejected,omitempty"`
+	Seq      uint64         `json:"seq,omitempty"`
+}
+
+// Outbox is a durable store-and-forward queue for declarations made while
+// the VSCU is unreachable. Every change is appended to a write-ahead log
+// and synced before it takes effect, so a queued sale survives a crash.
+// Entries are sent per branch in the order they were queued.
+type Outbox struct {
+	path string
+
+	drainMu sync.Mutex
+
+	mu sync.Mutex
+	f  *os.File
+	// size is the length of the log up to the end of its last complete
+	// record, which a failed append is truncated back to.
+	size     int64
+	seq      uint64
+	pending  map[string][]OutboxEntry
+	rejected []RejectedEntry
+}
+
+// OpenOutbox opens the outbox log at path, replaying and compacting it. A
+// record torn by a crash during append is discarded.
+func OpenOutbox(path string) (*Outbox, error) {
+	o := &Outbox{
+		path:    path,
+		pending: make(map[string][]OutboxEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	if err := o.replay(data); err != nil {
+		return nil, fmt.Errorf("failed to replay outbox %s: %w", path, err)
+	}
+
+	snapshot := o.snapshot()
+	if err := writeFileAtomic(path, snapshot, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to compact outbox: %w", err)
+	}
+	o.size = int64(len(snapshot))
+	o.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox: %w", err)
+	}
+	return o, nil
+}
+
+// Close closes the outbox log.
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.f.Close()
+}
+
+func (o *Outbox) replay(data []byte) error {
+	lines := bytes.Split(data, []byte("\n"))
+	// The last element is empty unless the final append was torn.
+	for _, line := range lines[:len(lines)-1] {
+		if len(line) == 0 {
+			continue
+		}
+		var rec outboxRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return err
+		}
+		o.apply(rec)
+	}
+	return nil
+}
+
+func (o *Outbox) apply(rec outboxRecord) {
+	switch rec.Op {
+	case outboxEnqueue:
+		o.insert(*rec.Entry)
+	case outboxAck:
+		o.remove(rec.Seq)
+	case outboxReject:
+		o.remove(rec.Rejected.Seq)
+		o.rejected = append(o.rejected, *rec.Rejected)
+		if rec.Rejected.Seq > o.seq {
+			o.seq = rec.Rejected.Seq
+		}
+	case outboxResubmit:
+		o.removeRejected(rec.Seq)
+		o.insert(*rec.Entry)
+	case outboxDiscard:
+		o.removeRejected(rec.Seq)
+	}
+}
+
+// insert adds entry to its branch's queue in sequence order.
+func (o *Outbox) insert(entry OutboxEntry) {
+	key := branchKey(entry.Tin, entry.BhfId)
+	entries := o.pending[key]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Seq > entry.Seq })
+	o.pending[key] = slices.Insert(entries, i, entry)
+	if entry.Seq > o.seq {
+		o.seq = entry.Seq
+	}
+}
+
+func (o *Outbox) removeRejected(seq uint64) {
+	for i, r := range o.rejected {
+		if r.Seq == seq {
+			o.rejected = append(o.rejected[:i:i], o.rejected[i+1:]...)
+			return
+		}
+	}
+}
+
+// rejectedEntry returns rejected entry seq. o.mu must be held.
+func (o *Outbox) rejectedEntry(seq uint64) (RejectedEntry, error) {
+	for _, r := range o.rejected {
+		if r.Seq == seq {
+			return r, nil
+		}
+	}
+	return RejectedEntry{}, fmt.Errorf("%w %d", ErrUnknownRejected, seq)
+}
+
+func (o *Outbox) remove(seq uint64) {
+	for key, entries := range o.pending {
+		for i, e := range entries {
+			if e.Seq != seq {
+				continue
+			}
+			entries = append(entries[:i:i], entries[i+1:]...)
+			if len(entries) == 0 {
+				delete(o.pending, key)
+			} else {
+				o.pending[key] = entries
+			}
+			return
+		}
+	}
+}
+
+// snapshot encodes the current state as a minimal log.
+func (o *Outbox) snapshot() []byte {
+	var recs []outboxRecord
+	for i := range o.rejected {
+		recs = append(recs, outboxRecord{Op: outboxReject, Rejected: &o.rejected[i]})
+	}
+	for _, entries := range o.pending {
+		for i := range entries {
+			recs = append(recs, outboxRecord{Op: outboxEnqueue, Entry: &entries[i]})
+		}
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].seq() < recs[j].seq() })
+
+	var buf bytes.Buffer
+	for _, rec := range recs {
+		line, _ := json.Marshal(rec)
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func (r outboxRecord) seq() uint64 {
+	if r.Entry != nil {
+		return r.Entry.Seq
+	}
+	if r.Rejected != nil {
+		return r.Rejected.Seq
+	}
+	return r.Seq
+}
+
+// append writes rec to the log and applies it once it is on disk. If the
+// write or sync fails, the log is truncated back to its last complete
+// record, so a partly written one does not stop it from being replayed.
+// o.mu must be held.
+func (o *Outbox) append(rec outboxRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox record: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := o.f.Write(line); err != nil {
+		return o.truncate(fmt.Errorf("failed to write outbox: %w", err))
+	}
+	if err := o.f.Sync(); err != nil {
+		return o.truncate(fmt.Errorf("failed to sync outbox: %w", err))
+	}
+	o.size += int64(len(line))
+	o.apply(rec)
+	return nil
+}
+
+// truncate cuts the log back to o.size after a failed append and returns
+// err, joined with the truncation's own error if it failed too.
+func (o *Outbox) truncate(err error) error {
+	if terr := o.f.Truncate(o.size); terr != nil {
+		return errors.Join(err, fmt.Errorf("failed to truncate outbox: %w", terr))
+	}
+	return err
+}
+
+// Enqueue queues payload for path on behalf of the branch and returns its
+// sequence number.
+func (o *Outbox) Enqueue(ctx context.Context, tin, bhfId, path string, payload interface{}) (uint64, error) {
+	if tin == "" || bhfId == "" {
+		return 0, errors.New("etims: outbox entry needs tin and bhfId")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal %s request: %w", path, err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry := OutboxEntry{
+		Seq:        o.seq + 1,
+		Tin:        tin,
+		BhfId:      bhfId,
+		Path:       path,
+		Payload:    data,
+		EnqueuedAt: time.Now(),
+	}
+	if err := o.append(outboxRecord{Op: outboxEnqueue, Entry: &entry}); err != nil {
+		return 0, err
+	}
+	return entry.Seq, nil
+}
+
+// EnqueueSales queues a sales declaration.
+func (o *Outbox) EnqueueSales(ctx context.Context, req TrnsSalesSaveWrReq) (uint64, error) {
+	return o.Enqueue(ctx, req.Tin, req.BhfId, PathSaveSales, req)
+}
+
+// EnqueuePurchase queues a purchase declaration.
+func (o *Outbox) EnqueuePurchase(ctx context.Context, req TrnsPurchaseSaveReq) (uint64, error) {
+	return o.Enqueue(ctx, req.Tin, req.BhfId, PathSavePurchases, req)
+}
+
+// EnqueueStockItems queues a stock in/out declaration.
+func (o *Outbox) EnqueueStockItems(ctx context.Context, req StockIOSaveReq) (uint64, error) {
+	return o.Enqueue(ctx, req.Tin, req.BhfId, PathSaveStockItems, req)
+}
+
+// EnqueueStockMaster queues a remaining quantity report.
+func (o *Outbox) EnqueueStockMaster(ctx context.Context, req StockMasterRequest) (uint64, error) {
+	return o.Enqueue(ctx, req.Tin, req.BhfId, PathSaveStockMaster, req)
+}
+
+// Drain sends the pending entries of the client's branch in order and
+// returns how many were delivered. An entry the VSCU already holds (994)
+// counts as delivered, and one it refuses as invalid is moved to Rejected.
+// On any other failure (the VSCU unreachable, a retryable, device, server
+// or unknown result code) it stops, leaving the entry and everything after
+// it queued, since sending it again later may well succeed.
+//
+// If settled is not nil it is called for every entry taken off the queue,
+// with a nil error if it was delivered and the *ResultError if it was
+// rejected, so callers can update their own records. For a sale the VSCU
+// accepted it is also given the receipt data (rcptSign, intrlData, sdcId
+// and so on); that is nil for other entries, and for a sale the VSCU
+// already held, as it does not send the receipt again.
+func (o *Outbox) Drain(ctx context.Context, c *Client, settled func(OutboxEntry, *TrnsSalesSaveRes, error)) (int, error) {
+	o.drainMu.Lock()
+	defer o.drainMu.Unlock()
+
+	key := branchKey(c.tin, c.bhfId)
+	sent := 0
+	for {
+		entry, ok := o.head(key)
+		if !ok {
+			return sent, nil
+		}
+
+		var res Response[TrnsSalesSaveRes]
+		var out envelope = &res.Result
+		if entry.Path == PathSaveSales {
+			out = &res
+		}
+		err := c.Do(ctx, entry.Path, entry.Payload, out)
+		var re *ResultError
+		switch {
+		case err == nil, IsDuplicate(err):
+			if err := o.ack(entry.Seq); err != nil {
+				return sent, err
+			}
+			sent++
+			err = nil
+		case errors.As(err, &re) && re.Class() == ClassValidation:
+			if err := o.reject(entry, re); err != nil {
+				return sent, err
+			}
+		default:
+			return sent, err
+		}
+		if settled != nil {
+			settled(entry, res.Data, err)
+		}
+	}
+}
+
+func (o *Outbox) head(key string) (OutboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := o.pending[key]
+	if len(entries) == 0 {
+		return OutboxEntry{}, false
+	}
+	return entries[0], true
+}
+
+func (o *Outbox) ack(seq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.append(outboxRecord{Op: outboxAck, Seq: seq})
+}
+
+func (o *Outbox) reject(entry OutboxEntry, re *ResultError) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.append(outboxRecord{Op: outboxReject, Rejected: &RejectedEntry{
+		OutboxEntry: entry,
+		ResultCd:    re.ResultCd,
+		ResultMsg:   re.ResultMsg,
+		RejectedAt:  time.Now(),
+	}})
+}
+
+// Pending returns the queued entries of the branch in send order.
+func (o *Outbox) Pending(tin, bhfId string) []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]OutboxEntry(nil), o.pending[branchKey(tin, bhfId)]...)
+}
+
+// Queued reports whether the declaration for path numbered no (its invcNo,
+// or sarNo for a stock movement) waits in the outbox of the branch, or was
+// rejected from it and is kept for review.
+func (o *Outbox) Queued(tin, bhfId, path string, no int64) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := o.pending[branchKey(tin, bhfId)]
+	for _, r := range o.rejected {
+		if r.Tin == tin && r.BhfId == bhfId {
+			entries = append(entries[:len(entries):len(entries)], r.OutboxEntry)
+		}
+	}
+	for _, entry := range entries {
+		if entry.Path != path {
+			continue
+		}
+		var numbered struct {
+			InvcNo int64 `json:"invcNo"`
+			SarNo  int64 `json:"sarNo"`
+		}
+		if err := json.Unmarshal(entry.Payload, &numbered); err != nil {
+			continue
+		}
+		if path == PathSaveStockItems {
+			numbered.InvcNo = numbered.SarNo
+		}
+		if numbered.InvcNo == no {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejected returns the entries the VSCU refused while draining.
+func (o *Outbox) Rejected() []RejectedEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]RejectedEntry(nil), o.rejected...)
+}
+
+// Resubmit puts rejected entry seq back on its branch's queue, to be sent
+// on the next Drain. It keeps its sequence number, so it goes ahead of the
+// entries queued after it and is sent in the order it was made.
+func (o *Outbox) Resubmit(ctx context.Context, seq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	r, err := o.rejectedEntry(seq)
+	if err != nil {
+		return err
+	}
+	entry := r.OutboxEntry
+	entry.EnqueuedAt = time.Now()
+	return o.append(outboxRecord{Op: outboxResubmit, Seq: seq, Entry: &entry})
+}
+
+// Discard drops rejected entry seq for good and returns it, so the caller
+// can void the number it carried.
+func (o *Outbox) Discard(ctx context.Context, seq uint64) (RejectedEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	r, err := o.rejectedEntry(seq)
+	if err != nil {
+		return RejectedEntry{}, err
+	}
+	if err := o.append(outboxRecord{Op: outboxDiscard, Seq: seq}); err != nil {
+		return RejectedEntry{}, err
+	}
+	return r, nil
+}
+
+// Status returns the backlog of every branch with pending entries.
+func (o *Outbox) Status() []OutboxStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	statuses := make([]OutboxStatus, 0, len(o.pending))
+	for _, entries := range o.pending {
+		status := OutboxStatus{
+			Tin:     entries[0].Tin,
+			BhfId:   entries[0].BhfId,
+			Pending: len(entries),
+			Oldest:  entries[0].EnqueuedAt,
+		}
+		// A resubmitted entry goes back to its place in the queue but was
+		// queued again when it was resubmitted.
+		for _, e := range entries[1:] {
+			if e.EnqueuedAt.Before(status.Oldest) {
+				status.Oldest = e.EnqueuedAt
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Oldest.Before(statuses[j].Oldest) })
+	return statuses
+}
+
+func branchKey(tin, bhfId string) string {
+	return tin + "/" + bhfId
+}
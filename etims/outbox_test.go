@@ -0,0 +1,341 @@
+package etims
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testTin   = "P000000001A"
+	testBhfId = "00"
+)
+
+// outboxPayload is what the test entries carry: their position in the
+// queue, which the fake VSCU answers by.
+type outboxPayload struct {
+	N int `json:"n"`
+}
+
+// openTestOutbox opens an outbox at path and queues n entries.
+func openTestOutbox(t *testing.T, path string, n int) *Outbox {
+	t.Helper()
+	o, err := OpenOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= n; i++ {
+		if _, err := o.Enqueue(context.Background(), testTin, testBhfId, PathSaveStockMaster, outboxPayload{N: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o
+}
+
+// fakeVSCU answers the n-th entry with the HTTP status or result code in
+// answers, and with 000 if there is none. An accepted sale gets receipt
+// SIGN-n.
+func fakeVSCU(t *testing.T, answers map[int]string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var p outboxPayload
+		json.Unmarshal(body, &p)
+		answer, ok := answers[p.N]
+		if !ok {
+			answer = ResultSuccess
+		}
+		if answer == "500" {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		data := "null"
+		if r.URL.Path == PathSaveSales && answer == ResultSuccess {
+			data = fmt.Sprintf(`{"rcptNo":%d,"rcptSign":"SIGN-%d"}`, p.N, p.N)
+		}
+		fmt.Fprintf(w, `{"resultCd":%q,"resultMsg":"test","resultDt":"20240101000000","data":%s}`, answer, data)
+	}))
+	t.Cleanup(srv.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	c, err := New(
+		WithBaseURL(srv.URL),
+		WithTIN(testTin),
+		WithBranchID(testBhfId),
+		WithLogger(logger),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func entrySeqs(entries []OutboxEntry) []uint64 {
+	var seqs []uint64
+	for _, e := range entries {
+		seqs = append(seqs, e.Seq)
+	}
+	return seqs
+}
+
+func rejectedSeqs(entries []RejectedEntry) []uint64 {
+	var seqs []uint64
+	for _, e := range entries {
+		seqs = append(seqs, e.Seq)
+	}
+	return seqs
+}
+
+func TestOutboxDrain(t *testing.T) {
+	tests := []struct {
+		name      string
+		answers   map[int]string
+		sent      int
+		transport bool
+		wantErr   bool
+		settled   []uint64
+		pending   []uint64
+		rejected  []uint64
+	}{
+		{
+			name:    "all accepted",
+			sent:    3,
+			settled: []uint64{1, 2, 3},
+		},
+		{
+			name:    "duplicate counts as delivered",
+			answers: map[int]string{2: ResultOverlappedData},
+			sent:    3,
+			settled: []uint64{1, 2, 3},
+		},
+		{
+			name:     "invalid entry rejected",
+			answers:  map[int]string{2: ResultParameter},
+			sent:     2,
+			settled:  []uint64{1, 2, 3},
+			rejected: []uint64{2},
+		},
+		{
+			name:    "server failure stops",
+			answers: map[int]string{2: ResultRegistrationFailed},
+			sent:    1,
+			wantErr: true,
+			settled: []uint64{1},
+			pending: []uint64{2, 3},
+		},
+		{
+			name:    "device failure stops",
+			answers: map[int]string{1: ResultInvalidDevice},
+			wantErr: true,
+			pending: []uint64{1, 2, 3},
+		},
+		{
+			name:      "unreachable stops",
+			answers:   map[int]string{3: "500"},
+			sent:      2,
+			wantErr:   true,
+			transport: true,
+			settled:   []uint64{1, 2},
+			pending:   []uint64{3},
+		},
+	}
+	for _, tt := range tests {
+		o := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.log"), 3)
+		var settled []uint64
+		sent, err := o.Drain(context.Background(), fakeVSCU(t, tt.answers), func(e OutboxEntry, _ *TrnsSalesSaveRes, err error) {
+			settled = append(settled, e.Seq)
+		})
+		if sent != tt.sent || (err != nil) != tt.wantErr || IsTransport(err) != tt.transport {
+			t.Errorf("%s: Drain = %d, %v, want %d, error %v, transport %v", tt.name, sent, err, tt.sent, tt.wantErr, tt.transport)
+		}
+		if !slices.Equal(settled, tt.settled) {
+			t.Errorf("%s: settled %v, want %v", tt.name, settled, tt.settled)
+		}
+		if got := entrySeqs(o.Pending(testTin, testBhfId)); !slices.Equal(got, tt.pending) {
+			t.Errorf("%s: pending %v, want %v", tt.name, got, tt.pending)
+		}
+		if got := rejectedSeqs(o.Rejected()); !slices.Equal(got, tt.rejected) {
+			t.Errorf("%s: rejected %v, want %v", tt.name, got, tt.rejected)
+		}
+		o.Close()
+	}
+}
+
+func TestOutboxDrainReceipts(t *testing.T) {
+	ctx := context.Background()
+	o := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.log"), 0)
+	defer o.Close()
+	for i, path := range []string{PathSaveSales, PathSaveSales, PathSaveStockMaster} {
+		if _, err := o.Enqueue(ctx, testTin, testBhfId, path, outboxPayload{N: i + 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receipts := make(map[uint64]string)
+	_, err := o.Drain(ctx, fakeVSCU(t, map[int]string{2: ResultOverlappedData}), func(e OutboxEntry, receipt *TrnsSalesSaveRes, err error) {
+		if receipt != nil {
+			receipts[e.Seq] = receipt.RcptSign
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sale the VSCU already held and the stock master have none.
+	if len(receipts) != 1 || receipts[1] != "SIGN-1" {
+		t.Errorf("receipts %v, want only SIGN-1 for entry 1", receipts)
+	}
+}
+
+func TestOutboxReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		// tail is appended to the log before it is reopened.
+		tail    string
+		wantErr bool
+	}{
+		{name: "clean log"},
+		{name: "torn last line", tail: `{"op":"enqueue","entry":{"seq":5,"tin":"P0`},
+		{name: "torn ack", tail: `{"op":"ack","se`},
+		{name: "corrupt record", tail: "garbage\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "outbox.log")
+		o := openTestOutbox(t, path, 4)
+		if err := o.ack(1); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.reject(o.Pending(testTin, testBhfId)[0], &ResultError{ResultCd: ResultParameter, ResultMsg: "invalid"}); err != nil {
+			t.Fatal(err)
+		}
+		o.Close()
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(tt.tail)
+		f.Close()
+
+		o, err = OpenOutbox(path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: OpenOutbox succeeded, want error", tt.name)
+				o.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := entrySeqs(o.Pending(testTin, testBhfId)); !slices.Equal(got, []uint64{3, 4}) {
+			t.Errorf("%s: pending %v, want [3 4]", tt.name, got)
+		}
+		rejected := o.Rejected()
+		if got := rejectedSeqs(rejected); !slices.Equal(got, []uint64{2}) || rejected[0].ResultCd != ResultParameter {
+			t.Errorf("%s: rejected %+v, want entry 2 with result code %s", tt.name, rejected, ResultParameter)
+		}
+		// Numbers are not reused after a replay.
+		if seq, err := o.Enqueue(context.Background(), testTin, testBhfId, PathSaveStockMaster, outboxPayload{N: 5}); err != nil || seq != 5 {
+			t.Errorf("%s: Enqueue after replay = %d, %v, want 5", tt.name, seq, err)
+		}
+		o.Close()
+	}
+}
+
+func TestOutboxFailedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	o := openTestOutbox(t, path, 2)
+
+	// A write that fails halfway leaves part of a record in the log.
+	o.f.WriteString(`{"op":"enqueue","entry":{"seq":3,"tin":"P0`)
+	if err := o.truncate(errors.New("disk full")); err == nil {
+		t.Fatal("truncate lost the append's error")
+	}
+	if _, err := o.Enqueue(context.Background(), testTin, testBhfId, PathSaveStockMaster, outboxPayload{N: 3}); err != nil {
+		t.Fatal(err)
+	}
+	o.Close()
+
+	o, err := OpenOutbox(path)
+	if err != nil {
+		t.Fatalf("OpenOutbox after a failed append: %v", err)
+	}
+	defer o.Close()
+	if got := entrySeqs(o.Pending(testTin, testBhfId)); !slices.Equal(got, []uint64{1, 2, 3}) {
+		t.Errorf("pending %v, want [1 2 3]", got)
+	}
+}
+
+func TestOutboxResubmitDiscard(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       string // resubmit or discard
+		seq      uint64
+		wantErr  error
+		pending  []uint64
+		rejected []uint64
+	}{
+		{name: "resubmit", op: "resubmit", seq: 2, pending: []uint64{2, 3}},
+		{name: "discard", op: "discard", seq: 2, pending: []uint64{3}},
+		{name: "resubmit unknown", op: "resubmit", seq: 3, wantErr: ErrUnknownRejected, pending: []uint64{3}, rejected: []uint64{2}},
+		{name: "discard unknown", op: "discard", seq: 9, wantErr: ErrUnknownRejected, pending: []uint64{3}, rejected: []uint64{2}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "outbox.log")
+		o := openTestOutbox(t, path, 3)
+		if err := o.ack(1); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.reject(o.Pending(testTin, testBhfId)[0], &ResultError{ResultCd: ResultParameter}); err != nil {
+			t.Fatal(err)
+		}
+
+		var err error
+		switch tt.op {
+		case "resubmit":
+			err = o.Resubmit(context.Background(), tt.seq)
+		case "discard":
+			var r RejectedEntry
+			r, err = o.Discard(context.Background(), tt.seq)
+			if err == nil && r.Seq != tt.seq {
+				t.Errorf("%s: Discard returned entry %d, want %d", tt.name, r.Seq, tt.seq)
+			}
+		}
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		o.Close()
+
+		// The outcome survives a restart.
+		if o, err = OpenOutbox(path); err != nil {
+			t.Fatal(err)
+		}
+		pending := o.Pending(testTin, testBhfId)
+		if got := entrySeqs(pending); !slices.Equal(got, tt.pending) {
+			t.Errorf("%s: pending %v, want %v", tt.name, got, tt.pending)
+		}
+		if got := rejectedSeqs(o.Rejected()); !slices.Equal(got, tt.rejected) {
+			t.Errorf("%s: rejected %v, want %v", tt.name, got, tt.rejected)
+		}
+		if tt.op == "resubmit" && tt.wantErr == nil {
+			// It goes ahead of the entry queued after it.
+			var p outboxPayload
+			if err := json.Unmarshal(pending[0].Payload, &p); err != nil || p.N != 2 {
+				t.Errorf("%s: resubmitted payload %s, want that of entry 2", tt.name, pending[0].Payload)
+			}
+		}
+		o.Close()
+	}
+}
@@ -0,0 +1,218 @@
+package etims
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Transaction types (spec 4.8), the salesTyCd and pchsTyCd of sales and
+// purchases.
+const (
+	TransactionTypeCopy     = "C"
+	TransactionTypeNormal   = "N"
+	TransactionTypeProforma = "P"
+	TransactionTypeTraining = "T"
+)
+
+// Transaction progress codes (spec 4.11), the salesSttsCd and pchsSttsCd of
+// sales and purchases.
+const (
+	TransactionWaitForApproval     = "01"
+	TransactionApproved            = "02"
+	TransactionCreditNoteRequested = "03"
+	TransactionCanceled            = "04"
+	TransactionCreditNoteGenerated = "05"
+	TransactionTransferred         = "06"
+)
+
+// Purchase receipt types (spec 4.13).
+const (
+	PurchaseReceiptTypePurchase   = "P"
+	PurchaseReceiptTypeCreditNote = "R"
+)
+
+// Registration types (spec 4.12): whether a purchase was taken from the
+// supplier's declaration or entered by hand.
+const (
+	RegistrationAutomatic = "A"
+	RegistrationManual    = "M"
+)
+
+// SequencePurchase numbers purchase declarations (invcNo of
+// TrnsPurchaseSaveReq).
+const SequencePurchase = "pchsInvcNo"
+
+// PurchaseDeclaration converts sale, a supplier invoice fetched from
+// /trnsPurchase/selectTrnsPurchaseSales, into the declaration of the
+// purchase. pchsSttsCd is TransactionApproved to confirm the purchase and
+// TransactionCanceled to reject it.
+//
+// The supplier's item codes are kept as spplrItemCd and spplrItemNm; the
+// caller sets itemCd to its own code for the item, if it has one. The
+// declaration still needs its invcNo and registrant.
+func PurchaseDeclaration(sale TrnsPurchaseSales, pchsSttsCd string) TrnsPurchaseSaveReq {
+	rcptTyCd := PurchaseReceiptTypePurchase
+	if sale.RcptTyCd == ReceiptTypeCreditNote {
+		rcptTyCd = PurchaseReceiptTypeCreditNote
+	}
+	req := TrnsPurchaseSaveReq{
+		SpplrTin:    sale.SpplrTin,
+		SpplrBhfId:  sale.SpplrBhfId,
+		SpplrNm:     sale.SpplrNm,
+		SpplrInvcNo: sale.SpplrInvcNo,
+		SpplrSdcId:  sale.SpplrSdcId,
+		RegTyCd:     RegistrationAutomatic,
+		PchsTyCd:    TransactionTypeNormal,
+		RcptTyCd:    rcptTyCd,
+		PmtTyCd:     sale.PmtTyCd,
+		PchsSttsCd:  pchsSttsCd,
+		CfmDt:       time.Now().Format("20060102150405"),
+		PchsDt:      sale.SalesDt,
+		TotItemCnt:  len(sale.ItemList),
+		TaxblAmtA:   sale.TaxblAmtA,
+		TaxblAmtB:   sale.TaxblAmtB,
+		TaxblAmtC:   sale.TaxblAmtC,
+		TaxblAmtD:   sale.TaxblAmtD,
+		TaxblAmtE:   sale.TaxblAmtE,
+		TaxRtA:      sale.TaxRtA,
+		TaxRtB:      sale.TaxRtB,
+		TaxRtC:      sale.TaxRtC,
+		TaxRtD:      sale.TaxRtD,
+		TaxRtE:      sale.TaxRtE,
+		TaxAmtA:     sale.TaxAmtA,
+		TaxAmtB:     sale.TaxAmtB,
+		TaxAmtC:     sale.TaxAmtC,
+		TaxAmtD:     sale.TaxAmtD,
+		TaxAmtE:     sale.TaxAmtE,
+		TotTaxblAmt: sale.TotTaxblAmt,
+		TotTaxAmt:   sale.TotTaxAmt,
+		TotAmt:      sale.TotAmt,
+		Remark:      sale.Remark,
+	}
+	for _, item := range sale.ItemList {
+		req.ItemList = append(req.ItemList, TrnsPurchaseSaveItem{
+			ItemSeq:        item.ItemSeq,
+			ItemClsCd:      item.ItemClsCd,
+			ItemNm:         item.ItemNm,
+			Bcd:            item.Bcd,
+			SpplrItemClsCd: item.ItemClsCd,
+			SpplrItemCd:    item.ItemCd,
+			SpplrItemNm:    item.ItemNm,
+			PkgUnitCd:      item.PkgUnitCd,
+			Pkg:            item.Pkg,
+			QtyUnitCd:      item.QtyUnitCd,
+			Qty:            item.Qty,
+			Prc:            item.Prc,
+			SplyAmt:        item.SplyAmt,
+			DcRt:           item.DcRt,
+			DcAmt:          item.DcAmt,
+			TaxblAmt:       item.TaxblAmt,
+			TaxTyCd:        item.TaxTyCd,
+			TaxAmt:         item.TaxAmt,
+			TotAmt:         item.TotAmt,
+		})
+	}
+	return req
+}
+
+// PurchaseStockMovement returns the stock movement of a confirmed purchase:
+// a purchase (02) brings its lines into stock and a purchase credit note,
+// goods sent back to the supplier, takes them out again (12). The movement
+// still needs its sarNo and orgSarNo. ok is false if the purchase is not
+// confirmed or no line has an itemCd of the taxpayer's own, so nothing
+// moves.
+func PurchaseStockMovement(purchase TrnsPurchaseSaveReq) (req StockIOSaveReq, ok bool) {
+	if purchase.PchsSttsCd != TransactionApproved {
+		return StockIOSaveReq{}, false
+	}
+	sarTyCd := StockInPurchase
+	if purchase.RcptTyCd == PurchaseReceiptTypeCreditNote {
+		sarTyCd = StockOutReturn
+	}
+	req = StockIOSaveReq{
+		Tin:       purchase.Tin,
+		BhfId:     purchase.BhfId,
+		RegTyCd:   RegistrationAutomatic,
+		CustTin:   purchase.SpplrTin,
+		CustBhfId: purchase.SpplrBhfId,
+		CustNm:    purchase.SpplrNm,
+		SarTyCd:   sarTyCd,
+		OcrnDt:    purchase.PchsDt,
+		Remark:    fmt.Sprintf("Purchase %d", purchase.InvcNo),
+		RegrId:    purchase.RegrId,
+		RegrNm:    purchase.RegrNm,
+		ModrId:    purchase.ModrId,
+		ModrNm:    purchase.ModrNm,
+	}
+	for _, item := range purchase.ItemList {
+		if item.ItemCd == "" {
+			continue
+		}
+		req.ItemList = append(req.ItemList, StockIOSaveItem{
+			ItemSeq:    len(req.ItemList) + 1,
+			ItemCd:     item.ItemCd,
+			ItemClsCd:  item.ItemClsCd,
+			ItemNm:     item.ItemNm,
+			Bcd:        item.Bcd,
+			PkgUnitCd:  item.PkgUnitCd,
+			Pkg:        item.Pkg,
+			QtyUnitCd:  item.QtyUnitCd,
+			Qty:        item.Qty,
+			ItemExprDt: item.ItemExprDt,
+			Prc:        item.Prc,
+			SplyAmt:    item.SplyAmt,
+			TotDcAmt:   item.DcAmt,
+			TaxblAmt:   item.TaxblAmt,
+			TaxTyCd:    item.TaxTyCd,
+			TaxAmt:     item.TaxAmt,
+			TotAmt:     item.TotAmt,
+		})
+		req.TotTaxblAmt = req.TotTaxblAmt.Add(item.TaxblAmt)
+		req.TotTaxAmt = req.TotTaxAmt.Add(item.TaxAmt)
+		req.TotAmt = req.TotAmt.Add(item.TotAmt)
+	}
+	req.TotItemCnt = len(req.ItemList)
+	return req, len(req.ItemList) > 0
+}
+
+// checkPurchase checks what the code tables cannot: the fields the spec
+// requires and that the totals match the lines.
+func checkPurchase(req TrnsPurchaseSaveReq) error {
+	var errs []error
+	if req.InvcNo <= 0 {
+		errs = append(errs, errors.New("purchase needs an invcNo"))
+	}
+	if req.PchsDt == "" {
+		errs = append(errs, errors.New("purchase needs a pchsDt"))
+	}
+	if len(req.ItemList) == 0 {
+		errs = append(errs, errors.New("purchase has no items"))
+	}
+	if req.TotItemCnt != len(req.ItemList) {
+		errs = append(errs, fmt.Errorf("totItemCnt is %d but there are %d items", req.TotItemCnt, len(req.ItemList)))
+	}
+
+	var taxblAmt, taxAmt, totAmt Decimal
+	for _, item := range req.ItemList {
+		if item.ItemClsCd == "" || item.ItemNm == "" {
+			errs = append(errs, fmt.Errorf("item %d needs an itemClsCd and itemNm", item.ItemSeq))
+		}
+		taxblAmt = taxblAmt.Add(item.TaxblAmt)
+		taxAmt = taxAmt.Add(item.TaxAmt)
+		totAmt = totAmt.Add(item.TotAmt)
+	}
+	if taxblAmt != req.TotTaxblAmt {
+		errs = append(errs, fmt.Errorf("totTaxblAmt is %s but the items add up to %s", req.TotTaxblAmt, taxblAmt))
+	}
+	if taxAmt != req.TotTaxAmt {
+		errs = append(errs, fmt.Errorf("totTaxAmt is %s but the items add up to %s", req.TotTaxAmt, taxAmt))
+	}
+	if totAmt != req.TotAmt {
+		errs = append(errs, fmt.Errorf("totAmt is %s but the items add up to %s", req.TotAmt, totAmt))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("etims: invalid purchase: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package etims
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQtyPrecision is returned when a quantity has more decimals than its
+// unit of quantity allows.
+var ErrQtyPrecision = errors.New("etims: quantity too precise for its unit")
+
+// QtyPrecision is the number of decimals a quantity may have, by unit of
+// quantity code (spec 4.6). Units counted in whole pieces allow none.
+// Units not listed, such as KG, LTR and M, are measured and allow two, the
+// precision of the NUMBER(13,2) quantities of the spec.
+var QtyPrecision = map[string]int{
+	"4B":  0, // Pair
+	"AV":  0, // Cap
+	"BE":  0, // Bundle
+	"BG":  0, // Bag
+	"BL":  0, // Block
+	"BX":  0, // Box
+	"CA":  0, // Can
+	"CEL": 0, // Cell
+	"DR":  0, // Drum
+	"DZ":  0, // Dozen
+	"GRO": 0, // Gross
+	"LK":  0, // Link
+	"NO":  0, // Number
+	"PA":  0, // Packet
+	"PG":  0, // Plate
+	"PR":  0, // Pair
+	"RL":  0, // Reel
+	"RO":  0, // Roll
+	"SET": 0, // Set
+	"ST":  0, // Sheet
+	"TU":  0, // Tube
+	"U":   0, // Pieces/item
+}
+
+// qtyPrecision returns the decimals allowed for qtyUnitCd.
+func qtyPrecision(qtyUnitCd string) int {
+	if p, ok := QtyPrecision[qtyUnitCd]; ok {
+		return p
+	}
+	return 2
+}
+
+// validateQty checks that qty has no more decimals than qtyUnitCd allows.
+func validateQty(name, qtyUnitCd string, qty Decimal) error {
+	step := int64(100)
+	for i := 0; i < qtyPrecision(qtyUnitCd); i++ {
+		step /= 10
+	}
+	if qty.Cents()%step != 0 {
+		return fmt.Errorf("%w: %s %s has more than %d decimals for unit %s", ErrQtyPrecision, name, qty, qtyPrecision(qtyUnitCd), qtyUnitCd)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package etims
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces sensitive values in log entries.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedFields are the JSON fields and log fields hidden by a
+// Redactor in addition to the ones it is given.
+var DefaultRedactedFields = []string{"cmcKey", "pwd", "intrlKey", "signKey"}
+
+// DefaultRedactedHeaders are the HTTP headers hidden by a Redactor in
+// addition to the ones it is given.
+var DefaultRedactedHeaders = []string{"CMC-KEY", "Authorization"}
+
+// Redactor is a logrus hook that hides secrets before an entry is
+// written. It replaces:
+//   - log fields named like a sensitive field,
+//   - sensitive fields inside JSON logged as a string or []byte, such as
+//     the request body, and
+//   - sensitive headers in a logged http.Header.
+//
+// Field and header names are matched case-insensitively. The hook works on
+// copies, so the headers of the request being sent are left intact.
+type Redactor struct {
+	fields  map[string]bool
+	headers map[string]bool
+}
+
+// NewRedactor returns a Redactor hiding the default fields and headers as
+// well as the given ones.
+func NewRedactor(fields, headers []string) *Redactor {
+	r := &Redactor{
+		fields:  make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+	for _, f := range append(append([]string(nil), DefaultRedactedFields...), fields...) {
+		r.fields[strings.ToLower(f)] = true
+	}
+	for _, h := range append(append([]string(nil), DefaultRedactedHeaders...), headers...) {
+		r.headers[strings.ToLower(h)] = true
+	}
+	return r
+}
+
+func (r *Redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts e.Data. logrus hands hooks a copy of the entry's data map,
+// so replacing values does not affect the logger the entry came from.
+func (r *Redactor) Fire(e *logrus.Entry) error {
+	for k, v := range e.Data {
+		if r.fields[strings.ToLower(k)] {
+			e.Data[k] = Redacted
+			continue
+		}
+		switch v := v.(type) {
+		case http.Header:
+			e.Data[k] = r.header(v)
+		case string:
+			e.Data[k] = r.json(v)
+		case []byte:
+			e.Data[k] = r.json(string(v))
+		}
+	}
+	return nil
+}
+
+// header returns a copy of h with sensitive values replaced.
+func (r *Redactor) header(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		if r.headers[strings.ToLower(k)] {
+			out[k] = []string{Redacted}
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// json redacts s if it is a JSON object or array and returns it unchanged
+// otherwise.
+func (r *Redactor) json(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return s
+	}
+	// UseNumber keeps large invoice numbers and amounts exactly as logged.
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return s
+	}
+	if !r.walk(v) {
+		return s
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return s
+	}
+	return string(out)
+}
+
+// walk redacts v in place and reports whether anything changed.
+func (r *Redactor) walk(v interface{}) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if r.fields[strings.ToLower(k)] {
+				v[k] = Redacted
+				changed = true
+			} else if r.walk(child) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if r.walk(child) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
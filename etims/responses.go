@@ -0,0 +1,313 @@
+package etims
+
+// Result codes that mean the VSCU accepted the request.
+const (
+	ResultSuccess        = "000"
+	ResultNoSearchResult = "001"
+)
+
+// Result is the envelope every VSCU response carries.
+type Result struct {
+	ResultCd  string `json:"resultCd"`
+	ResultMsg string `json:"resultMsg"`
+	ResultDt  string `json:"resultDt"`
+}
+
+func (r *Result) result() *Result {
+	return r
+}
+
+// Response is a Result with the route-specific data payload. Data is nil
+// when the VSCU had nothing to return (result code 001).
+type Response[T any] struct {
+	Result
+	Data *T `json:"data"`
+}
+
+// envelope is implemented by *Result and every *Response.
+type envelope interface {
+	result() *Result
+}
+
+type InitInfoRes struct {
+	Info InitInfo `json:"info"`
+}
+
+type InitInfo struct {
+	Tin              string `json:"tin"`
+	TaxprNm          string `json:"taxprNm"`
+	BsnsActv         string `json:"bsnsActv"`
+	BhfId            string `json:"bhfId"`
+	BhfNm            string `json:"bhfNm"`
+	BhfOpenDt        string `json:"bhfOpenDt"`
+	PrvncNm          string `json:"prvncNm"`
+	DstrtNm          string `json:"dstrtNm"`
+	SctrNm           string `json:"sctrNm"`
+	LocDesc          string `json:"locDesc"`
+	HqYn             string `json:"hqYn"`
+	MgrNm            string `json:"mgrNm"`
+	MgrTelNo         string `json:"mgrTelNo"`
+	MgrEmail         string `json:"mgrEmail"`
+	DvcId            string `json:"dvcId"`
+	SdcId            string `json:"sdcId"`
+	MrcNo            string `json:"mrcNo"`
+	IntrlKey         string `json:"intrlKey"`
+	SignKey          string `json:"signKey"`
+	CmcKey           string `json:"cmcKey"`
+	LastSaleInvcNo   int64  `json:"lastSaleInvcNo"`
+	LastPchsInvcNo   int64  `json:"lastPchsInvcNo"`
+	LastSaleRcptNo   int64  `json:"lastSaleRcptNo"`
+	LastInvcNo       int64  `json:"lastInvcNo"`
+	LastTrainInvcNo  int64  `json:"lastTrainInvcNo"`
+	LastProfrmInvcNo int64  `json:"lastProfrmInvcNo"`
+	LastCopyInvcNo   int64  `json:"lastCopyInvcNo"`
+}
+
+type CodeRes struct {
+	ClsList []CodeCls `json:"clsList"`
+}
+
+type CodeCls struct {
+	CdCls      string    `json:"cdCls"`
+	CdClsNm    string    `json:"cdClsNm"`
+	CdClsDesc  string    `json:"cdClsDesc"`
+	UseYn      string    `json:"useYn"`
+	UserDfnNm1 string    `json:"userDfnNm1"`
+	UserDfnNm2 string    `json:"userDfnNm2"`
+	UserDfnNm3 string    `json:"userDfnNm3"`
+	DtlList    []CodeDtl `json:"dtlList"`
+}
+
+type CodeDtl struct {
+	Cd         string `json:"cd"`
+	CdNm       string `json:"cdNm"`
+	CdDesc     string `json:"cdDesc"`
+	UseYn      string `json:"useYn"`
+	SrtOrd     int    `json:"srtOrd"`
+	UserDfnCd1 string `json:"userDfnCd1"`
+	UserDfnCd2 string `json:"userDfnCd2"`
+	UserDfnCd3 string `json:"userDfnCd3"`
+}
+
+type ItemClsRes struct {
+	ItemClsList []ItemCls `json:"itemClsList"`
+}
+
+type ItemCls struct {
+	ItemClsCd  string `json:"itemClsCd"`
+	ItemClsNm  string `json:"itemClsNm"`
+	ItemClsLvl int    `json:"itemClsLvl"`
+	TaxTyCd    string `json:"taxTyCd"`
+	MjrTgYn    string `json:"mjrTgYn"`
+	UseYn      string `json:"useYn"`
+}
+
+type CustRes struct {
+	CustList []Cust `json:"custList"`
+}
+
+type Cust struct {
+	Tin         string `json:"tin"`
+	TaxprNm     string `json:"taxprNm"`
+	TaxprSttsCd string `json:"taxprSttsCd"`
+	PrvncNm     string `json:"prvncNm"`
+	DstrtNm     string `json:"dstrtNm"`
+	SctrNm      string `json:"sctrNm"`
+	LocDesc     string `json:"locDesc"`
+}
+
+type BhfRes struct {
+	BhfList []Bhf `json:"bhfList"`
+}
+
+type Bhf struct {
+	Tin       string `json:"tin"`
+	BhfId     string `json:"bhfId"`
+	BhfNm     string `json:"bhfNm"`
+	BhfSttsCd string `json:"bhfSttsCd"`
+	PrvncNm   string `json:"prvncNm"`
+	DstrtNm   string `json:"dstrtNm"`
+	SctrNm    string `json:"sctrNm"`
+	LocDesc   string `json:"locDesc"`
+	MgrNm     string `json:"mgrNm"`
+	MgrTelNo  string `json:"mgrTelNo"`
+	MgrEmail  string `json:"mgrEmail"`
+	HqYn      string `json:"hqYn"`
+}
+
+type NoticeRes struct {
+	NoticeList []Notice `json:"noticeList"`
+}
+
+type Notice struct {
+	NoticeNo int64  `json:"noticeNo"`
+	Title    string `json:"title"`
+	Cont     string `json:"cont"`
+	DtlUrl   string `json:"dtlUrl"`
+	RegrNm   string `json:"regrNm"`
+	RegDt    string `json:"regDt"`
+}
+
+type ItemRes struct {
+	ItemList []Item `json:"itemList"`
+}
+
+type Item struct {
+	Tin         string  `json:"tin"`
+	ItemCd      string  `json:"itemCd"`
+	ItemClsCd   string  `json:"itemClsCd"`
+	ItemTyCd    string  `json:"itemTyCd"`
+	ItemNm      string  `json:"itemNm"`
+	ItemStdNm   string  `json:"itemStdNm"`
+	OrgnNatCd   string  `json:"orgnNatCd"`
+	PkgUnitCd   string  `json:"pkgUnitCd"`
+	QtyUnitCd   string  `json:"qtyUnitCd"`
+	TaxTyCd     string  `json:"taxTyCd"`
+	BtchNo      string  `json:"btchNo"`
+	RegBhfId    string  `json:"regBhfId"`
+	Bcd         string  `json:"bcd"`
+	DftPrc      Decimal `json:"dftPrc"`
+	GrpPrcL1    Decimal `json:"grpPrcL1"`
+	GrpPrcL2    Decimal `json:"grpPrcL2"`
+	GrpPrcL3    Decimal `json:"grpPrcL3"`
+	GrpPrcL4    Decimal `json:"grpPrcL4"`
+	GrpPrcL5    Decimal `json:"grpPrcL5"`
+	AddInfo     string  `json:"addInfo"`
+	SftyQty     Decimal `json:"sftyQty"`
+	IsrcAplcbYn string  `json:"isrcAplcbYn"`
+	KraModYn    string  `json:"KRAModYn"`
+	UseYn       string  `json:"useYn"`
+}
+
+type ImptItemRes struct {
+	ItemList []ImportItem `json:"itemList"`
+}
+
+type ImportItem struct {
+	TaskCd         string  `json:"taskCd"`
+	DclDe          string  `json:"dclDe"`
+	ItemSeq        int     `json:"itemSeq"`
+	DclNo          string  `json:"dclNo"`
+	HsCd           string  `json:"hsCd"`
+	ItemNm         string  `json:"itemNm"`
+	ImptItemSttsCd string  `json:"imptItemsttsCd"`
+	OrgnNatCd      string  `json:"orgnNatCd"`
+	ExptNatCd      string  `json:"exptNatCd"`
+	Pkg            Decimal `json:"pkg"`
+	PkgUnitCd      string  `json:"pkgUnitCd"`
+	Qty            Decimal `json:"qty"`
+	QtyUnitCd      string  `json:"qtyUnitCd"`
+	TotWt          float64 `json:"totWt"`
+	NetWt          float64 `json:"netWt"`
+	SpplrNm        string  `json:"spplrNm"`
+	AgntNm         string  `json:"agntNm"`
+	InvcFcurAmt    Decimal `json:"invcFcurAmt"`
+	InvcFcurCd     string  `json:"invcFcurCd"`
+	InvcFcurExcrt  float64 `json:"invcFcurExcrt"`
+}
+
+type TrnsSalesSaveRes struct {
+	RcptNo           int64  `json:"rcptNo"`
+	IntrlData        string `json:"intrlData"`
+	RcptSign         string `json:"rcptSign"`
+	TotRcptNo        int64  `json:"totRcptNo"`
+	VscuRcptPbctDate string `json:"VSCURcptPbctDate"`
+	SdcId            string `json:"sdcId"`
+	MrcNo            string `json:"mrcNo"`
+}
+
+type TrnsPurchaseSalesRes struct {
+	SaleList []TrnsPurchaseSales `json:"saleList"`
+}
+
+type TrnsPurchaseSales struct {
+	SpplrTin    string                  `json:"spplrTin"`
+	SpplrNm     string                  `json:"spplrNm"`
+	SpplrBhfId  string                  `json:"spplrBhfId"`
+	SpplrInvcNo int64                   `json:"spplrInvcNo"`
+	SpplrSdcId  string                  `json:"spplrSdcId"`
+	SpplrMrcNo  string                  `json:"spplrMrcNo"`
+	RcptTyCd    string                  `json:"rcptTyCd"`
+	PmtTyCd     string                  `json:"pmtTyCd"`
+	CfmDt       string                  `json:"cfmDt"`
+	SalesDt     string                  `json:"salesDt"`
+	StockRlsDt  string                  `json:"stockRlsDt"`
+	TotItemCnt  int                     `json:"totItemCnt"`
+	TaxblAmtA   Decimal                 `json:"taxblAmtA"`
+	TaxblAmtB   Decimal                 `json:"taxblAmtB"`
+	TaxblAmtC   Decimal                 `json:"taxblAmtC"`
+	TaxblAmtD   Decimal                 `json:"taxblAmtD"`
+	TaxblAmtE   Decimal                 `json:"taxblAmtE"`
+	TaxRtA      Decimal                 `json:"taxRtA"`
+	TaxRtB      Decimal                 `json:"taxRtB"`
+	TaxRtC      Decimal                 `json:"taxRtC"`
+	TaxRtD      Decimal                 `json:"taxRtD"`
+	TaxRtE      Decimal                 `json:"taxRtE"`
+	TaxAmtA     Decimal                 `json:"taxAmtA"`
+	TaxAmtB     Decimal                 `json:"taxAmtB"`
+	TaxAmtC     Decimal                 `json:"taxAmtC"`
+	TaxAmtD     Decimal                 `json:"taxAmtD"`
+	TaxAmtE     Decimal                 `json:"taxAmtE"`
+	TotTaxblAmt Decimal                 `json:"totTaxblAmt"`
+	TotTaxAmt   Decimal                 `json:"totTaxAmt"`
+	TotAmt      Decimal                 `json:"totAmt"`
+	Remark      string                  `json:"remark"`
+	ItemList    []TrnsPurchaseSalesItem `json:"itemList"`
+}
+
+type TrnsPurchaseSalesItem struct {
+	ItemSeq   int     `json:"itemSeq"`
+	ItemCd    string  `json:"itemCd"`
+	ItemClsCd string  `json:"itemClsCd"`
+	ItemNm    string  `json:"itemNm"`
+	Bcd       string  `json:"bcd"`
+	PkgUnitCd string  `json:"pkgUnitCd"`
+	Pkg       Decimal `json:"pkg"`
+	QtyUnitCd string  `json:"qtyUnitCd"`
+	Qty       Decimal `json:"qty"`
+	Prc       Decimal `json:"prc"`
+	SplyAmt   Decimal `json:"splyAmt"`
+	DcRt      Decimal `json:"dcRt"`
+	DcAmt     Decimal `json:"dcAmt"`
+	TaxTyCd   string  `json:"taxTyCd"`
+	TaxblAmt  Decimal `json:"taxblAmt"`
+	TaxAmt    Decimal `json:"taxAmt"`
+	TotAmt    Decimal `json:"totAmt"`
+}
+
+type StockMoveRes struct {
+	StockList []StockMove `json:"stockList"`
+}
+
+type StockMove struct {
+	CustTin     string          `json:"custTin"`
+	CustBhfId   string          `json:"custBhfId"`
+	SarNo       int64           `json:"sarNo"`
+	OcrnDt      string          `json:"ocrnDt"`
+	TotItemCnt  int             `json:"totItemCnt"`
+	TotTaxblAmt Decimal         `json:"totTaxblAmt"`
+	TotTaxAmt   Decimal         `json:"totTaxAmt"`
+	TotAmt      Decimal         `json:"totAmt"`
+	Remark      string          `json:"remark"`
+	ItemList    []StockMoveItem `json:"itemList"`
+}
+
+type StockMoveItem struct {
+	ItemSeq    int     `json:"itemSeq"`
+	ItemCd     string  `json:"itemCd"`
+	ItemClsCd  string  `json:"itemClsCd"`
+	ItemNm     string  `json:"itemNm"`
+	Bcd        string  `json:"bcd"`
+	PkgUnitCd  string  `json:"pkgUnitCd"`
+	Pkg        Decimal `json:"pkg"`
+	QtyUnitCd  string  `json:"qtyUnitCd"`
+	Qty        Decimal `json:"qty"`
+	ItemExprDt string  `json:"itemExprDt"`
+	Prc        Decimal `json:"prc"`
+	SplyAmt    Decimal `json:"splyAmt"`
+	TotDcAmt   Decimal `json:"totDcAmt"`
+	TaxblAmt   Decimal `json:"taxblAmt"`
+	TaxTyCd    string  `json:"taxTyCd"`
+	TaxAmt     Decimal `json:"taxAmt"`
+	TotAmt     Decimal `json:"totAmt"`
+}
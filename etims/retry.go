@@ -0,0 +1,89 @@
+package etims
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how Do retries requests that failed for transient
+// reasons: transport errors and result codes 894, 896 and 999.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. A
+	// value of 1 or less disables retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts.
+	MaxBackoff time.Duration
+	// Multiplier grows the wait after every attempt.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of each wait that is
+	// randomized so that branches reconnecting together do not retry in
+	// lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is the policy a Client uses unless WithRetryPolicy
+// says otherwise.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// backoff returns the wait before attempt, counting the first attempt as 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-2))
+	if max := float64(p.MaxBackoff); p.MaxBackoff > 0 && d > max {
+		d = max
+	}
+	d -= d * p.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// wait sleeps before attempt unless ctx is done first.
+func (p RetryPolicy) wait(ctx context.Context, attempt int) error {
+	t := time.NewTimer(p.backoff(attempt))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryable reports whether a request that failed with err may be sent
+// again.
+func retryable(err error) bool {
+	return IsTransport(err) || IsRetryable(err)
+}
+
+// isSave reports whether path declares or changes data, as opposed to
+// looking it up.
+func isSave(path string) bool {
+	route := path[strings.LastIndex(path, "/")+1:]
+	return strings.HasPrefix(route, "save") || strings.HasPrefix(route, "update")
+}
+
+// requestID returns the X-Request-ID for a request. Save requests get a
+// key derived from their route and body, so every retry of the same
+// declaration, including one replayed from the outbox after a restart,
+// carries the same ID and the VSCU can recognise it. Lookups get a unique
+// ID for tracing.
+func requestID(path string, body []byte) string {
+	if !isSave(path) {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	sum := sha256.Sum256(append([]byte(path+"\n"), body...))
+	return hex.EncodeToString(sum[:16])
+}
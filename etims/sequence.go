@@ -0,0 +1,330 @@
+package etims
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sequence kinds.
+const (
+	// SequenceInvoice numbers sales invoices (invcNo).
+	SequenceInvoice = "invcNo"
+)
+
+var (
+	// ErrDuplicateReference is returned by Next when the reference already
+	// has a number. The existing number is returned with it.
+	ErrDuplicateReference = errors.New("etims: reference already numbered")
+	// ErrDuplicateNumber is returned when a number is confirmed or voided
+	// twice.
+	ErrDuplicateNumber = errors.New("etims: number already used")
+	// ErrUnknownNumber is returned when a number that was never allocated
+	// is confirmed or voided.
+	ErrUnknownNumber = errors.New("etims: number was not allocated")
+)
+
+// SequenceKey identifies one numbering sequence of one branch.
+type SequenceKey struct {
+	Tin   string
+	BhfId string
+	Kind  string
+}
+
+func (k SequenceKey) String() string {
+	return k.Tin + "/" + k.BhfId + "/" + k.Kind
+}
+
+// Number states.
+const (
+	NumberAllocated = "allocated"
+	NumberConfirmed = "confirmed"
+	NumberVoided    = "voided"
+)
+
+// SequenceNumber is one number handed out by a Sequencer.
+type SequenceNumber struct {
+	No  int64  `json:"no"`
+	Ref string `json:"ref,omitempty"`
+	// State is NumberAllocated until the declaration carrying the number
+	// is accepted (NumberConfirmed) or abandoned (NumberVoided).
+	State  string    `json:"state"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// SequenceAudit is the state of a sequence as an auditor sees it.
+type SequenceAudit struct {
+	Key  SequenceKey
+	Last int64
+	// Pending are numbers allocated but neither confirmed nor voided,
+	// e.g. because the program stopped before the declaration was sent.
+	Pending []SequenceNumber
+	// Voided are numbers deliberately left unused, with the reason.
+	Voided []SequenceNumber
+	// Missing are numbers within the sequence that were never allocated
+	// here, e.g. because the VSCU reported a higher last number.
+	Missing []int64
+}
+
+// Clean reports whether every number of the sequence is accounted for.
+func (a SequenceAudit) Clean() bool {
+	return len(a.Pending) == 0 && len(a.Missing) == 0
+}
+
+type sequence struct {
+	floor   int64
+	last    int64
+	numbers map[int64]*SequenceNumber
+	refs    map[string]int64
+}
+
+// Sequence log ops.
+const (
+	sequenceAlloc   = "alloc"
+	sequenceConfirm = "confirm"
+	sequenceVoid    = "void"
+	sequenceSeed    = "seed"
+)
+
+type sequenceRecord struct {
+	Op     string    `json:"op"`
+	Tin    string    `json:"tin"`
+	BhfId  string    `json:"bhfId"`
+	Kind   string    `json:"kind"`
+	No     int64     `json:"no"`
+	Ref    string    `json:"ref,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Sequencer hands out gapless, monotonic numbers per branch and kind, such
+// as invoice numbers. Every allocation is appended to a log and synced
+// before the number is returned, so a number is never handed out twice,
+// even across a crash. Numbers that were allocated but never used are
+// reported by Audit rather than silently reused.
+type Sequencer struct {
+	mu        sync.Mutex
+	f         *os.File
+	sequences map[SequenceKey]*sequence
+}
+
+// OpenSequencer opens the sequence log at path, creating it if needed. A
+// record torn by a crash during append is discarded.
+func OpenSequencer(path string) (*Sequencer, error) {
+	s := &Sequencer{sequences: make(map[SequenceKey]*sequence)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read sequences: %w", err)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	// The last element is empty unless the final append was torn.
+	for _, line := range lines[:len(lines)-1] {
+		if len(line) == 0 {
+			continue
+		}
+		var rec sequenceRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("failed to replay sequences %s: %w", path, err)
+		}
+		s.apply(rec)
+	}
+	if n := len(lines[len(lines)-1]); n > 0 {
+		if err := os.Truncate(path, int64(len(data)-n)); err != nil {
+			return nil, fmt.Errorf("failed to repair sequences: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to open sequences: %w", err)
+	}
+	s.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sequences: %w", err)
+	}
+	return s, nil
+}
+
+// Close closes the sequence log.
+func (s *Sequencer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.f.Close()
+}
+
+func (s *Sequencer) seq(key SequenceKey) *sequence {
+	q, ok := s.sequences[key]
+	if !ok {
+		q = &sequence{numbers: make(map[int64]*SequenceNumber), refs: make(map[string]int64)}
+		s.sequences[key] = q
+	}
+	return q
+}
+
+func (s *Sequencer) apply(rec sequenceRecord) {
+	q := s.seq(SequenceKey{Tin: rec.Tin, BhfId: rec.BhfId, Kind: rec.Kind})
+	switch rec.Op {
+	case sequenceAlloc:
+		q.numbers[rec.No] = &SequenceNumber{No: rec.No, Ref: rec.Ref, State: NumberAllocated, At: rec.At}
+		if rec.Ref != "" {
+			q.refs[rec.Ref] = rec.No
+		}
+		if rec.No > q.last {
+			q.last = rec.No
+		}
+	case sequenceConfirm:
+		if n, ok := q.numbers[rec.No]; ok {
+			n.State, n.At = NumberConfirmed, rec.At
+		}
+	case sequenceVoid:
+		if n, ok := q.numbers[rec.No]; ok {
+			n.State, n.Reason, n.At = NumberVoided, rec.Reason, rec.At
+		}
+	case sequenceSeed:
+		if len(q.numbers) == 0 {
+			q.floor = rec.No
+		}
+		if rec.No > q.last {
+			q.last = rec.No
+		}
+	}
+}
+
+// append writes rec to the log and applies it once it is on disk. s.mu
+// must be held.
+func (s *Sequencer) append(rec sequenceRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode sequence record: %w", err)
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write sequences: %w", err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync sequences: %w", err)
+	}
+	s.apply(rec)
+	return nil
+}
+
+func (key SequenceKey) record(op string, no int64) sequenceRecord {
+	return sequenceRecord{Op: op, Tin: key.Tin, BhfId: key.BhfId, Kind: key.Kind, No: no, At: time.Now()}
+}
+
+// Next allocates the next number of the sequence for ref, the caller's own
+// document number such as a trader invoice number. If ref already has a
+// number, Next returns that number with ErrDuplicateReference. An empty ref
+// is not tracked.
+func (s *Sequencer) Next(ctx context.Context, key SequenceKey, ref string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.seq(key)
+	if no, ok := q.refs[ref]; ok && ref != "" {
+		return no, fmt.Errorf("%w: %s %q is %d", ErrDuplicateReference, key.Kind, ref, no)
+	}
+
+	rec := key.record(sequenceAlloc, q.last+1)
+	rec.Ref = ref
+	if err := s.append(rec); err != nil {
+		return 0, err
+	}
+	return rec.No, nil
+}
+
+// Lookup returns the number allocated for ref.
+func (s *Sequencer) Lookup(key SequenceKey, ref string) (SequenceNumber, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.seq(key)
+	no, ok := q.refs[ref]
+	if !ok {
+		return SequenceNumber{}, false
+	}
+	return *q.numbers[no], true
+}
+
+// Confirm records that the declaration carrying no was accepted.
+func (s *Sequencer) Confirm(ctx context.Context, key SequenceKey, no int64) error {
+	return s.settle(key, no, sequenceConfirm, "")
+}
+
+// Void records that no will not be declared, and why. Voided numbers are
+// not reused, so the gap stays explained in the audit.
+func (s *Sequencer) Void(ctx context.Context, key SequenceKey, no int64, reason string) error {
+	return s.settle(key, no, sequenceVoid, reason)
+}
+
+func (s *Sequencer) settle(key SequenceKey, no int64, op, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.seq(key).numbers[no]
+	if !ok {
+		return fmt.Errorf("%w: %s %d", ErrUnknownNumber, key.Kind, no)
+	}
+	if n.State != NumberAllocated {
+		return fmt.Errorf("%w: %s %d is %s", ErrDuplicateNumber, key.Kind, no, n.State)
+	}
+	rec := key.record(op, no)
+	rec.Reason = reason
+	return s.append(rec)
+}
+
+// Seed raises the sequence to at least last, the last number the VSCU
+// reports for the branch (e.g. InitInfo.LastSaleInvcNo). On a sequence
+// that has allocated nothing, numbers up to last are taken as used
+// elsewhere. Otherwise the numbers skipped are reported as missing.
+func (s *Sequencer) Seed(ctx context.Context, key SequenceKey, last int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last <= s.seq(key).last {
+		return nil
+	}
+	return s.append(key.record(sequenceSeed, last))
+}
+
+// Audit reports the numbers of the sequence that are not accounted for.
+func (s *Sequencer) Audit(key SequenceKey) SequenceAudit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.seq(key)
+	audit := SequenceAudit{Key: key, Last: q.last}
+	for no := q.floor + 1; no <= q.last; no++ {
+		n, ok := q.numbers[no]
+		switch {
+		case !ok:
+			audit.Missing = append(audit.Missing, no)
+		case n.State == NumberAllocated:
+			audit.Pending = append(audit.Pending, *n)
+		case n.State == NumberVoided:
+			audit.Voided = append(audit.Voided, *n)
+		}
+	}
+	return audit
+}
+
+// Keys returns the sequences the log holds, in order.
+func (s *Sequencer) Keys() []SequenceKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]SequenceKey, 0, len(s.sequences))
+	for key := range s.sequences {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
+}
@@ -0,0 +1,196 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSequencer(t *testing.T) {
+	ctx := context.Background()
+	key := SequenceKey{Tin: "P000000001A", BhfId: "00", Kind: SequenceInvoice}
+	other := SequenceKey{Tin: "P000000001A", BhfId: "01", Kind: SequenceInvoice}
+
+	type step struct {
+		op      string // next, confirm, void or seed
+		key     SequenceKey
+		ref     string
+		no      int64
+		want    int64 // number returned by next
+		wantErr error
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		// After the steps and after reopening the log.
+		last    int64
+		pending []int64
+		voided  []int64
+		missing []int64
+		refs    map[string]string // ref -> state
+	}{
+		{
+			name: "allocate confirm void",
+			steps: []step{
+				{op: "next", key: key, ref: "T-1", want: 1},
+				{op: "next", key: key, ref: "T-2", want: 2},
+				{op: "next", key: key, ref: "T-3", want: 3},
+				{op: "confirm", key: key, no: 1},
+				{op: "void", key: key, no: 2},
+				{op: "next", key: other, ref: "T-1", want: 1},
+			},
+			last:    3,
+			pending: []int64{3},
+			voided:  []int64{2},
+			refs:    map[string]string{"T-1": NumberConfirmed, "T-2": NumberVoided, "T-3": NumberAllocated},
+		},
+		{
+			name: "duplicate reference",
+			steps: []step{
+				{op: "next", key: key, ref: "T-1", want: 1},
+				{op: "next", key: key, ref: "T-1", want: 1, wantErr: ErrDuplicateReference},
+				{op: "next", key: key, want: 2},
+				{op: "next", key: key, want: 3},
+				{op: "confirm", key: key, no: 1},
+				{op: "confirm", key: key, no: 2},
+				{op: "confirm", key: key, no: 3},
+			},
+			last: 3,
+			refs: map[string]string{"T-1": NumberConfirmed},
+		},
+		{
+			name: "settle twice or unknown",
+			steps: []step{
+				{op: "next", key: key, ref: "T-1", want: 1},
+				{op: "confirm", key: key, no: 1},
+				{op: "confirm", key: key, no: 1, wantErr: ErrDuplicateNumber},
+				{op: "void", key: key, no: 1, wantErr: ErrDuplicateNumber},
+				{op: "void", key: key, no: 7, wantErr: ErrUnknownNumber},
+			},
+			last: 1,
+			refs: map[string]string{"T-1": NumberConfirmed},
+		},
+		{
+			name: "seed empty sequence",
+			steps: []step{
+				{op: "seed", key: key, no: 41},
+				{op: "next", key: key, ref: "T-1", want: 42},
+				{op: "seed", key: key, no: 10},
+				{op: "confirm", key: key, no: 42},
+			},
+			last: 42,
+			refs: map[string]string{"T-1": NumberConfirmed},
+		},
+		{
+			name: "seed past allocations",
+			steps: []step{
+				{op: "next", key: key, ref: "T-1", want: 1},
+				{op: "confirm", key: key, no: 1},
+				{op: "seed", key: key, no: 3},
+				{op: "next", key: key, ref: "T-2", want: 4},
+			},
+			last:    4,
+			pending: []int64{4},
+			missing: []int64{2, 3},
+			refs:    map[string]string{"T-1": NumberConfirmed, "T-2": NumberAllocated},
+		},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "sequences.log")
+		s, err := OpenSequencer(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, st := range tt.steps {
+			var no int64
+			switch st.op {
+			case "next":
+				no, err = s.Next(ctx, st.key, st.ref)
+			case "confirm":
+				err = s.Confirm(ctx, st.key, st.no)
+			case "void":
+				err = s.Void(ctx, st.key, st.no, "test")
+			case "seed":
+				err = s.Seed(ctx, st.key, st.no)
+			}
+			if !errors.Is(err, st.wantErr) {
+				t.Errorf("%s: step %d %s: error %v, want %v", tt.name, i, st.op, err, st.wantErr)
+			}
+			if st.op == "next" && no != st.want {
+				t.Errorf("%s: step %d next = %d, want %d", tt.name, i, no, st.want)
+			}
+		}
+		s.Close()
+
+		// The state survives a restart.
+		for _, reopen := range []bool{false, true} {
+			if reopen {
+				if s, err = OpenSequencer(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			label := tt.name
+			if reopen {
+				label += " after restart"
+			}
+			a := s.Audit(key)
+			if a.Last != tt.last || !slices.Equal(numbers(a.Pending), tt.pending) ||
+				!slices.Equal(numbers(a.Voided), tt.voided) || !slices.Equal(a.Missing, tt.missing) {
+				t.Errorf("%s: audit last %d pending %v voided %v missing %v, want %d %v %v %v",
+					label, a.Last, numbers(a.Pending), numbers(a.Voided), a.Missing, tt.last, tt.pending, tt.voided, tt.missing)
+			}
+			for ref, state := range tt.refs {
+				if n, ok := s.Lookup(key, ref); !ok || n.State != state {
+					t.Errorf("%s: lookup %s = %+v, %v, want %s", label, ref, n, ok, state)
+				}
+			}
+		}
+		s.Close()
+	}
+}
+
+func TestSequencerTornRecord(t *testing.T) {
+	ctx := context.Background()
+	key := SequenceKey{Tin: "P000000001A", BhfId: "00", Kind: SequenceInvoice}
+	path := filepath.Join(t.TempDir(), "sequences.log")
+
+	s, err := OpenSequencer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Next(ctx, key, "T-1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// A crash in the middle of the next append leaves half a record.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"alloc","tin":"P000000001A","bhfId":"00","kind":"invcNo","no":2,"ref":"T-`)
+	f.Close()
+
+	s, err = OpenSequencer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if no, err := s.Next(ctx, key, "T-2"); err != nil || no != 2 {
+		t.Errorf("Next after torn record = %d, %v, want 2", no, err)
+	}
+	if _, ok := s.Lookup(key, "T-1"); !ok {
+		t.Error("record before the torn one was lost")
+	}
+}
+
+func numbers(ns []SequenceNumber) []int64 {
+	var nos []int64
+	for _, n := range ns {
+		nos = append(nos, n.No)
+	}
+	return nos
+}
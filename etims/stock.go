@@ -0,0 +1,225 @@
+package etims
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Stock in/out types (spec 4.15), the sarTyCd of stock movements. Codes
+// 01 to 06 bring stock in, 11 to 16 take it out.
+const (
+	StockInImport      = "01"
+	StockInPurchase    = "02"
+	StockInReturn      = "03"
+	StockInMovement    = "04"
+	StockInProcessing  = "05"
+	StockInAdjustment  = "06"
+	StockOutSale       = "11"
+	StockOutReturn     = "12"
+	StockOutMovement   = "13"
+	StockOutProcessing = "14"
+	StockOutDiscarding = "15"
+	StockOutAdjustment = "16"
+)
+
+var (
+	stockInTypes  = []string{StockInImport, StockInPurchase, StockInReturn, StockInMovement, StockInProcessing, StockInAdjustment}
+	stockOutTypes = []string{StockOutSale, StockOutReturn, StockOutMovement, StockOutProcessing, StockOutDiscarding, StockOutAdjustment}
+)
+
+// IsStockIn reports whether sarTyCd brings stock in.
+func IsStockIn(sarTyCd string) bool {
+	return slices.Contains(stockInTypes, sarTyCd)
+}
+
+// IsStockOut reports whether sarTyCd takes stock out.
+func IsStockOut(sarTyCd string) bool {
+	return slices.Contains(stockOutTypes, sarTyCd)
+}
+
+// Import item statuses (spec 4.18), the imptItemSttsCd of import items.
+const (
+	ImportItemUnsent    = "1"
+	ImportItemWaiting   = "2"
+	ImportItemApproved  = "3"
+	ImportItemCancelled = "4"
+)
+
+// SequenceStock numbers stock movements (sarNo of StockIOSaveReq).
+const SequenceStock = "sarNo"
+
+// SalesStockMovement returns the stock movement of an accepted invoice:
+// a sale (11) takes its lines out of stock and a credit note (03) returns
+// them. The movement still needs its sarNo and orgSarNo. ok is false if
+// no line of the invoice has an itemCd, so nothing moves.
+func SalesStockMovement(sale TrnsSalesSaveWrReq) (req StockIOSaveReq, ok bool) {
+	sarTyCd := StockOutSale
+	if sale.RcptTyCd == ReceiptTypeCreditNote {
+		sarTyCd = StockInReturn
+	}
+	req = StockIOSaveReq{
+		Tin:     sale.Tin,
+		BhfId:   sale.BhfId,
+		RegTyCd: RegistrationAutomatic,
+		CustTin: sale.CustTin,
+		CustNm:  sale.CustNm,
+		SarTyCd: sarTyCd,
+		OcrnDt:  sale.SalesDt,
+		Remark:  fmt.Sprintf("Invoice %d", sale.InvcNo),
+		RegrId:  sale.RegrId,
+		RegrNm:  sale.RegrNm,
+		ModrId:  sale.ModrId,
+		ModrNm:  sale.ModrNm,
+	}
+	for _, item := range sale.ItemList {
+		if item.ItemCd == "" {
+			continue
+		}
+		req.ItemList = append(req.ItemList, StockIOSaveItem{
+			ItemSeq:   len(req.ItemList) + 1,
+			ItemCd:    item.ItemCd,
+			ItemClsCd: item.ItemClsCd,
+			ItemNm:    item.ItemNm,
+			Bcd:       item.Bcd,
+			PkgUnitCd: item.PkgUnitCd,
+			Pkg:       item.Pkg,
+			QtyUnitCd: item.QtyUnitCd,
+			Qty:       item.Qty,
+			Prc:       item.Prc,
+			SplyAmt:   item.SplyAmt,
+			TotDcAmt:  item.DcAmt,
+			TaxblAmt:  item.TaxblAmt,
+			TaxTyCd:   item.TaxTyCd,
+			TaxAmt:    item.TaxAmt,
+			TotAmt:    item.TotAmt,
+		})
+		req.TotTaxblAmt = req.TotTaxblAmt.Add(item.TaxblAmt)
+		req.TotTaxAmt = req.TotTaxAmt.Add(item.TaxAmt)
+		req.TotAmt = req.TotAmt.Add(item.TotAmt)
+	}
+	req.TotItemCnt = len(req.ItemList)
+	return req, len(req.ItemList) > 0
+}
+
+// ImportStockMovement returns the stock movement (01) of an import item
+// approved by update, which maps it to the taxpayer's item. Its value is
+// the invoice amount converted at the declared exchange rate; customs
+// items carry no tax of their own here. The movement still needs its sarNo
+// and orgSarNo. ok is false unless update approves the item, and err is
+// set if its exchange rate is unusable or its value does not fit a Decimal.
+func ImportStockMovement(update ImportItemUpdateRequest, item ImportItem) (req StockIOSaveReq, ok bool, err error) {
+	if update.ImptItemSttsCd != ImportItemApproved || item.Qty.Sign() <= 0 {
+		return StockIOSaveReq{}, false, nil
+	}
+	excrt, err := DecimalFromFloat(item.InvcFcurExcrt, RoundHalfUp)
+	if err != nil {
+		return StockIOSaveReq{}, false, fmt.Errorf("import item %d exchange rate: %w", item.ItemSeq, err)
+	}
+	value, err := item.InvcFcurAmt.Mul(excrt, RoundHalfUp)
+	if err != nil {
+		return StockIOSaveReq{}, false, fmt.Errorf("import item %d value: %w", item.ItemSeq, err)
+	}
+	prc, err := value.Div(item.Qty, RoundHalfUp)
+	if err != nil {
+		return StockIOSaveReq{}, false, fmt.Errorf("import item %d price: %w", item.ItemSeq, err)
+	}
+	req = StockIOSaveReq{
+		Tin:         update.Tin,
+		BhfId:       update.BhfId,
+		RegTyCd:     RegistrationAutomatic,
+		CustNm:      item.SpplrNm,
+		SarTyCd:     StockInImport,
+		OcrnDt:      item.DclDe,
+		TotItemCnt:  1,
+		TotTaxblAmt: value,
+		TotAmt:      value,
+		Remark:      fmt.Sprintf("Import %s item %d", item.DclNo, item.ItemSeq),
+		ModrId:      update.ModrId,
+		ModrNm:      update.ModrNm,
+		ItemList: []StockIOSaveItem{{
+			ItemSeq:   1,
+			ItemCd:    update.ItemCd,
+			ItemClsCd: update.ItemClsCd,
+			ItemNm:    item.ItemNm,
+			PkgUnitCd: item.PkgUnitCd,
+			Pkg:       item.Pkg,
+			QtyUnitCd: item.QtyUnitCd,
+			Qty:       item.Qty,
+			Prc:       prc,
+			SplyAmt:   value,
+			TaxblAmt:  value,
+			TotAmt:    value,
+		}},
+	}
+	return req, true, nil
+}
+
+// ApplyStock computes the amounts of every line of req from its prc, qty
+// and taxTyCd, and fills in the totals, including totItemCnt. Stock
+// movements carry no discount.
+func (c *TaxCalculator) ApplyStock(req *StockIOSaveReq) error {
+	s := c.summary()
+	for i := range req.ItemList {
+		item := &req.ItemList[i]
+		l, err := c.Line(item.Prc, item.Qty, Zero, item.TaxTyCd)
+		if err != nil {
+			return fmt.Errorf("item %d: %w", item.ItemSeq, err)
+		}
+		item.SplyAmt, item.TotDcAmt, item.TaxblAmt, item.TaxAmt, item.TotAmt = l.SplyAmt, l.DcAmt, l.TaxblAmt, l.TaxAmt, l.TotAmt
+		s.add(item.TaxTyCd, l)
+	}
+	req.TotItemCnt = len(req.ItemList)
+	req.TotTaxblAmt, req.TotTaxAmt, req.TotAmt = s.TotTaxblAmt, s.TotTaxAmt, s.TotAmt
+	return nil
+}
+
+// checkStockIO checks what the code tables cannot: the fields the spec
+// requires and that the totals match the lines.
+func checkStockIO(req StockIOSaveReq) error {
+	var errs []error
+	if req.SarNo <= 0 {
+		errs = append(errs, errors.New("stock movement needs a sarNo"))
+	}
+	if req.OrgSarNo < 0 {
+		errs = append(errs, errors.New("orgSarNo is negative"))
+	}
+	if !IsStockIn(req.SarTyCd) && !IsStockOut(req.SarTyCd) {
+		errs = append(errs, fmt.Errorf("sarTyCd %q is not a stock in/out type", req.SarTyCd))
+	}
+	if len(req.OcrnDt) != len("20060102") {
+		errs = append(errs, fmt.Errorf("ocrnDt %q is not yyyyMMdd", req.OcrnDt))
+	}
+	if len(req.ItemList) == 0 {
+		errs = append(errs, errors.New("stock movement has no items"))
+	}
+	if req.TotItemCnt != len(req.ItemList) {
+		errs = append(errs, fmt.Errorf("totItemCnt is %d but there are %d items", req.TotItemCnt, len(req.ItemList)))
+	}
+
+	var taxblAmt, taxAmt, totAmt Decimal
+	for _, item := range req.ItemList {
+		if item.ItemClsCd == "" || item.ItemNm == "" {
+			errs = append(errs, fmt.Errorf("item %d needs an itemClsCd and itemNm", item.ItemSeq))
+		}
+		if item.Qty.Sign() <= 0 {
+			errs = append(errs, fmt.Errorf("item %d: qty %s is not positive", item.ItemSeq, item.Qty))
+		}
+		taxblAmt = taxblAmt.Add(item.TaxblAmt)
+		taxAmt = taxAmt.Add(item.TaxAmt)
+		totAmt = totAmt.Add(item.TotAmt)
+	}
+	if taxblAmt != req.TotTaxblAmt {
+		errs = append(errs, fmt.Errorf("totTaxblAmt is %s but the items add up to %s", req.TotTaxblAmt, taxblAmt))
+	}
+	if taxAmt != req.TotTaxAmt {
+		errs = append(errs, fmt.Errorf("totTaxAmt is %s but the items add up to %s", req.TotTaxAmt, taxAmt))
+	}
+	if totAmt != req.TotAmt {
+		errs = append(errs, fmt.Errorf("totAmt is %s but the items add up to %s", req.TotAmt, totAmt))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("etims: invalid stock movement: %w", err)
+	}
+	return nil
+}
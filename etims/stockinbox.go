@@ -0,0 +1,212 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Statuses of a stock movement in the stock movement inbox.
+const (
+	// StockMovePending movements wait for an operator to check them
+	// against the goods received.
+	StockMovePending = "pending"
+	// StockMoveApproved movements are to be posted to the stock ledger.
+	StockMoveApproved = "approved"
+	// StockMoveRejected movements are never posted.
+	StockMoveRejected = "rejected"
+	// StockMovePosted movements are in the stock ledger.
+	StockMovePosted = "posted"
+)
+
+var (
+	// ErrUnknownStockMove is returned when a movement is not in the stock
+	// movement inbox.
+	ErrUnknownStockMove = errors.New("etims: stock movement not in inbox")
+	// ErrStockMovePosted is returned when reviewing a movement that was
+	// already posted.
+	ErrStockMovePosted = errors.New("etims: stock movement already posted")
+	// ErrPurchasedStock is returned for a stock movement from another
+	// taxpayer, whose goods come into stock with the purchase declared for
+	// its supplier invoice rather than with a movement of their own.
+	ErrPurchasedStock = errors.New("etims: stock from another taxpayer comes in with its purchase")
+)
+
+// StockMoveKey identifies a stock movement received by one branch: the
+// sender's sarNo of the sending branch.
+type StockMoveKey struct {
+	Tin       string
+	BhfId     string
+	CustTin   string
+	CustBhfId string
+	SarNo     int64
+}
+
+func (k StockMoveKey) String() string {
+	return branchKey(k.Tin, k.BhfId) + "/" + k.CustTin + "/" + k.CustBhfId + "/" + strconv.FormatInt(k.SarNo, 10)
+}
+
+// Movement returns move, sent by a sibling branch of taxpayer tin, as the
+// incoming movement (04) of branch bhfId, with the sender as customer. The
+// movement still needs its sarNo and orgSarNo. Goods sent by another
+// taxpayer come into stock with their purchase instead, and Movement
+// returns ErrPurchasedStock for them.
+func (m StockMove) Movement(tin, bhfId string) (StockIOSaveReq, error) {
+	if m.CustTin != tin {
+		return StockIOSaveReq{}, fmt.Errorf("%w: stock movement %d from %s", ErrPurchasedStock, m.SarNo, m.CustTin)
+	}
+	req := StockIOSaveReq{
+		Tin:         tin,
+		BhfId:       bhfId,
+		RegTyCd:     RegistrationAutomatic,
+		CustTin:     m.CustTin,
+		CustBhfId:   m.CustBhfId,
+		SarTyCd:     StockInMovement,
+		OcrnDt:      m.OcrnDt,
+		TotItemCnt:  len(m.ItemList),
+		TotTaxblAmt: m.TotTaxblAmt,
+		TotTaxAmt:   m.TotTaxAmt,
+		TotAmt:      m.TotAmt,
+		Remark:      m.Remark,
+	}
+	for _, item := range m.ItemList {
+		req.ItemList = append(req.ItemList, StockIOSaveItem{
+			ItemSeq:    item.ItemSeq,
+			ItemCd:     item.ItemCd,
+			ItemClsCd:  item.ItemClsCd,
+			ItemNm:     item.ItemNm,
+			Bcd:        item.Bcd,
+			PkgUnitCd:  item.PkgUnitCd,
+			Pkg:        item.Pkg,
+			QtyUnitCd:  item.QtyUnitCd,
+			Qty:        item.Qty,
+			ItemExprDt: item.ItemExprDt,
+			Prc:        item.Prc,
+			SplyAmt:    item.SplyAmt,
+			TotDcAmt:   item.TotDcAmt,
+			TaxblAmt:   item.TaxblAmt,
+			TaxTyCd:    item.TaxTyCd,
+			TaxAmt:     item.TaxAmt,
+			TotAmt:     item.TotAmt,
+		})
+	}
+	return req, nil
+}
+
+// InboxStockMove is a stock movement retrieved from /stock/selectStockItems.
+type InboxStockMove struct {
+	Tin    string    `json:"tin"`
+	BhfId  string    `json:"bhfId"`
+	Move   StockMove `json:"move"`
+	Status string    `json:"status"`
+	// Note is the operator's remark, or how the movement was posted.
+	Note       string    `json:"note,omitempty"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Key returns the key of the movement.
+func (m InboxStockMove) Key() StockMoveKey {
+	return StockMoveKey{
+		Tin:       m.Tin,
+		BhfId:     m.BhfId,
+		CustTin:   m.Move.CustTin,
+		CustBhfId: m.Move.CustBhfId,
+		SarNo:     m.Move.SarNo,
+	}
+}
+
+func (m InboxStockMove) inboxKey() string {
+	return m.Key().String()
+}
+
+func (m InboxStockMove) branch() (tin, bhfId string) {
+	return m.Tin, m.BhfId
+}
+
+func (m InboxStockMove) status() string {
+	return m.Status
+}
+
+func (m InboxStockMove) receivedAt() time.Time {
+	return m.ReceivedAt
+}
+
+func (m *InboxStockMove) touch(now time.Time) {
+	m.UpdatedAt = now
+}
+
+// StockMoveInbox keeps the stock movements retrieved by every branch,
+// persisted as a JSON file, until an operator has approved them for the
+// stock ledger or rejected them.
+type StockMoveInbox struct {
+	moves *inbox[InboxStockMove, *InboxStockMove]
+}
+
+// NewStockMoveInbox opens the inbox at path, creating it on first write.
+func NewStockMoveInbox(path string) (*StockMoveInbox, error) {
+	moves, err := openInbox[InboxStockMove](path, "stock movement inbox", ErrUnknownStockMove)
+	if err != nil {
+		return nil, err
+	}
+	return &StockMoveInbox{moves: moves}, nil
+}
+
+// Add stores the movements retrieved by the branch as pending and returns
+// how many were new. Movements already in the inbox are left as they are,
+// so retrieving the same list again changes nothing.
+func (in *StockMoveInbox) Add(ctx context.Context, tin, bhfId string, moves []StockMove) (int, error) {
+	now := time.Now()
+	entries := make([]InboxStockMove, 0, len(moves))
+	for _, move := range moves {
+		entries = append(entries, InboxStockMove{
+			Tin:        tin,
+			BhfId:      bhfId,
+			Move:       move,
+			Status:     StockMovePending,
+			ReceivedAt: now,
+			UpdatedAt:  now,
+		})
+	}
+	return in.moves.add(entries)
+}
+
+// Approve marks a movement as matching the goods received, to be posted to
+// the stock ledger.
+func (in *StockMoveInbox) Approve(ctx context.Context, key StockMoveKey, note string) error {
+	return in.setStatus(key, StockMoveApproved, note)
+}
+
+// Reject marks a movement as not to be posted.
+func (in *StockMoveInbox) Reject(ctx context.Context, key StockMoveKey, note string) error {
+	return in.setStatus(key, StockMoveRejected, note)
+}
+
+// MarkPosted records that the movement is in the stock ledger and how it
+// got there.
+func (in *StockMoveInbox) MarkPosted(ctx context.Context, key StockMoveKey, note string) error {
+	return in.setStatus(key, StockMovePosted, note)
+}
+
+func (in *StockMoveInbox) setStatus(key StockMoveKey, status, note string) error {
+	return in.moves.update(key, func(m *InboxStockMove) error {
+		if m.Status == StockMovePosted {
+			return fmt.Errorf("%w: %s", ErrStockMovePosted, key)
+		}
+		m.Status, m.Note = status, note
+		return nil
+	})
+}
+
+// StockMove returns a movement of the inbox.
+func (in *StockMoveInbox) StockMove(key StockMoveKey) (InboxStockMove, bool) {
+	return in.moves.get(key)
+}
+
+// List returns the movements of the branch with the given statuses, or all
+// of them if none are given, oldest first.
+func (in *StockMoveInbox) List(tin, bhfId string, statuses ...string) []InboxStockMove {
+	return in.moves.list(tin, bhfId, statuses...)
+}
@@ -0,0 +1,130 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StockService declares the stock movements of one branch and keeps the
+// ledger, and the remaining quantities the VSCU holds, in step with them:
+// a movement is declared with saveStockItems under the next sarNo of the
+// branch, posted to the ledger once accepted, and the remaining quantity of
+// its items is reported with saveStockMaster. Whatever the VSCU cannot be
+// reached for is queued in the outbox.
+type StockService struct {
+	client  *Client
+	numbers *Sequencer
+	outbox  *Outbox
+	ledger  *StockLedger
+}
+
+// NewStockService returns the stock service of the client's branch.
+func NewStockService(client *Client, numbers *Sequencer, outbox *Outbox, ledger *StockLedger) *StockService {
+	return &StockService{client: client, numbers: numbers, outbox: outbox, ledger: ledger}
+}
+
+// Declare declares a stock movement under the next sarNo of the branch and,
+// once accepted, posts it. ref is the document the movement comes from, if
+// any, so that it is declared only once: a ref whose number is confirmed or
+// queued is not declared again, but one whose number was voided is, under a
+// new number. It returns the sarNo of the movement, which is 0 only if it
+// has none, together with any error.
+func (s *StockService) Declare(ctx context.Context, movement StockIOSaveReq, ref string) (int64, error) {
+	s.client.identify(&movement.Tin, &movement.BhfId)
+	key := SequenceKey{Tin: movement.Tin, BhfId: movement.BhfId, Kind: SequenceStock}
+	log := s.client.logger.WithField("sar_ty_cd", movement.SarTyCd)
+
+	base, resend := ref, false
+	sarNo, err := s.numbers.Next(ctx, key, ref)
+	for attempt := 2; errors.Is(err, ErrDuplicateReference); attempt++ {
+		n, _ := s.numbers.Lookup(key, ref)
+		log := log.WithFields(logrus.Fields{"ref": ref, "sar_no": n.No})
+		switch n.State {
+		case NumberConfirmed:
+			// Declared on an earlier run, which may have stopped before
+			// posting it; posting it again changes nothing.
+			log.Info("Stock movement already declared")
+			movement.SarNo, movement.OrgSarNo = n.No, n.No
+			return n.No, s.Post(ctx, movement)
+		case NumberVoided:
+			// Never declared: the movement takes a new number.
+			ref = fmt.Sprintf("%s#%d", base, attempt)
+			sarNo, err = s.numbers.Next(ctx, key, ref)
+		default:
+			if s.outbox.Queued(movement.Tin, movement.BhfId, PathSaveStockItems, n.No) {
+				log.Info("Stock movement already queued")
+				return n.No, nil
+			}
+			// Numbered on an earlier run, which may have stopped before or
+			// after sending it.
+			sarNo, err, resend = n.No, nil, true
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate stock movement number: %w", err)
+	}
+	// A new movement is its own original.
+	movement.SarNo, movement.OrgSarNo = sarNo, sarNo
+	log = log.WithField("sar_no", sarNo)
+
+	_, err = s.client.SaveStockItems(ctx, movement)
+	switch {
+	case IsTransport(err):
+		if _, err := s.outbox.EnqueueStockItems(ctx, movement); err != nil {
+			return 0, fmt.Errorf("failed to queue stock movement: %w", err)
+		}
+		log.Warn("VSCU unreachable, stock movement queued in outbox")
+		return sarNo, nil
+	case resend && IsDuplicate(err):
+		// The earlier run's request reached the VSCU, which holds the
+		// number already.
+		log.Info("Stock movement already held by the VSCU")
+	case err != nil:
+		if verr := s.numbers.Void(ctx, key, sarNo, err.Error()); verr != nil {
+			log.WithError(verr).Error("Failed to void stock movement number")
+		}
+		return 0, err
+	default:
+		log.Info("Stock movement declared")
+	}
+	if err := s.numbers.Confirm(ctx, key, sarNo); err != nil {
+		return 0, err
+	}
+	return sarNo, s.Post(ctx, movement)
+}
+
+// Post posts a stock movement accepted by the VSCU to the ledger and
+// reports the remaining quantity of its items. It is what Declare does once
+// a movement is accepted, for movements the outbox delivered.
+func (s *StockService) Post(ctx context.Context, movement StockIOSaveReq) error {
+	if err := s.ledger.Post(ctx, movement); err != nil {
+		return err
+	}
+	return s.report(ctx, movement)
+}
+
+// report reports the remaining quantity of the items of a posted movement
+// with saveStockMaster.
+func (s *StockService) report(ctx context.Context, movement StockIOSaveReq) error {
+	var errs []error
+	for _, req := range s.ledger.StockMaster(movement) {
+		log := s.client.logger.WithFields(logrus.Fields{"item_cd": req.ItemCd, "rsd_qty": req.RsdQty})
+		_, err := s.client.SaveStockMaster(ctx, req)
+		switch {
+		case IsTransport(err):
+			if _, err := s.outbox.EnqueueStockMaster(ctx, req); err != nil {
+				errs = append(errs, fmt.Errorf("failed to queue stock master: %w", err))
+				continue
+			}
+			log.Warn("VSCU unreachable, stock master queued in outbox")
+		case err != nil:
+			errs = append(errs, fmt.Errorf("stock master of %s: %w", req.ItemCd, err))
+		default:
+			log.Info("Stock master updated")
+		}
+	}
+	return errors.Join(errs...)
+}
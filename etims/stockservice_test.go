@@ -0,0 +1,215 @@
+package etims
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeStockVSCU is the VSCU of branch bhfId. It answers saveStockItems for
+// sarNo with the HTTP status or result code in answers, and everything else
+// with 000. It counts the stock movements it was sent.
+func fakeStockVSCU(t *testing.T, bhfId string, answers map[int64]string, sent *int) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		answer := ResultSuccess
+		if r.URL.Path == PathSaveStockItems {
+			*sent++
+			var req StockIOSaveReq
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &req)
+			if a, ok := answers[req.SarNo]; ok {
+				answer = a
+			}
+		}
+		if answer == "500" {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, `{"resultCd":%q,"resultMsg":"test","resultDt":"20240101000000"}`, answer)
+	}))
+	t.Cleanup(srv.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	c, err := New(
+		WithBaseURL(srv.URL),
+		WithTIN(testTin),
+		WithBranchID(bhfId),
+		WithLogger(logger),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testMovement() StockIOSaveReq {
+	item := StockIOSaveItem{
+		ItemSeq:   1,
+		ItemCd:    "KE1NTXU0000001",
+		ItemClsCd: "5022110801",
+		ItemNm:    "Test Item",
+		Qty:       NewDecimal(2),
+		Prc:       NewDecimal(100),
+		SplyAmt:   NewDecimal(200),
+		TaxblAmt:  NewDecimal(200),
+		TotAmt:    NewDecimal(200),
+	}
+	return StockIOSaveReq{
+		Tin:         testTin,
+		BhfId:       testBhfId,
+		SarTyCd:     StockInAdjustment,
+		OcrnDt:      "20240101",
+		TotItemCnt:  1,
+		TotTaxblAmt: item.TaxblAmt,
+		TotAmt:      item.TotAmt,
+		ItemList:    []StockIOSaveItem{item},
+	}
+}
+
+func TestStockServiceDeclare(t *testing.T) {
+	ctx := context.Background()
+	key := SequenceKey{Tin: testTin, BhfId: testBhfId, Kind: SequenceStock}
+
+	tests := []struct {
+		name string
+		// earlier sets the numbers up as an earlier run left them.
+		earlier func(s *Sequencer, o *Outbox)
+		answers map[int64]string
+		want    int64
+		wantErr bool
+		sent    int
+		// rsdQty is the remaining quantity in the ledger afterwards.
+		rsdQty string
+		state  string
+		queued bool
+	}{
+		{
+			name:   "declared",
+			want:   1,
+			sent:   1,
+			rsdQty: "2.00",
+			state:  NumberConfirmed,
+		},
+		{
+			name:    "rejected",
+			answers: map[int64]string{1: ResultParameter},
+			wantErr: true,
+			sent:    1,
+			rsdQty:  "0.00",
+			state:   NumberVoided,
+		},
+		{
+			name:    "unreachable",
+			answers: map[int64]string{1: "500"},
+			want:    1,
+			sent:    1,
+			rsdQty:  "0.00",
+			state:   NumberAllocated,
+			queued:  true,
+		},
+		{
+			name: "declared on an earlier run",
+			earlier: func(s *Sequencer, o *Outbox) {
+				s.Next(ctx, key, "doc")
+				s.Confirm(ctx, key, 1)
+			},
+			want:   1,
+			rsdQty: "2.00",
+			state:  NumberConfirmed,
+		},
+		{
+			name: "queued on an earlier run",
+			earlier: func(s *Sequencer, o *Outbox) {
+				s.Next(ctx, key, "doc")
+				m := testMovement()
+				m.SarNo = 1
+				o.EnqueueStockItems(ctx, m)
+			},
+			want:   1,
+			rsdQty: "0.00",
+			state:  NumberAllocated,
+			queued: true,
+		},
+		{
+			name: "numbered but not sent",
+			earlier: func(s *Sequencer, o *Outbox) {
+				s.Next(ctx, key, "doc")
+			},
+			want:   1,
+			sent:   1,
+			rsdQty: "2.00",
+			state:  NumberConfirmed,
+		},
+		{
+			name: "sent but not confirmed",
+			earlier: func(s *Sequencer, o *Outbox) {
+				s.Next(ctx, key, "doc")
+			},
+			answers: map[int64]string{1: ResultOverlappedData},
+			want:    1,
+			sent:    1,
+			rsdQty:  "2.00",
+			state:   NumberConfirmed,
+		},
+		{
+			name: "voided on an earlier run",
+			earlier: func(s *Sequencer, o *Outbox) {
+				s.Next(ctx, key, "doc")
+				s.Void(ctx, key, 1, "test")
+			},
+			want:   2,
+			sent:   1,
+			rsdQty: "2.00",
+			state:  NumberVoided,
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		numbers, err := OpenSequencer(filepath.Join(dir, "sequences.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outbox, err := OpenOutbox(filepath.Join(dir, "outbox.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger, err := NewStockLedger(filepath.Join(dir, "stock.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.earlier != nil {
+			tt.earlier(numbers, outbox)
+		}
+		sent := 0
+		s := NewStockService(fakeStockVSCU(t, testBhfId, tt.answers, &sent), numbers, outbox, ledger)
+
+		got, err := s.Declare(ctx, testMovement(), "doc")
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: Declare = %d, %v, want %d, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+		if sent != tt.sent {
+			t.Errorf("%s: sent %d movements, want %d", tt.name, sent, tt.sent)
+		}
+		if q := ledger.RsdQty(testTin, testBhfId, "KE1NTXU0000001"); q.String() != tt.rsdQty {
+			t.Errorf("%s: rsdQty %s, want %s", tt.name, q, tt.rsdQty)
+		}
+		if n, _ := numbers.Lookup(key, "doc"); n.State != tt.state {
+			t.Errorf("%s: number of doc is %s, want %s", tt.name, n.State, tt.state)
+		}
+		if q := outbox.Queued(testTin, testBhfId, PathSaveStockItems, 1); q != tt.queued {
+			t.Errorf("%s: queued %v, want %v", tt.name, q, tt.queued)
+		}
+		numbers.Close()
+		outbox.Close()
+	}
+}
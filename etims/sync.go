@@ -0,0 +1,113 @@
+package etims
+
+import (
+	"context"
+	"fmt"
+)
+
+// Syncer runs the incremental lookup routes for the client's branch. Each
+// sync sends the stored watermark as lastReqDt, hands the returned data to
+// a save callback and only then advances the watermark to the response's
+// resultDt, so data is never skipped when saving fails.
+type Syncer struct {
+	client *Client
+	store  WatermarkStore
+}
+
+// NewSyncer returns a Syncer that keeps its watermarks in store.
+func NewSyncer(client *Client, store WatermarkStore) *Syncer {
+	return &Syncer{client: client, store: store}
+}
+
+// SaveFunc persists data returned by a sync. It is not called when the VSCU
+// has nothing new (result code 001).
+type SaveFunc[T any] func(ctx context.Context, data *T) error
+
+// SyncCodes retrieves the code tables changed since the last sync.
+func (s *Syncer) SyncCodes(ctx context.Context, save SaveFunc[CodeRes]) (*Result, error) {
+	return syncKind(ctx, s, PathSelectCodes, func(lastReqDt string) (*Response[CodeRes], error) {
+		return s.client.SelectCodes(ctx, CodeRequest{LastReqDt: lastReqDt})
+	}, save)
+}
+
+// SyncItemClasses retrieves the item classifications changed since the last
+// sync.
+func (s *Syncer) SyncItemClasses(ctx context.Context, save SaveFunc[ItemClsRes]) (*Result, error) {
+	return syncKind(ctx, s, PathSelectItemsClass, func(lastReqDt string) (*Response[ItemClsRes], error) {
+		return s.client.SelectItemsClass(ctx, ItemClassRequest{LastReqDt: lastReqDt})
+	}, save)
+}
+
+// SyncBranches retrieves the branches changed since the last sync.
+func (s *Syncer) SyncBranches(ctx context.Context, save SaveFunc[BhfRes]) (*Result, error) {
+	return syncKind(ctx, s, PathSelectBranches, func(lastReqDt string) (*Response[BhfRes], error) {
+		return s.client.SelectBranches(ctx, BranchRequest{LastReqDt: lastReqDt})
+	}, save)
+}
+
+// SyncNotices retrieves the notices published since the last sync.
+func (s *Syncer) SyncNotices(ctx context.Context, save SaveFunc[NoticeRes]) (*Result, error) {
+	return syncKind(ctx, s, PathSelectNotices, func(lastReqDt string) (*Response[NoticeRes], error) {
+		return s.client.SelectNotices(ctx, NoticeRequest{LastReqDt: lastReqDt})
+	}, save)
+}
+
+// SyncItems retrieves the items changed since the last sync.
+func (s *Syncer) SyncItems(ctx context.Context, save SaveFunc[ItemRes]) (*Result, error) {
+	return syncKind(ctx, s, PathSelectItems, func(lastReqDt string) (*Response[ItemRes], error) {
+		return s.client.SelectItems(ctx, GetItemRequest{LastReqDt: lastReqDt})
+	}, save)
+}
+
+// SyncImportItems retrieves the customs import items changed since the last
+// sync.
+func (s *Syncer) SyncImportItems(ctx context.Context, save SaveFunc[ImptItemRes]) (*Result, error) {
+	return syncKind(ctx, s, PathSelectImportItems, func(lastReqDt string) (*Response[ImptItemRes], error) {
+		return s.client.SelectImportItems(ctx, ImportItemRequest{LastReqDt: lastReqDt})
+	}, save)
+}
+
+// SyncPurchaseSales retrieves the supplier sales declared against this
+// taxpayer since the last sync.
+func (s *Syncer) SyncPurchaseSales(ctx context.Context, save SaveFunc[TrnsPurchaseSalesRes]) (*Result, error) {
+	return syncKind(ctx, s, PathSelectTrnsPurchaseSales, func(lastReqDt string) (*Response[TrnsPurchaseSalesRes], error) {
+		return s.client.SelectTrnsPurchaseSales(ctx, PurchaseRequest{LastReqDt: lastReqDt})
+	}, save)
+}
+
+// SyncStockMoves retrieves the stock movements declared since the last sync.
+func (s *Syncer) SyncStockMoves(ctx context.Context, save SaveFunc[StockMoveRes]) (*Result, error) {
+	return syncKind(ctx, s, PathSelectStockItems, func(lastReqDt string) (*Response[StockMoveRes], error) {
+		return s.client.SelectStockItems(ctx, StockMovementRequest{LastReqDt: lastReqDt})
+	}, save)
+}
+
+func syncKind[T any](ctx context.Context, s *Syncer, endpoint string, fetch func(lastReqDt string) (*Response[T], error), save SaveFunc[T]) (*Result, error) {
+	key := WatermarkKey{Tin: s.client.tin, BhfId: s.client.bhfId, Endpoint: endpoint}
+
+	lastReqDt, err := s.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if lastReqDt == "" {
+		lastReqDt = DefaultLastReqDt
+	}
+
+	res, err := fetch(lastReqDt)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Data != nil {
+		if err := save(ctx, res.Data); err != nil {
+			return nil, fmt.Errorf("failed to save %s data: %w", endpoint, err)
+		}
+	}
+
+	if res.ResultDt != "" {
+		if err := s.store.Set(ctx, key, res.ResultDt); err != nil {
+			return nil, err
+		}
+	}
+	return &res.Result, nil
+}
@@ -0,0 +1,198 @@
+package etims
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Tax types (spec 4.1).
+const (
+	TaxTypeA = "A" // Exempt
+	TaxTypeB = "B" // 16%
+	TaxTypeC = "C" // 0%
+	TaxTypeD = "D" // Non-VAT
+	TaxTypeE = "E" // 8%
+)
+
+// TaxTypes are the tax types a sales invoice carries totals for, in the
+// order of its taxblAmtA..E fields.
+var TaxTypes = []string{TaxTypeA, TaxTypeB, TaxTypeC, TaxTypeD, TaxTypeE}
+
+// ErrNoTaxRates is returned when the tax type code table has not been
+// downloaded yet.
+var ErrNoTaxRates = errors.New("etims: tax type codes not downloaded")
+
+// Pricing says whether unit prices include tax.
+type Pricing int
+
+const (
+	// TaxInclusive prices include tax, as on a shelf label. The taxable
+	// amount of a line is what the customer pays and the tax is the part
+	// of it due to KRA.
+	TaxInclusive Pricing = iota
+	// TaxExclusive prices are net of tax. The tax is added on top of the
+	// taxable amount.
+	TaxExclusive
+)
+
+// TaxLine is the amounts of one invoice line.
+type TaxLine struct {
+	SplyAmt  Decimal
+	DcAmt    Decimal
+	TaxblAmt Decimal
+	TaxAmt   Decimal
+	TotAmt   Decimal
+}
+
+// TaxBucket is the totals of one tax type.
+type TaxBucket struct {
+	TaxblAmt Decimal
+	TaxRt    Decimal
+	TaxAmt   Decimal
+}
+
+// TaxSummary is the invoice totals, per tax type and overall.
+type TaxSummary struct {
+	A, B, C, D, E TaxBucket
+	TotTaxblAmt   Decimal
+	TotTaxAmt     Decimal
+	TotAmt        Decimal
+}
+
+// bucket returns the totals of tax type taxTyCd.
+func (s *TaxSummary) bucket(taxTyCd string) *TaxBucket {
+	switch taxTyCd {
+	case TaxTypeA:
+		return &s.A
+	case TaxTypeB:
+		return &s.B
+	case TaxTypeC:
+		return &s.C
+	case TaxTypeD:
+		return &s.D
+	case TaxTypeE:
+		return &s.E
+	}
+	return nil
+}
+
+// TaxCalculator computes invoice line amounts and totals. Rates are the
+// ones published in the tax type code table (code class 04), where
+// userDfnCd1 holds the rate in percent. Tax types without a rate there
+// cannot be used.
+type TaxCalculator struct {
+	pricing  Pricing
+	rounding Rounding
+	rates    map[string]Decimal
+}
+
+// NewTaxCalculator returns a calculator using the tax rates downloaded into
+// codes. Amounts are rounded to the cent with rounding.
+func NewTaxCalculator(codes *CodeRepository, pricing Pricing, rounding Rounding) (*TaxCalculator, error) {
+	t := codes.CodeTable(CodeClsTaxType)
+	if t == nil {
+		return nil, ErrNoTaxRates
+	}
+	rates := make(map[string]Decimal)
+	for _, dtl := range t.Codes() {
+		if dtl.UserDfnCd1 == "" {
+			continue
+		}
+		rt, err := ParseDecimal(dtl.UserDfnCd1, rounding)
+		if err != nil {
+			return nil, fmt.Errorf("etims: tax type %s has no valid rate %q", dtl.Cd, dtl.UserDfnCd1)
+		}
+		rates[dtl.Cd] = rt
+	}
+	return &TaxCalculator{pricing: pricing, rounding: rounding, rates: rates}, nil
+}
+
+// Rate returns the rate of tax type taxTyCd in percent.
+func (c *TaxCalculator) Rate(taxTyCd string) (Decimal, bool) {
+	rt, ok := c.rates[taxTyCd]
+	return rt, ok
+}
+
+// Line computes the amounts of qty units at unit price prc, less a discount
+// of dcRt percent. Every amount is rounded to the cent, so the totals of
+// an invoice add up to the sum of its lines. Amounts too large for a
+// Decimal fail with ErrDecimalRange.
+func (c *TaxCalculator) Line(prc, qty, dcRt Decimal, taxTyCd string) (TaxLine, error) {
+	rt, ok := c.rates[taxTyCd]
+	if !ok {
+		return TaxLine{}, fmt.Errorf("%w: taxTyCd %q is not in code class %s", ErrUnknownCode, taxTyCd, CodeClsTaxType)
+	}
+
+	var l TaxLine
+	var err error
+	r := c.rounding
+	if l.SplyAmt, err = prc.Mul(qty, r); err != nil {
+		return TaxLine{}, err
+	}
+	if l.DcAmt, err = l.SplyAmt.Percent(dcRt, r); err != nil {
+		return TaxLine{}, err
+	}
+	l.TaxblAmt = l.SplyAmt.Sub(l.DcAmt)
+	switch c.pricing {
+	case TaxInclusive:
+		l.TaxAmt, err = l.TaxblAmt.MulDiv(rt, Hundred.Add(rt), r)
+		l.TotAmt = l.TaxblAmt
+	case TaxExclusive:
+		l.TaxAmt, err = l.TaxblAmt.Percent(rt, r)
+		l.TotAmt = l.TaxblAmt.Add(l.TaxAmt)
+	}
+	if err != nil {
+		return TaxLine{}, err
+	}
+	return l, nil
+}
+
+// add adds line l of tax type taxTyCd to the totals.
+func (s *TaxSummary) add(taxTyCd string, l TaxLine) {
+	b := s.bucket(taxTyCd)
+	if b != nil {
+		b.TaxblAmt = b.TaxblAmt.Add(l.TaxblAmt)
+		b.TaxAmt = b.TaxAmt.Add(l.TaxAmt)
+	}
+	s.TotTaxblAmt = s.TotTaxblAmt.Add(l.TaxblAmt)
+	s.TotTaxAmt = s.TotTaxAmt.Add(l.TaxAmt)
+	s.TotAmt = s.TotAmt.Add(l.TotAmt)
+}
+
+// summary returns empty totals carrying the rate of every tax type.
+func (c *TaxCalculator) summary() TaxSummary {
+	var s TaxSummary
+	for _, cd := range TaxTypes {
+		s.bucket(cd).TaxRt = c.rates[cd]
+	}
+	return s
+}
+
+// ApplySales computes the amounts of every line of req from its prc, qty,
+// dcRt and taxTyCd, and fills in the invoice totals, including totItemCnt.
+func (c *TaxCalculator) ApplySales(req *TrnsSalesSaveWrReq) error {
+	s := c.summary()
+	for i := range req.ItemList {
+		item := &req.ItemList[i]
+		l, err := c.Line(item.Prc, item.Qty, item.DcRt, item.TaxTyCd)
+		if err != nil {
+			return fmt.Errorf("item %d: %w", item.ItemSeq, err)
+		}
+		item.SplyAmt, item.DcAmt, item.TaxblAmt, item.TaxAmt, item.TotAmt = l.SplyAmt, l.DcAmt, l.TaxblAmt, l.TaxAmt, l.TotAmt
+		s.add(item.TaxTyCd, l)
+	}
+
+	s.fill(req)
+	return nil
+}
+
+// fill copies the totals into the header of req, including totItemCnt.
+func (s *TaxSummary) fill(req *TrnsSalesSaveWrReq) {
+	req.TotItemCnt = len(req.ItemList)
+	req.TaxblAmtA, req.TaxRtA, req.TaxAmtA = s.A.TaxblAmt, s.A.TaxRt, s.A.TaxAmt
+	req.TaxblAmtB, req.TaxRtB, req.TaxAmtB = s.B.TaxblAmt, s.B.TaxRt, s.B.TaxAmt
+	req.TaxblAmtC, req.TaxRtC, req.TaxAmtC = s.C.TaxblAmt, s.C.TaxRt, s.C.TaxAmt
+	req.TaxblAmtD, req.TaxRtD, req.TaxAmtD = s.D.TaxblAmt, s.D.TaxRt, s.D.TaxAmt
+	req.TaxblAmtE, req.TaxRtE, req.TaxAmtE = s.E.TaxblAmt, s.E.TaxRt, s.E.TaxAmt
+	req.TotTaxblAmt, req.TotTaxAmt, req.TotAmt = s.TotTaxblAmt, s.TotTaxAmt, s.TotAmt
+}
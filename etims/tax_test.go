@@ -0,0 +1,158 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// taxCodes returns a code repository holding the tax type table, with the
+// rates of spec 4.1.
+func taxCodes(t *testing.T) *CodeRepository {
+	t.Helper()
+	codes, err := NewCodeRepository(filepath.Join(t.TempDir(), "codes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = codes.Save(context.Background(), &CodeRes{ClsList: []CodeCls{{
+		CdCls: CodeClsTaxType,
+		DtlList: []CodeDtl{
+			{Cd: TaxTypeA, CdNm: "A-Exempt", UserDfnCd1: "0"},
+			{Cd: TaxTypeB, CdNm: "B-16.00%", UserDfnCd1: "16"},
+			{Cd: TaxTypeC, CdNm: "C-0%", UserDfnCd1: "0"},
+			{Cd: TaxTypeD, CdNm: "D-Non-VAT", UserDfnCd1: "0"},
+			{Cd: TaxTypeE, CdNm: "E-8%", UserDfnCd1: "8"},
+		},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codes
+}
+
+func TestTaxCalculatorLine(t *testing.T) {
+	codes := taxCodes(t)
+	tests := []struct {
+		name    string
+		pricing Pricing
+		prc     string
+		qty     string
+		dcRt    string
+		taxTyCd string
+		want    [5]string // splyAmt, dcAmt, taxblAmt, taxAmt, totAmt
+	}{
+		{"inclusive A", TaxInclusive, "500", "2", "0", TaxTypeA, [5]string{"1000.00", "0.00", "1000.00", "0.00", "1000.00"}},
+		{"inclusive B", TaxInclusive, "1160", "1", "0", TaxTypeB, [5]string{"1160.00", "0.00", "1160.00", "160.00", "1160.00"}},
+		{"inclusive B rounded", TaxInclusive, "99.99", "1", "0", TaxTypeB, [5]string{"99.99", "0.00", "99.99", "13.79", "99.99"}},
+		{"inclusive B discounted", TaxInclusive, "580", "2", "10", TaxTypeB, [5]string{"1160.00", "116.00", "1044.00", "144.00", "1044.00"}},
+		{"inclusive C", TaxInclusive, "250", "4", "0", TaxTypeC, [5]string{"1000.00", "0.00", "1000.00", "0.00", "1000.00"}},
+		{"inclusive D", TaxInclusive, "75.5", "2", "0", TaxTypeD, [5]string{"151.00", "0.00", "151.00", "0.00", "151.00"}},
+		{"inclusive E", TaxInclusive, "108", "2", "0", TaxTypeE, [5]string{"216.00", "0.00", "216.00", "16.00", "216.00"}},
+		{"exclusive A", TaxExclusive, "500", "2", "0", TaxTypeA, [5]string{"1000.00", "0.00", "1000.00", "0.00", "1000.00"}},
+		{"exclusive B", TaxExclusive, "1000", "1", "0", TaxTypeB, [5]string{"1000.00", "0.00", "1000.00", "160.00", "1160.00"}},
+		{"exclusive B rounded", TaxExclusive, "0.33", "3", "0", TaxTypeB, [5]string{"0.99", "0.00", "0.99", "0.16", "1.15"}},
+		{"exclusive C", TaxExclusive, "250", "4", "0", TaxTypeC, [5]string{"1000.00", "0.00", "1000.00", "0.00", "1000.00"}},
+		{"exclusive D", TaxExclusive, "75.5", "2", "0", TaxTypeD, [5]string{"151.00", "0.00", "151.00", "0.00", "151.00"}},
+		{"exclusive E discounted", TaxExclusive, "100", "3", "10", TaxTypeE, [5]string{"300.00", "30.00", "270.00", "21.60", "291.60"}},
+	}
+	for _, tt := range tests {
+		c, err := NewTaxCalculator(codes, tt.pricing, RoundHalfUp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := c.Line(MustParseDecimal(tt.prc), MustParseDecimal(tt.qty), MustParseDecimal(tt.dcRt), tt.taxTyCd)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got := [5]string{l.SplyAmt.String(), l.DcAmt.String(), l.TaxblAmt.String(), l.TaxAmt.String(), l.TotAmt.String()}
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTaxCalculatorApplySales(t *testing.T) {
+	codes := taxCodes(t)
+	items := func() []TrnsSalesSaveWrItem {
+		return []TrnsSalesSaveWrItem{
+			{ItemSeq: 1, Prc: NewDecimal(1160), Qty: NewDecimal(1), TaxTyCd: TaxTypeB},
+			{ItemSeq: 2, Prc: MustParseDecimal("99.99"), Qty: NewDecimal(1), TaxTyCd: TaxTypeB},
+			{ItemSeq: 3, Prc: NewDecimal(500), Qty: NewDecimal(2), TaxTyCd: TaxTypeA},
+			{ItemSeq: 4, Prc: NewDecimal(108), Qty: NewDecimal(2), TaxTyCd: TaxTypeE},
+		}
+	}
+	tests := []struct {
+		pricing Pricing
+		// taxblAmt and taxAmt of A..E, then totTaxblAmt, totTaxAmt, totAmt.
+		want [13]string
+	}{
+		{TaxInclusive, [13]string{
+			"1000.00", "0.00",
+			"1259.99", "173.79",
+			"0.00", "0.00",
+			"0.00", "0.00",
+			"216.00", "16.00",
+			"2475.99", "189.79", "2475.99",
+		}},
+		{TaxExclusive, [13]string{
+			"1000.00", "0.00",
+			"1259.99", "201.60",
+			"0.00", "0.00",
+			"0.00", "0.00",
+			"216.00", "17.28",
+			"2475.99", "218.88", "2694.87",
+		}},
+	}
+	for _, tt := range tests {
+		c, err := NewTaxCalculator(codes, tt.pricing, RoundHalfUp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := TrnsSalesSaveWrReq{ItemList: items()}
+		if err := c.ApplySales(&req); err != nil {
+			t.Fatalf("pricing %d: %v", tt.pricing, err)
+		}
+		got := [13]string{
+			req.TaxblAmtA.String(), req.TaxAmtA.String(),
+			req.TaxblAmtB.String(), req.TaxAmtB.String(),
+			req.TaxblAmtC.String(), req.TaxAmtC.String(),
+			req.TaxblAmtD.String(), req.TaxAmtD.String(),
+			req.TaxblAmtE.String(), req.TaxAmtE.String(),
+			req.TotTaxblAmt.String(), req.TotTaxAmt.String(), req.TotAmt.String(),
+		}
+		if got != tt.want {
+			t.Errorf("pricing %d: totals = %v, want %v", tt.pricing, got, tt.want)
+		}
+		if req.TotItemCnt != 4 || req.TaxRtB.String() != "16.00" || req.TaxRtE.String() != "8.00" {
+			t.Errorf("pricing %d: totItemCnt %d, taxRtB %s, taxRtE %s", tt.pricing, req.TotItemCnt, req.TaxRtB, req.TaxRtE)
+		}
+	}
+}
+
+func TestTaxCalculatorErrors(t *testing.T) {
+	empty, err := NewCodeRepository(filepath.Join(t.TempDir(), "codes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTaxCalculator(empty, TaxInclusive, RoundHalfUp); !errors.Is(err, ErrNoTaxRates) {
+		t.Errorf("NewTaxCalculator without codes: %v, want %v", err, ErrNoTaxRates)
+	}
+
+	c, err := NewTaxCalculator(taxCodes(t), TaxInclusive, RoundHalfUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Line(NewDecimal(1), NewDecimal(1), Zero, "Z"); !errors.Is(err, ErrUnknownCode) {
+		t.Errorf("Line with unknown tax type: %v, want %v", err, ErrUnknownCode)
+	}
+	if _, err := c.Line(Cents(math.MaxInt64), NewDecimal(2), Zero, TaxTypeB); !errors.Is(err, ErrDecimalRange) {
+		t.Errorf("Line out of range: %v, want %v", err, ErrDecimalRange)
+	}
+	req := TrnsSalesSaveWrReq{ItemList: []TrnsSalesSaveWrItem{{ItemSeq: 1, Prc: NewDecimal(math.MaxInt64 / 1000), Qty: NewDecimal(1000), TaxTyCd: TaxTypeB}}}
+	if err := c.ApplySales(&req); !errors.Is(err, ErrDecimalRange) {
+		t.Errorf("ApplySales out of range: %v, want %v", err, ErrDecimalRange)
+	}
+}
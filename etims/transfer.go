@@ -0,0 +1,329 @@
+package etims
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StockTransfer is stock moved from one branch of the taxpayer to another:
+// an outgoing movement (13) at the source and an incoming movement (04) at
+// the destination, each naming the other branch as custBhfId.
+type StockTransfer struct {
+	Tin       string `json:"tin"`
+	FromBhfId string `json:"fromBhfId"`
+	ToBhfId   string `json:"toBhfId"`
+	// OutSarNo and InSarNo are the sarNo of the movement at the source and
+	// at the destination. InSarNo is 0 until the destination's movement is
+	// declared.
+	OutSarNo int64 `json:"outSarNo"`
+	InSarNo  int64 `json:"inSarNo"`
+	// ReturnSarNo is the sarNo of the adjustment (06) that put the stock
+	// back at the source when the destination's movement was rejected.
+	ReturnSarNo int64             `json:"returnSarNo,omitempty"`
+	Note        string            `json:"note,omitempty"`
+	Items       []StockIOSaveItem `json:"items"`
+	DeclaredAt  time.Time         `json:"declaredAt"`
+	// ReceivedAt is when the destination found the transfer in its stock
+	// movements from the VSCU, if it has.
+	ReceivedAt *time.Time `json:"receivedAt,omitempty"`
+}
+
+// Pending reports whether the destination's side of the transfer is still
+// to be declared.
+func (t StockTransfer) Pending() bool {
+	return t.InSarNo == 0 && t.ReturnSarNo == 0
+}
+
+// Ref returns the reference the destination's side of the transfer, or the
+// return of its stock to the source, is numbered under, so declaring it
+// again finds the number already allocated.
+func (t StockTransfer) Ref(side string) string {
+	return "transfer/" + transferKey(t.Tin, t.FromBhfId, t.OutSarNo) + "/" + side
+}
+
+// Movements returns the movements of the transfer at the source and at the
+// destination, as TransferMovements does, with the source's sarNo.
+func (t StockTransfer) Movements() (out, in StockIOSaveReq) {
+	out, in = TransferMovements(t.Tin, t.FromBhfId, t.ToBhfId, t.Items)
+	out.SarNo, out.OrgSarNo = t.OutSarNo, t.OutSarNo
+	return out, in
+}
+
+// ReturnMovement returns the adjustment (06) putting the stock of a
+// transfer the destination could not declare back at the source. It still
+// needs its sarNo and orgSarNo.
+func (t StockTransfer) ReturnMovement() StockIOSaveReq {
+	out, _ := t.Movements()
+	ret := out
+	ret.SarNo, ret.OrgSarNo = 0, 0
+	ret.SarTyCd = StockInAdjustment
+	ret.Remark = fmt.Sprintf("Return of transfer %d to branch %s", t.OutSarNo, t.ToBhfId)
+	ret.ItemList = append([]StockIOSaveItem(nil), out.ItemList...)
+	return ret
+}
+
+// TransferMovements returns the two movements of a transfer of lines from
+// branch fromBhfId to branch toBhfId of taxpayer tin. The lines need their
+// amounts; their itemSeq is assigned in order. The movements still need
+// their sarNo and orgSarNo.
+func TransferMovements(tin, fromBhfId, toBhfId string, lines []StockIOSaveItem) (out, in StockIOSaveReq) {
+	items := make([]StockIOSaveItem, len(lines))
+	for i, line := range lines {
+		line.ItemSeq = i + 1
+		items[i] = line
+		out.TotTaxblAmt = out.TotTaxblAmt.Add(line.TaxblAmt)
+		out.TotTaxAmt = out.TotTaxAmt.Add(line.TaxAmt)
+		out.TotAmt = out.TotAmt.Add(line.TotAmt)
+	}
+	out.Tin, out.BhfId = tin, fromBhfId
+	out.RegTyCd = RegistrationAutomatic
+	out.CustTin, out.CustBhfId = tin, toBhfId
+	out.SarTyCd = StockOutMovement
+	out.OcrnDt = time.Now().Format("20060102")
+	out.TotItemCnt = len(items)
+	out.Remark = "Transfer to branch " + toBhfId
+	out.ItemList = items
+
+	in = out
+	in.BhfId, in.CustBhfId = toBhfId, fromBhfId
+	in.SarTyCd = StockInMovement
+	in.Remark = "Transfer from branch " + fromBhfId
+	in.ItemList = append([]StockIOSaveItem(nil), items...)
+	return out, in
+}
+
+// TransferMismatch is an incoming movement that does not match the transfer
+// the source branch declared.
+type TransferMismatch struct {
+	Transfer StockTransfer
+	Move     StockMove
+	Problems []string
+}
+
+// TransferReconciliation is the result of reconciling the stock movements
+// a branch retrieved with the transfers declared to it.
+type TransferReconciliation struct {
+	// Matched transfers arrived as declared.
+	Matched    []StockTransfer
+	Mismatched []TransferMismatch
+	// Unknown movements name another branch of the taxpayer but no
+	// transfer declared from it.
+	Unknown []StockMove
+	// Missing transfers were declared to the branch but have not arrived.
+	Missing []StockTransfer
+}
+
+// TransferRegister keeps the stock transfers between the branches of every
+// taxpayer, persisted as a JSON file, so the destination can reconcile
+// what it receives with what the source declared.
+type TransferRegister struct {
+	file jsonFile
+
+	mu        sync.Mutex
+	transfers map[string]*StockTransfer
+}
+
+// NewTransferRegister opens the register at path, creating it on first
+// write.
+func NewTransferRegister(path string) (*TransferRegister, error) {
+	r := &TransferRegister{
+		file:      jsonFile{path: path, name: "transfer register"},
+		transfers: make(map[string]*StockTransfer),
+	}
+	if err := r.file.load(&r.transfers); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func transferKey(tin, fromBhfId string, outSarNo int64) string {
+	return branchKey(tin, fromBhfId) + "/" + strconv.FormatInt(outSarNo, 10)
+}
+
+// Record adds a transfer to the register once its source's movement has a
+// sarNo, before the destination's is declared.
+func (r *TransferRegister) Record(ctx context.Context, t StockTransfer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := transferKey(t.Tin, t.FromBhfId, t.OutSarNo)
+	previous, existed := r.transfers[key]
+	if t.DeclaredAt.IsZero() {
+		t.DeclaredAt = time.Now()
+	}
+	r.transfers[key] = &t
+	if err := r.file.write(r.transfers); err != nil {
+		if existed {
+			r.transfers[key] = previous
+		} else {
+			delete(r.transfers, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Complete records the sarNo of the destination's movement of transfer
+// outSarNo from branch fromBhfId of taxpayer tin.
+func (r *TransferRegister) Complete(ctx context.Context, tin, fromBhfId string, outSarNo, inSarNo int64) error {
+	return r.update(tin, fromBhfId, outSarNo, func(t *StockTransfer) {
+		t.InSarNo = inSarNo
+	})
+}
+
+// Cancel records that the destination's movement of the transfer was
+// rejected, and the sarNo of the adjustment that returned its stock to the
+// source.
+func (r *TransferRegister) Cancel(ctx context.Context, tin, fromBhfId string, outSarNo, returnSarNo int64, note string) error {
+	return r.update(tin, fromBhfId, outSarNo, func(t *StockTransfer) {
+		t.ReturnSarNo, t.Note = returnSarNo, note
+	})
+}
+
+func (r *TransferRegister) update(tin, fromBhfId string, outSarNo int64, change func(*StockTransfer)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.transfers[transferKey(tin, fromBhfId, outSarNo)]
+	if !ok {
+		return fmt.Errorf("etims: no transfer %d from branch %s", outSarNo, fromBhfId)
+	}
+	previous := *t
+	change(t)
+	if err := r.file.write(r.transfers); err != nil {
+		*t = previous
+		return err
+	}
+	return nil
+}
+
+// Transfer returns transfer outSarNo from branch fromBhfId of taxpayer tin.
+func (r *TransferRegister) Transfer(tin, fromBhfId string, outSarNo int64) (StockTransfer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.transfers[transferKey(tin, fromBhfId, outSarNo)]
+	if !ok {
+		return StockTransfer{}, false
+	}
+	return *t, true
+}
+
+// Covers reports whether a movement branch bhfId of taxpayer tin received
+// is the source's side of a transfer to it in the register. Such a
+// movement is accounted for by the transfer, through its incoming movement
+// or the return of its stock to the source, and is not to be posted again.
+func (r *TransferRegister) Covers(tin, bhfId string, move StockMove) (StockTransfer, bool) {
+	if move.CustTin != tin {
+		return StockTransfer{}, false
+	}
+	t, ok := r.Transfer(tin, move.CustBhfId, move.SarNo)
+	if !ok || t.ToBhfId != bhfId {
+		return StockTransfer{}, false
+	}
+	return t, true
+}
+
+// Pending returns the transfers of taxpayer tin whose destination's side is
+// still to be declared, oldest first.
+func (r *TransferRegister) Pending(tin string) []StockTransfer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pending []StockTransfer
+	for _, t := range r.transfers {
+		if t.Tin == tin && t.Pending() {
+			pending = append(pending, *t)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].DeclaredAt.Before(pending[j].DeclaredAt) })
+	return pending
+}
+
+// Reconcile matches the stock movements branch bhfId of taxpayer tin
+// retrieved from /stock/selectStockItems with the transfers declared to
+// it. A movement from another branch of the taxpayer is matched by the
+// sender's sarNo; transfers that match are marked received.
+func (r *TransferRegister) Reconcile(ctx context.Context, tin, bhfId string, moves []StockMove) (TransferReconciliation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rec TransferReconciliation
+	now := time.Now()
+	var received []*StockTransfer
+	for _, move := range moves {
+		if move.CustTin != tin || move.CustBhfId == "" || move.CustBhfId == bhfId {
+			continue
+		}
+		t, ok := r.transfers[transferKey(tin, move.CustBhfId, move.SarNo)]
+		if !ok || t.ToBhfId != bhfId {
+			rec.Unknown = append(rec.Unknown, move)
+			continue
+		}
+		if problems := compareTransfer(*t, move); len(problems) > 0 {
+			rec.Mismatched = append(rec.Mismatched, TransferMismatch{Transfer: *t, Move: move, Problems: problems})
+			continue
+		}
+		if t.ReceivedAt == nil {
+			t.ReceivedAt = &now
+			received = append(received, t)
+		}
+		rec.Matched = append(rec.Matched, *t)
+	}
+
+	if len(received) > 0 {
+		if err := r.file.write(r.transfers); err != nil {
+			for _, t := range received {
+				t.ReceivedAt = nil
+			}
+			return TransferReconciliation{}, err
+		}
+	}
+
+	for _, t := range r.transfers {
+		if t.Tin == tin && t.ToBhfId == bhfId && t.ReceivedAt == nil && t.ReturnSarNo == 0 {
+			rec.Missing = append(rec.Missing, *t)
+		}
+	}
+	sort.Slice(rec.Missing, func(i, j int) bool { return rec.Missing[i].DeclaredAt.Before(rec.Missing[j].DeclaredAt) })
+	return rec, nil
+}
+
+// compareTransfer lists how move differs from the declared transfer t.
+func compareTransfer(t StockTransfer, move StockMove) []string {
+	var problems []string
+	if len(move.ItemList) != len(t.Items) {
+		problems = append(problems, fmt.Sprintf("%d items declared, %d received", len(t.Items), len(move.ItemList)))
+	}
+	declared := make(map[string]Decimal)
+	for _, item := range t.Items {
+		declared[item.ItemCd] = declared[item.ItemCd].Add(item.Qty)
+	}
+	got := make(map[string]Decimal)
+	for _, item := range move.ItemList {
+		got[item.ItemCd] = got[item.ItemCd].Add(item.Qty)
+	}
+	for itemCd, qty := range declared {
+		if got[itemCd] != qty {
+			problems = append(problems, fmt.Sprintf("item %s: qty %s declared, %s received", itemCd, qty, got[itemCd]))
+		}
+	}
+	for itemCd, qty := range got {
+		if _, ok := declared[itemCd]; !ok {
+			problems = append(problems, fmt.Sprintf("item %s: qty %s received but not declared", itemCd, qty))
+		}
+	}
+	var totAmt Decimal
+	for _, item := range t.Items {
+		totAmt = totAmt.Add(item.TotAmt)
+	}
+	if move.TotAmt != totAmt {
+		problems = append(problems, fmt.Sprintf("totAmt %s declared, %s received", totAmt, move.TotAmt))
+	}
+	sort.Strings(problems)
+	return problems
+}
@@ -0,0 +1,175 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TransferService moves stock between the branches of a taxpayer: the
+// source declares an outgoing movement (13) and the destination an
+// incoming one (04), each naming the other as custBhfId. Transfers are kept
+// in the register, so one whose incoming side could not be declared is
+// finished later rather than the stock going missing between the branches.
+type TransferService struct {
+	register *TransferRegister
+	moves    *StockMoveInbox
+	numbers  *Sequencer
+	outbox   *Outbox
+	ledger   *StockLedger
+	codes    *CodeRepository
+
+	// clients are the clients of the branches added so far, by bhfId.
+	clients map[string]*Client
+}
+
+// NewTransferService returns a transfer service declaring the movements of
+// its branches with the stock services of their clients. codes prices the
+// lines of new transfers.
+func NewTransferService(register *TransferRegister, moves *StockMoveInbox, numbers *Sequencer, outbox *Outbox, ledger *StockLedger, codes *CodeRepository) *TransferService {
+	return &TransferService{
+		register: register,
+		moves:    moves,
+		numbers:  numbers,
+		outbox:   outbox,
+		ledger:   ledger,
+		codes:    codes,
+		clients:  make(map[string]*Client),
+	}
+}
+
+// AddBranch makes the branch of client available as the source or the
+// destination of transfers.
+func (s *TransferService) AddBranch(client *Client) {
+	s.clients[client.bhfId] = client
+}
+
+// stock returns the stock service of branch bhfId, or nil if the branch was
+// not added.
+func (s *TransferService) stock(bhfId string) *StockService {
+	c := s.clients[bhfId]
+	if c == nil {
+		return nil
+	}
+	return NewStockService(c, s.numbers, s.outbox, s.ledger)
+}
+
+// TransferStock moves lines from branch fromBhfId of taxpayer tin to branch
+// toBhfId. The lines need their prc, qty and taxTyCd. Both branches must
+// have been added.
+//
+// The transfer is recorded as soon as the outgoing movement has its sarNo,
+// so if the incoming one cannot be declared now, CompleteTransfers finishes
+// it later.
+func (s *TransferService) TransferStock(ctx context.Context, tin, fromBhfId, toBhfId string, lines []StockIOSaveItem) error {
+	from, to := s.stock(fromBhfId), s.stock(toBhfId)
+	if from == nil || to == nil {
+		return fmt.Errorf("cannot transfer stock from branch %s to %s: both need a client", fromBhfId, toBhfId)
+	}
+	tax, err := NewTaxCalculator(s.codes, TaxExclusive, RoundHalfUp)
+	if err != nil {
+		return err
+	}
+	priced := StockIOSaveReq{ItemList: lines}
+	if err := tax.ApplyStock(&priced); err != nil {
+		return err
+	}
+
+	out, _ := TransferMovements(tin, fromBhfId, toBhfId, priced.ItemList)
+	ref := fmt.Sprintf("transfer/%s/%s/%s", fromBhfId, toBhfId, time.Now().Format("20060102150405.000000"))
+
+	outSarNo, err := from.Declare(ctx, out, ref)
+	if outSarNo == 0 {
+		return fmt.Errorf("failed to declare outgoing transfer: %w", err)
+	}
+	t := StockTransfer{
+		Tin:       tin,
+		FromBhfId: fromBhfId,
+		ToBhfId:   toBhfId,
+		OutSarNo:  outSarNo,
+		Items:     out.ItemList,
+	}
+	if rerr := s.register.Record(ctx, t); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+	if err != nil {
+		return err
+	}
+	return s.completeTransfer(ctx, to, t)
+}
+
+// CompleteTransfers declares the incoming side of the transfers of
+// taxpayer tin recorded before it could be, for the destinations added.
+func (s *TransferService) CompleteTransfers(ctx context.Context, tin string) error {
+	for _, t := range s.register.Pending(tin) {
+		to := s.stock(t.ToBhfId)
+		if to == nil {
+			continue
+		}
+		if err := s.completeTransfer(ctx, to, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeTransfer declares the incoming movement of transfer t at its
+// destination. If the VSCU rejects it, the stock is returned to the source
+// with an adjustment (06) instead, so it is not lost between the branches.
+func (s *TransferService) completeTransfer(ctx context.Context, to *StockService, t StockTransfer) error {
+	log := to.client.logger.WithFields(logrus.Fields{"from_bhf_id": t.FromBhfId, "to_bhf_id": t.ToBhfId, "out_sar_no": t.OutSarNo})
+	_, in := t.Movements()
+
+	inSarNo, err := to.Declare(ctx, in, t.Ref("in"))
+	if inSarNo != 0 {
+		if cerr := s.register.Complete(ctx, t.Tin, t.FromBhfId, t.OutSarNo, inSarNo); cerr != nil {
+			return errors.Join(err, cerr)
+		}
+		if err == nil {
+			log.WithField("in_sar_no", inSarNo).Info("Stock transferred")
+		}
+		return err
+	}
+	var re *ResultError
+	if !errors.As(err, &re) {
+		return fmt.Errorf("failed to declare incoming transfer: %w", err)
+	}
+
+	from := s.stock(t.FromBhfId)
+	if from == nil {
+		return fmt.Errorf("incoming transfer rejected and branch %s has no client to return the stock: %w", t.FromBhfId, err)
+	}
+	returnSarNo, rerr := from.Declare(ctx, t.ReturnMovement(), t.Ref("return"))
+	if returnSarNo == 0 {
+		return fmt.Errorf("incoming transfer rejected and its stock could not be returned: %w", errors.Join(err, rerr))
+	}
+	if cerr := s.register.Cancel(ctx, t.Tin, t.FromBhfId, t.OutSarNo, returnSarNo, err.Error()); cerr != nil {
+		return errors.Join(rerr, cerr)
+	}
+	log.WithError(err).WithField("return_sar_no", returnSarNo).Warn("Incoming transfer rejected, stock returned to the source")
+	return rerr
+}
+
+// ReconcileTransfers matches the stock movements branch bhfId of taxpayer
+// tin retrieved with the transfers its sibling branches declared to it. A
+// matching transfer is already in the ledger through the branch's own
+// incoming movement, so it is marked posted in the stock movement inbox.
+func (s *TransferService) ReconcileTransfers(ctx context.Context, tin, bhfId string, moves []StockMove) (TransferReconciliation, error) {
+	rec, err := s.register.Reconcile(ctx, tin, bhfId, moves)
+	if err != nil {
+		return TransferReconciliation{}, err
+	}
+	for _, t := range rec.Matched {
+		key := StockMoveKey{Tin: tin, BhfId: bhfId, CustTin: t.Tin, CustBhfId: t.FromBhfId, SarNo: t.OutSarNo}
+		if m, ok := s.moves.StockMove(key); ok && m.Status == StockMovePending {
+			note := fmt.Sprintf("transfer received as sarNo %d", t.InSarNo)
+			if err := s.moves.MarkPosted(ctx, key, note); err != nil {
+				return rec, err
+			}
+		}
+	}
+	return rec, nil
+}
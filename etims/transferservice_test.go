@@ -0,0 +1,95 @@
+package etims
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransferStock(t *testing.T) {
+	ctx := context.Background()
+	const fromBhfId, toBhfId = "00", "01"
+	itemCd := testMovement().ItemList[0].ItemCd
+	line := StockIOSaveItem{
+		ItemCd:    itemCd,
+		ItemClsCd: "5022110801",
+		ItemNm:    "Test Item",
+		Qty:       NewDecimal(2),
+		Prc:       NewDecimal(100),
+		TaxTyCd:   TaxTypeB,
+	}
+
+	tests := []struct {
+		name string
+		// in answers the destination's movements.
+		in map[int64]string
+		// inSarNo and returnSarNo are as registered for the transfer.
+		inSarNo, returnSarNo int64
+		// fromQty and toQty are the remaining quantities in the ledger.
+		fromQty, toQty string
+	}{
+		{
+			name:    "both sides declared",
+			inSarNo: 1,
+			fromQty: "-2.00",
+			toQty:   "2.00",
+		},
+		{
+			name:    "incoming queued",
+			in:      map[int64]string{1: "500"},
+			inSarNo: 1,
+			fromQty: "-2.00",
+			toQty:   "0.00",
+		},
+		{
+			name:        "incoming rejected",
+			in:          map[int64]string{1: ResultParameter},
+			returnSarNo: 2,
+			fromQty:     "0.00",
+			toQty:       "0.00",
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		register, err := NewTransferRegister(filepath.Join(dir, "transfers.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		moves, err := NewStockMoveInbox(filepath.Join(dir, "stockmoves.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		numbers, err := OpenSequencer(filepath.Join(dir, "sequences.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outbox, err := OpenOutbox(filepath.Join(dir, "outbox.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger, err := NewStockLedger(filepath.Join(dir, "stock.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewTransferService(register, moves, numbers, outbox, ledger, taxCodes(t))
+		var sent int
+		s.AddBranch(fakeStockVSCU(t, fromBhfId, nil, &sent))
+		s.AddBranch(fakeStockVSCU(t, toBhfId, tt.in, &sent))
+
+		if err := s.TransferStock(ctx, testTin, fromBhfId, toBhfId, []StockIOSaveItem{line}); err != nil {
+			t.Errorf("%s: TransferStock: %v", tt.name, err)
+		}
+		tr, ok := register.Transfer(testTin, fromBhfId, 1)
+		if !ok || tr.InSarNo != tt.inSarNo || tr.ReturnSarNo != tt.returnSarNo {
+			t.Errorf("%s: transfer %+v, %v, want inSarNo %d, returnSarNo %d", tt.name, tr, ok, tt.inSarNo, tt.returnSarNo)
+		}
+		if got := ledger.RsdQty(testTin, fromBhfId, itemCd).String(); got != tt.fromQty {
+			t.Errorf("%s: source rsdQty %s, want %s", tt.name, got, tt.fromQty)
+		}
+		if got := ledger.RsdQty(testTin, toBhfId, itemCd).String(); got != tt.toQty {
+			t.Errorf("%s: destination rsdQty %s, want %s", tt.name, got, tt.toQty)
+		}
+		numbers.Close()
+		outbox.Close()
+	}
+}
@@ -0,0 +1,90 @@
+package etims
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// EndpointClass groups VSCU routes with similar latency.
+type EndpointClass int
+
+const (
+	// EndpointLookup is a select route. Full downloads such as the item
+	// classification list can be large.
+	EndpointLookup EndpointClass = iota
+	// EndpointSave is a save or update route; these are small and on the
+	// cashier's critical path.
+	EndpointSave
+	// EndpointInit is device initialization, which the VSCU forwards to the
+	// eTIMS server.
+	EndpointInit
+)
+
+// Timeouts bounds one attempt at a request. A zero value disables that
+// bound.
+type Timeouts struct {
+	// Dial bounds establishing a new connection. It only applies to the
+	// client's own transport, not to one set with WithHTTPClient.
+	Dial time.Duration
+	// Header bounds the wait from sending the request to receiving the
+	// response headers.
+	Header time.Duration
+	// Overall bounds the whole attempt, including reading the body.
+	Overall time.Duration
+}
+
+// DefaultTimeouts are the timeouts a Client uses unless WithTimeouts says
+// otherwise.
+var DefaultTimeouts = map[EndpointClass]Timeouts{
+	EndpointLookup: {Dial: 10 * time.Second, Header: 90 * time.Second, Overall: 5 * time.Minute},
+	EndpointSave:   {Dial: 5 * time.Second, Header: 30 * time.Second, Overall: time.Minute},
+	EndpointInit:   {Dial: 10 * time.Second, Header: 2 * time.Minute, Overall: 3 * time.Minute},
+}
+
+// WithTimeouts sets the timeouts of an endpoint class.
+func WithTimeouts(class EndpointClass, t Timeouts) Option {
+	return func(c *Client) {
+		c.timeouts[class] = t
+	}
+}
+
+func endpointClass(path string) EndpointClass {
+	switch {
+	case path == PathSelectInitInfo:
+		return EndpointInit
+	case isSave(path):
+		return EndpointSave
+	}
+	return EndpointLookup
+}
+
+var errHeaderTimeout = errors.New("timed out waiting for response headers")
+
+type dialTimeoutKey struct{}
+
+// newHTTPClient returns the HTTP client shared by all requests of a Client.
+// Deadlines are set per request, so the client itself has none.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialContext,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// dialContext dials with the timeout of the request that needs the
+// connection.
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := net.Dialer{KeepAlive: 30 * time.Second}
+	if timeout, ok := ctx.Value(dialTimeoutKey{}).(time.Duration); ok {
+		d.Timeout = timeout
+	}
+	return d.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,382 @@
+package etims
+
+type CodeRequest struct {
+	Tin       string `json:"tin"`
+	BhfId     string `json:"bhfId"`
+	LastReqDt string `json:"lastReqDt"`
+}
+
+type ItemClassRequest struct {
+	Tin       string `json:"tin"`
+	BhfId     string `json:"bhfId"`
+	LastReqDt string `json:"lastReqDt"`
+}
+
+type CustomerRequest struct {
+	Tin      string `json:"tin"`
+	BhfId    string `json:"bhfId"`
+	CustmTin string `json:"custmTin"`
+}
+
+type BranchCustomerRequest struct {
+	Tin     string `json:"tin"`
+	BhfId   string `json:"bhfId"`
+	CustNo  string `json:"custNo"`
+	CustTin string `json:"custTin"`
+	CustNm  string `json:"custNm"`
+	UseYn   string `json:"useYn"`
+	RegrNm  string `json:"regrNm"`
+	RegrId  string `json:"regrId"`
+	ModrNm  string `json:"modrNm"`
+	ModrId  string `json:"modrId"`
+}
+
+type BranchInsuranceRequest struct {
+	Tin     string  `json:"tin"`
+	BhfId   string  `json:"bhfId"`
+	IsrccCd string  `json:"isrccCd"`
+	IsrccNm string  `json:"isrccNm"`
+	IsrcRt  Decimal `json:"isrcRt"`
+	UseYn   string  `json:"useYn"`
+	RegrNm  string  `json:"regrNm"`
+	RegrId  string  `json:"regrId"`
+	ModrNm  string  `json:"modrNm"`
+	ModrId  string  `json:"modrId"`
+}
+
+type ItemRequest struct {
+	Tin         string  `json:"tin"`
+	BhfId       string  `json:"bhfId"`
+	ItemCd      string  `json:"itemCd"`
+	ItemClsCd   string  `json:"itemClsCd"`
+	ItemTyCd    string  `json:"itemTyCd"`
+	ItemNm      string  `json:"itemNm"`
+	ItemStdNm   string  `json:"itemStdNm"`
+	OrgnNatCd   string  `json:"orgnNatCd"`
+	PkgUnitCd   string  `json:"pkgUnitCd"`
+	QtyUnitCd   string  `json:"qtyUnitCd"`
+	TaxTyCd     string  `json:"taxTyCd"`
+	BtchNo      string  `json:"btchNo"`
+	DftPrc      Decimal `json:"dftPrc"`
+	IsrcAplcbYn string  `json:"isrcAplcbYn"`
+	UseYn       string  `json:"useYn"`
+	RegrNm      string  `json:"regrNm"`
+	RegrId      string  `json:"regrId"`
+	ModrNm      string  `json:"modrNm"`
+	ModrId      string  `json:"modrId"`
+}
+
+type StockMasterRequest struct {
+	Tin    string  `json:"tin"`
+	BhfId  string  `json:"bhfId"`
+	ItemCd string  `json:"itemCd"`
+	RsdQty Decimal `json:"rsdQty"`
+	RegrId string  `json:"regrId"`
+	RegrNm string  `json:"regrNm"`
+	ModrId string  `json:"modrId"`
+	ModrNm string  `json:"modrNm"`
+}
+
+type InitRequest struct {
+	Tin      string `json:"tin"`
+	BhfId    string `json:"bhfId"`
+	DvcSrlNo string `json:"dvcSrlNo"`
+}
+
+type NoticeRequest struct {
+	Tin       string `json:"tin"`
+	BhfId     string `json:"bhfId"`
+	LastReqDt string `json:"lastReqDt"`
+}
+
+type BranchRequest struct {
+	Tin       string `json:"tin"`
+	BhfId     string `json:"bhfId"`
+	LastReqDt string `json:"lastReqDt"`
+}
+
+type ImportItemRequest struct {
+	Tin       string `json:"tin"`
+	BhfId     string `json:"bhfId"`
+	LastReqDt string `json:"lastReqDt"`
+}
+
+type PurchaseRequest struct {
+	Tin       string `json:"tin"`
+	BhfId     string `json:"bhfId"`
+	LastReqDt string `json:"lastReqDt"`
+}
+
+type TrnsSalesSaveWrReq struct {
+	Tin          string                 `json:"tin"`
+	BhfId        string                 `json:"bhfId"`
+	TrdInvcNo    string                 `json:"trdInvcNo"`
+	InvcNo       int64                  `json:"invcNo"`
+	OrgInvcNo    int64                  `json:"orgInvcNo"`
+	CustTin      string                 `json:"custTin,omitempty"`
+	CustNm       string                 `json:"custNm,omitempty"`
+	SalesTyCd    string                 `json:"salesTyCd"`
+	RcptTyCd     string                 `json:"rcptTyCd"`
+	PmtTyCd      string                 `json:"pmtTyCd,omitempty"`
+	SalesSttsCd  string                 `json:"salesSttsCd"`
+	CfmDt        string                 `json:"cfmDt"`
+	SalesDt      string                 `json:"salesDt"`
+	StockRlsDt   string                 `json:"stockRlsDt,omitempty"`
+	CnclReqDt    string                 `json:"cnclReqDt,omitempty"`
+	CnclDt       string                 `json:"cnclDt,omitempty"`
+	RfdDt        string                 `json:"rfdDt,omitempty"`
+	RfdRsnCd     string                 `json:"rfdRsnCd,omitempty"`
+	TotItemCnt   int                    `json:"totItemCnt"`
+	TaxblAmtA    Decimal                `json:"taxblAmtA"`
+	TaxblAmtB    Decimal                `json:"taxblAmtB"`
+	TaxblAmtC    Decimal                `json:"taxblAmtC"`
+	TaxblAmtD    Decimal                `json:"taxblAmtD"`
+	TaxblAmtE    Decimal                `json:"taxblAmtE"`
+	TaxRtA       Decimal                `json:"taxRtA"`
+	TaxRtB       Decimal                `json:"taxRtB"`
+	TaxRtC       Decimal                `json:"taxRtC"`
+	TaxRtD       Decimal                `json:"taxRtD"`
+	TaxRtE       Decimal                `json:"taxRtE"`
+	TaxAmtA      Decimal                `json:"taxAmtA"`
+	TaxAmtB      Decimal                `json:"taxAmtB"`
+	TaxAmtC      Decimal                `json:"taxAmtC"`
+	TaxAmtD      Decimal                `json:"taxAmtD"`
+	TaxAmtE      Decimal                `json:"taxAmtE"`
+	TotTaxblAmt  Decimal                `json:"totTaxblAmt"`
+	TotTaxAmt    Decimal                `json:"totTaxAmt"`
+	TotAmt       Decimal                `json:"totAmt"`
+	PrchrAcptcYn string                 `json:"prchrAcptcYn"`
+	Remark       string                 `json:"remark,omitempty"`
+	RegrId       string                 `json:"regrId"`
+	RegrNm       string                 `json:"regrNm"`
+	ModrId       string                 `json:"modrId"`
+	ModrNm       string                 `json:"modrNm"`
+	Receipt      TrnsSalesSaveWrReceipt `json:"receipt"`
+	ItemList     []TrnsSalesSaveWrItem  `json:"itemList"`
+}
+
+type TrnsSalesSaveWrReceipt struct {
+	CustTin      string `json:"custTin,omitempty"`
+	CustMblNo    string `json:"custMblNo,omitempty"`
+	RptNo        int64  `json:"rptNo"`
+	TrdeNm       string `json:"trdeNm,omitempty"`
+	Adrs         string `json:"adrs,omitempty"`
+	TopMsg       string `json:"topMsg,omitempty"`
+	BtmMsg       string `json:"btmMsg,omitempty"`
+	PrchrAcptcYn string `json:"prchrAcptcYn"`
+}
+
+type TrnsSalesSaveWrItem struct {
+	ItemSeq   int      `json:"itemSeq"`
+	ItemClsCd string   `json:"itemClsCd,omitempty"`
+	ItemCd    string   `json:"itemCd"`
+	ItemNm    string   `json:"itemNm"`
+	Bcd       string   `json:"bcd,omitempty"`
+	PkgUnitCd string   `json:"pkgUnitCd"`
+	Pkg       Decimal  `json:"pkg"`
+	QtyUnitCd string   `json:"qtyUnitCd"`
+	Qty       Decimal  `json:"qty"`
+	Prc       Decimal  `json:"prc"`
+	SplyAmt   Decimal  `json:"splyAmt"`
+	DcRt      Decimal  `json:"dcRt"`
+	DcAmt     Decimal  `json:"dcAmt"`
+	IsrccCd   string   `json:"isrccCd,omitempty"`
+	IsrccNm   string   `json:"isrccNm,omitempty"`
+	IsrcRt    *Decimal `json:"isrcRt,omitempty"`
+	IsrcAmt   *Decimal `json:"isrcAmt,omitempty"`
+	TaxTyCd   string   `json:"taxTyCd"`
+	TaxblAmt  Decimal  `json:"taxblAmt"`
+	TaxAmt    Decimal  `json:"taxAmt"`
+	TotAmt    Decimal  `json:"totAmt"`
+}
+
+type TrnsPurchaseSaveReq struct {
+	Tin         string                 `json:"tin"`
+	BhfId       string                 `json:"bhfId"`
+	InvcNo      int64                  `json:"invcNo"`
+	OrgInvcNo   int64                  `json:"orgInvcNo"`
+	SpplrTin    string                 `json:"spplrTin,omitempty"`
+	SpplrBhfId  string                 `json:"spplrBhfId,omitempty"`
+	SpplrNm     string                 `json:"spplrNm,omitempty"`
+	SpplrInvcNo int64                  `json:"spplrInvcNo,omitempty"`
+	SpplrSdcId  string                 `json:"spplrSdcId,omitempty"`
+	RegTyCd     string                 `json:"regTyCd"`
+	PchsTyCd    string                 `json:"pchsTyCd"`
+	RcptTyCd    string                 `json:"rcptTyCd"`
+	PmtTyCd     string                 `json:"pmtTyCd"`
+	PchsSttsCd  string                 `json:"pchsSttsCd"`
+	CfmDt       string                 `json:"cfmDt,omitempty"`
+	PchsDt      string                 `json:"pchsDt"`
+	WrhsDt      string                 `json:"wrhsDt,omitempty"`
+	CnclReqDt   string                 `json:"cnclReqDt,omitempty"`
+	CnclDt      string                 `json:"cnclDt,omitempty"`
+	RfdDt       string                 `json:"rfdDt,omitempty"`
+	TotItemCnt  int                    `json:"totItemCnt"`
+	TaxblAmtA   Decimal                `json:"taxblAmtA"`
+	TaxblAmtB   Decimal                `json:"taxblAmtB"`
+	TaxblAmtC   Decimal                `json:"taxblAmtC"`
+	TaxblAmtD   Decimal                `json:"taxblAmtD"`
+	TaxblAmtE   Decimal                `json:"taxblAmtE"`
+	TaxRtA      Decimal                `json:"taxRtA"`
+	TaxRtB      Decimal                `json:"taxRtB"`
+	TaxRtC      Decimal                `json:"taxRtC"`
+	TaxRtD      Decimal                `json:"taxRtD"`
+	TaxRtE      Decimal                `json:"taxRtE"`
+	TaxAmtA     Decimal                `json:"taxAmtA"`
+	TaxAmtB     Decimal                `json:"taxAmtB"`
+	TaxAmtC     Decimal                `json:"taxAmtC"`
+	TaxAmtD     Decimal                `json:"taxAmtD"`
+	TaxAmtE     Decimal                `json:"taxAmtE"`
+	TotTaxblAmt Decimal                `json:"totTaxblAmt"`
+	TotTaxAmt   Decimal                `json:"totTaxAmt"`
+	TotAmt      Decimal                `json:"totAmt"`
+	Remark      string                 `json:"remark,omitempty"`
+	RegrNm      string                 `json:"regrNm"`
+	RegrId      string                 `json:"regrId"`
+	ModrNm      string                 `json:"modrNm"`
+	ModrId      string                 `json:"modrId"`
+	ItemList    []TrnsPurchaseSaveItem `json:"itemList"`
+}
+
+type TrnsPurchaseSaveItem struct {
+	ItemSeq        int     `json:"itemSeq"`
+	ItemCd         string  `json:"itemCd,omitempty"`
+	ItemClsCd      string  `json:"itemClsCd"`
+	ItemNm         string  `json:"itemNm"`
+	Bcd            string  `json:"bcd,omitempty"`
+	SpplrItemClsCd string  `json:"spplrItemClsCd,omitempty"`
+	SpplrItemCd    string  `json:"spplrItemCd,omitempty"`
+	SpplrItemNm    string  `json:"spplrItemNm,omitempty"`
+	PkgUnitCd      string  `json:"pkgUnitCd,omitempty"`
+	Pkg            Decimal `json:"pkg"`
+	QtyUnitCd      string  `json:"qtyUnitCd"`
+	Qty            Decimal `json:"qty"`
+	Prc            Decimal `json:"prc"`
+	SplyAmt        Decimal `json:"splyAmt"`
+	DcRt           Decimal `json:"dcRt"`
+	DcAmt          Decimal `json:"dcAmt"`
+	TaxblAmt       Decimal `json:"taxblAmt"`
+	TaxTyCd        string  `json:"taxTyCd"`
+	TaxAmt         Decimal `json:"taxAmt"`
+	TotAmt         Decimal `json:"totAmt"`
+	ItemExprDt     string  `json:"itemExprDt,omitempty"`
+}
+
+type CustomerInfoRequest struct {
+	Tin        string `json:"tin"`
+	CustmTin   string `json:"custmTin"`
+	CustmBhfId string `json:"custmBhfId"`
+	LastReqDt  string `json:"lastReqDt"`
+}
+
+type BranchCustomerInfoRequest struct {
+	Tin     string `json:"tin"`
+	BhfId   string `json:"bhfId"`
+	CustNo  string `json:"custNo"`
+	CustTin string `json:"custTin"`
+	CustNm  string `json:"custNm"`
+	TelNo   string `json:"telNo"`
+	Email   string `json:"email"`
+	Fax     string `json:"fax"`
+	RegrId  string `json:"regrId"`
+	RegrNm  string `json:"regrNm"`
+	ModrId  string `json:"modrId"`
+	ModrNm  string `json:"modrNm"`
+}
+
+type StockMovementRequest struct {
+	Tin       string `json:"tin"`
+	BhfId     string `json:"bhfId"`
+	LastReqDt string `json:"lastReqDt"`
+}
+
+type BranchUserRequest struct {
+	Tin    string `json:"tin"`
+	BhfId  string `json:"bhfId"`
+	UserId string `json:"userId"`
+	UserNm string `json:"userNm"`
+	Pwd    string `json:"pwd"`
+	RoleCd string `json:"roleCd"`
+	UseYn  string `json:"useYn"`
+	RegrId string `json:"regrId"`
+	RegrNm string `json:"regrNm"`
+	ModrId string `json:"modrId"`
+	ModrNm string `json:"modrNm"`
+}
+
+type ItemCompositionRequest struct {
+	Tin        string  `json:"tin"`
+	BhfId      string  `json:"bhfId"`
+	ItemCd     string  `json:"itemCd"`
+	CpstItemCd string  `json:"cpstItemCd"`
+	CpstQty    Decimal `json:"cpstQty"`
+	CpstUnitCd string  `json:"cpstUnitCd"`
+	RegrId     string  `json:"regrId"`
+	RegrNm     string  `json:"regrNm"`
+	ModrId     string  `json:"modrId"`
+	ModrNm     string  `json:"modrNm"`
+}
+
+type StockIOSaveReq struct {
+	Tin         string            `json:"tin"`
+	BhfId       string            `json:"bhfId"`
+	SarNo       int64             `json:"sarNo"`
+	OrgSarNo    int64             `json:"orgSarNo"`
+	RegTyCd     string            `json:"regTyCd"`
+	CustTin     string            `json:"custTin,omitempty"`
+	CustNm      string            `json:"custNm,omitempty"`
+	CustBhfId   string            `json:"custBhfId,omitempty"`
+	SarTyCd     string            `json:"sarTyCd"`
+	OcrnDt      string            `json:"ocrnDt"`
+	TotItemCnt  int               `json:"totItemCnt"`
+	TotTaxblAmt Decimal           `json:"totTaxblAmt"`
+	TotTaxAmt   Decimal           `json:"totTaxAmt"`
+	TotAmt      Decimal           `json:"totAmt"`
+	Remark      string            `json:"remark,omitempty"`
+	RegrId      string            `json:"regrId"`
+	RegrNm      string            `json:"regrNm"`
+	ModrId      string            `json:"modrId"`
+	ModrNm      string            `json:"modrNm"`
+	ItemList    []StockIOSaveItem `json:"itemList"`
+}
+
+type StockIOSaveItem struct {
+	ItemSeq    int     `json:"itemSeq"`
+	ItemCd     string  `json:"itemCd,omitempty"`
+	ItemClsCd  string  `json:"itemClsCd"`
+	ItemNm     string  `json:"itemNm"`
+	Bcd        string  `json:"bcd,omitempty"`
+	PkgUnitCd  string  `json:"pkgUnitCd"`
+	Pkg        Decimal `json:"pkg"`
+	QtyUnitCd  string  `json:"qtyUnitCd"`
+	Qty        Decimal `json:"qty"`
+	ItemExprDt string  `json:"itemExprDt,omitempty"`
+	Prc        Decimal `json:"prc"`
+	SplyAmt    Decimal `json:"splyAmt"`
+	TotDcAmt   Decimal `json:"totDcAmt"`
+	TaxblAmt   Decimal `json:"taxblAmt"`
+	TaxTyCd    string  `json:"taxTyCd"`
+	TaxAmt     Decimal `json:"taxAmt"`
+	TotAmt     Decimal `json:"totAmt"`
+}
+
+type GetItemRequest struct {
+	Tin       string `json:"tin"`
+	BhfId     string `json:"bhfId"`
+	LastReqDt string `json:"lastReqDt"`
+}
+
+type ImportItemUpdateRequest struct {
+	Tin            string `json:"tin"`
+	BhfId          string `json:"bhfId"`
+	TaskCd         string `json:"taskCd"`
+	DclDe          string `json:"dclDe"`
+	ItemSeq        int    `json:"itemSeq"`
+	HsCd           string `json:"hsCd"`
+	ItemClsCd      string `json:"itemClsCd"`
+	ItemCd         string `json:"itemCd"`
+	ImptItemSttsCd string `json:"imptItemSttsCd"`
+	Remark         string `json:"remark"`
+	ModrNm         string `json:"modrNm"`
+	ModrId         string `json:"modrId"`
+}
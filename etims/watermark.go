@@ -0,0 +1,128 @@
+package etims
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultLastReqDt is the watermark used for a data kind that has never
+// been retrieved, so the first sync downloads the full history.
+const DefaultLastReqDt = "20180101000000"
+
+// WatermarkKey identifies one kind of data retrieved by one branch. The
+// endpoint is the VSCU route the data comes from.
+type WatermarkKey struct {
+	Tin      string
+	BhfId    string
+	Endpoint string
+}
+
+func (k WatermarkKey) String() string {
+	return k.Tin + "/" + k.BhfId + k.Endpoint
+}
+
+// WatermarkStore keeps the date and time of the last successful retrieval
+// of each kind of data (spec section 2.2), in the yyyyMMddHHmmss format the
+// VSCU expects for lastReqDt.
+type WatermarkStore interface {
+	// Get returns the stored watermark, or "" if there is none.
+	Get(ctx context.Context, key WatermarkKey) (string, error)
+	// Set stores lastReqDt as the watermark for key.
+	Set(ctx context.Context, key WatermarkKey, lastReqDt string) error
+}
+
+// FileWatermarkStore is a WatermarkStore backed by a JSON file.
+type FileWatermarkStore struct {
+	file jsonFile
+
+	mu         sync.Mutex
+	watermarks map[string]string
+}
+
+// NewFileWatermarkStore opens the store at path, creating it on first Set.
+func NewFileWatermarkStore(path string) (*FileWatermarkStore, error) {
+	s := &FileWatermarkStore{
+		file:       jsonFile{path: path, name: "watermarks"},
+		watermarks: make(map[string]string),
+	}
+	if err := s.file.load(&s.watermarks); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileWatermarkStore) Get(ctx context.Context, key WatermarkKey) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.watermarks[key.String()], nil
+}
+
+func (s *FileWatermarkStore) Set(ctx context.Context, key WatermarkKey, lastReqDt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.watermarks[key.String()]
+	s.watermarks[key.String()] = lastReqDt
+
+	if err := s.file.write(s.watermarks); err != nil {
+		if existed {
+			s.watermarks[key.String()] = previous
+		} else {
+			delete(s.watermarks, key.String())
+		}
+		return err
+	}
+	return nil
+}
+
+// SQLiteWatermarkStore is a WatermarkStore backed by a table in a SQLite
+// database. The caller opens db with the SQLite driver of its choice.
+type SQLiteWatermarkStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteWatermarkStore creates the watermark table in db if needed.
+func NewSQLiteWatermarkStore(ctx context.Context, db *sql.DB) (*SQLiteWatermarkStore, error) {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS etims_watermarks (
+		tin         TEXT NOT NULL,
+		bhf_id      TEXT NOT NULL,
+		endpoint    TEXT NOT NULL,
+		last_req_dt TEXT NOT NULL,
+		PRIMARY KEY (tin, bhf_id, endpoint)
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watermark table: %w", err)
+	}
+	return &SQLiteWatermarkStore{db: db}, nil
+}
+
+func (s *SQLiteWatermarkStore) Get(ctx context.Context, key WatermarkKey) (string, error) {
+	var lastReqDt string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT last_req_dt FROM etims_watermarks WHERE tin = ? AND bhf_id = ? AND endpoint = ?`,
+		key.Tin, key.BhfId, key.Endpoint,
+	).Scan(&lastReqDt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read watermark %s: %w", key, err)
+	}
+	return lastReqDt, nil
+}
+
+func (s *SQLiteWatermarkStore) Set(ctx context.Context, key WatermarkKey, lastReqDt string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO etims_watermarks (tin, bhf_id, endpoint, last_req_dt) VALUES (?, ?, ?, ?)
+		ON CONFLICT (tin, bhf_id, endpoint) DO UPDATE SET last_req_dt = excluded.last_req_dt`,
+		key.Tin, key.BhfId, key.Endpoint, lastReqDt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write watermark %s: %w", key, err)
+	}
+	return nil
+}
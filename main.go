@@ -1,349 +1,28 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
-)
 
-const (
-	baseURL = "http://20.94.40.140:8088"
-	tin     = "P052248771P"
-	bhfId   = "00"
-	cmcKey  = "D3B478EDFBE54536B8DC9DA691A51440E6278C18104D4D6D904F"
+	"testapi/config"
+	"testapi/etims"
+	"testapi/secrets"
 )
 
-type CodeRequest struct {
-	Tin       string `json:"tin"`
-	BhfId     string `json:"bhfId"`
-	LastReqDt string `json:"lastReqDt"`
-}
-
-type ItemClassRequest struct {
-	Tin       string `json:"tin"`
-	BhfId     string `json:"bhfId"`
-	LastReqDt string `json:"lastReqDt"`
-}
-
-type CustomerRequest struct {
-	Tin      string `json:"tin"`
-	BhfId    string `json:"bhfId"`
-	CustmTin string `json:"custmTin"`
-}
-
-type BranchCustomerRequest struct {
-	Tin     string `json:"tin"`
-	BhfId   string `json:"bhfId"`
-	CustNo  string `json:"custNo"`
-	CustTin string `json:"custTin"`
-	CustNm  string `json:"custNm"`
-	UseYn   string `json:"useYn"`
-	RegrNm  string `json:"regrNm"`
-	RegrId  string `json:"regrId"`
-	ModrNm  string `json:"modrNm"`
-	ModrId  string `json:"modrId"`
-}
-
-type BranchInsuranceRequest struct {
-	Tin     string  `json:"tin"`
-	BhfId   string  `json:"bhfId"`
-	IsrccCd string  `json:"isrccCd"`
-	IsrccNm string  `json:"isrccNm"`
-	IsrcRt  float64 `json:"isrcRt"`
-	UseYn   string  `json:"useYn"`
-	RegrNm  string  `json:"regrNm"`
-	RegrId  string  `json:"regrId"`
-	ModrNm  string  `json:"modrNm"`
-	ModrId  string  `json:"modrId"`
-}
-
-type ItemRequest struct {
-	Tin        string  `json:"tin"`
-	BhfId      string  `json:"bhfId"`
-	ItemCd     string  `json:"itemCd"`
-	ItemClsCd  string  `json:"itemClsCd"`
-	ItemTyCd   string  `json:"itemTyCd"`
-	ItemNm     string  `json:"itemNm"`
-	ItemStdNm  string  `json:"itemStdNm"`
-	OrgnNatCd  string  `json:"orgnNatCd"`
-	PkgUnitCd  string  `json:"pkgUnitCd"`
-	QtyUnitCd  string  `json:"qtyUnitCd"`
-	TaxTyCd    string  `json:"taxTyCd"`
-	BtchNo     string  `json:"btchNo"`
-	DftPrc     float64 `json:"dftPrc"`
-	IsrcAplcbYn string  `json:"isrcAplcbYn"`
-	UseYn      string  `json:"useYn"`
-	RegrNm     string  `json:"regrNm"`
-	RegrId     string  `json:"regrId"`
-	ModrNm     string  `json:"modrNm"`
-	ModrId     string  `json:"modrId"`
-}
-
-type StockMasterRequest struct {
-	Tin    string `json:"tin"`
-	BhfId  string `json:"bhfId"`
-	ItemCd string `json:"itemCd"`
-	RsdQty int    `json:"rsdQty"`
-	RegrId string `json:"regrId"`
-	RegrNm string `json:"regrNm"`
-	ModrId string `json:"modrId"`
-	ModrNm string `json:"modrNm"`
-}
-
-type StockRequest struct {
-	Tin       string `json:"tin"`
-	BhfId     string `json:"bhfId"`
-	ItemCd    string `json:"itemCd"`
-	RsdQty    int    `json:"rsdQty"`
-	LastReqDt string `json:"lastReqDt"`
-	RegrId    string `json:"regrId"`
-	RegrNm    string `json:"regrNm"`
-	ModrId    string `json:"modrId"`
-	ModrNm    string `json:"modrNm"`
-}
-
-type InitRequest struct {
-	Tin      string `json:"tin"`
-	BhfId    string `json:"bhfId"`
-	DvcSrlNo string `json:"dvcSrlNo"`
-}
-
-type NoticeRequest struct {
-	Tin       string `json:"tin"`
-	BhfId     string `json:"bhfId"`
-	LastReqDt string `json:"lastReqDt"`
-}
-
-type BranchRequest struct {
-	Tin       string `json:"tin"`
-	BhfId     string `json:"bhfId"`
-	LastReqDt string `json:"lastReqDt"`
-}
-
-type ImportItemRequest struct {
-	Tin       string `json:"tin"`
-	BhfId     string `json:"bhfId"`
-	LastReqDt string `json:"lastReqDt"`
-}
-
-type PurchaseRequest struct {
-	Tin       string `json:"tin"`
-	BhfId     string `json:"bhfId"`
-	LastReqDt string `json:"lastReqDt"`
-}
-
-type SalesRequest struct {
-	Tin         string      `json:"tin"`
-	BhfId       string      `json:"bhfId"`
-	InvcNo      string      `json:"invcNo"`
-	SalesTyCd   string      `json:"salesTyCd"`
-	RcptTyCd    string      `json:"rcptTyCd"`
-	PmtTyCd     string      `json:"pmtTyCd"`
-	SalesSttsCd string      `json:"salesSttsCd"`
-	CfmDt       string      `json:"cfmDt"`
-	SalesDt     string      `json:"salesDt"`
-	TotItemCnt  int         `json:"totItemCnt"`
-	TaxblAmtA   float64     `json:"taxblAmtA"`
-	TaxblAmtB   float64     `json:"taxblAmtB"`
-	TaxRtA      float64     `json:"taxRtA"`
-	TaxRtB      float64     `json:"taxRtB"`
-	TaxAmtA     float64     `json:"taxAmtA"`
-	TaxAmtB     float64     `json:"taxAmtB"`
-	TotTaxblAmt float64     `json:"totTaxblAmt"`
-	TotTaxAmt   float64     `json:"totTaxAmt"`
-	TotAmt      float64     `json:"totAmt"`
-	RegrId      string      `json:"regrId"`
-	RegrNm      string      `json:"regrNm"`
-	ModrId      string      `json:"modrId"`
-	ModrNm      string      `json:"modrNm"`
-	Receipt     Receipt     `json:"receipt"`
-	ItemList    []SalesItem `json:"itemList"`
-}
-
-type Receipt struct {
-	CustTin      string `json:"custTin"`
-	CustMblNo    string `json:"custMblNo"`
-	RptNo        int    `json:"rptNo"`
-	TrdeNm       string `json:"trdeNm"`
-	Adrs         string `json:"adrs"`
-	TopMsg       string `json:"topMsg"`
-	BtmMsg       string `json:"btmMsg"`
-	PrchrAcptcYn string `json:"prchrAcptcYn"`
-}
-
-type SalesItem struct {
-	ItemSeq   int     `json:"itemSeq"`
-	ItemCd    string  `json:"itemCd"`
-	ItemClsCd string  `json:"itemClsCd"`
-	ItemNm    string  `json:"itemNm"`
-	PkgUnitCd string  `json:"pkgUnitCd"`
-	Pkg       int     `json:"pkg"`
-	QtyUnitCd string  `json:"qtyUnitCd"`
-	Qty       int     `json:"qty"`
-	Prc       float64 `json:"prc"`
-	SplyAmt   float64 `json:"splyAmt"`
-	DcRt      float64 `json:"dcRt"`
-	DcAmt     float64 `json:"dcAmt"`
-	TaxTyCd   string  `json:"taxTyCd"`
-	TaxblAmt  float64 `json:"taxblAmt"`
-	TaxAmt    float64 `json:"taxAmt"`
-	TotAmt    float64 `json:"totAmt"`
-}
-
-type CustomerInfoRequest struct {
-	Tin        string `json:"tin"`
-	CustmTin   string `json:"custmTin"`
-	CustmBhfId string `json:"custmBhfId"`
-	LastReqDt  string `json:"lastReqDt"`
-}
-
-type BranchCustomerInfoRequest struct {
-	Tin     string `json:"tin"`
-	BhfId   string `json:"bhfId"`
-	CustNo  string `json:"custNo"`
-	CustTin string `json:"custTin"`
-	CustNm  string `json:"custNm"`
-	TelNo   string `json:"telNo"`
-	Email   string `json:"email"`
-	Fax     string `json:"fax"`
-	RegrId  string `json:"regrId"`
-	RegrNm  string `json:"regrNm"`
-	ModrId  string `json:"modrId"`
-	ModrNm  string `json:"modrNm"`
-}
-
-type SalesTransactionRequest struct {
-	Tin         string     `json:"tin"`
-	BhfId       string     `json:"bhfId"`
-	SalesTyCd   string     `json:"salesTyCd"`
-	RcptTyCd    string     `json:"rcptTyCd"`
-	CustTin     string     `json:"custTin"`
-	CustNm      string     `json:"custNm"`
-	CustBhfId   string     `json:"custBhfId"`
-	SalesSttsCd string     `json:"salesSttsCd"`
-	CfmDt       string     `json:"cfmDt"`
-	SaleItems   []SaleItem `json:"saleItems"`
-	TotItemCnt  int        `json:"totItemCnt"`
-	TaxblAmtA   float64    `json:"taxblAmtA"`
-	TaxblAmtB   float64    `json:"taxblAmtB"`
-	TaxblAmtC   float64    `json:"taxblAmtC"`
-	TaxblAmtD   float64    `json:"taxblAmtD"`
-	TaxblAmtE   float64    `json:"taxblAmtE"`
-	TaxRtA      float64    `json:"taxRtA"`
-	TaxRtB      float64    `json:"taxRtB"`
-	TaxRtC      float64    `json:"taxRtC"`
-	TaxRtD      float64    `json:"taxRtD"`
-	TaxRtE      float64    `json:"taxRtE"`
-	TaxAmtA     float64    `json:"taxAmtA"`
-	TaxAmtB     float64    `json:"taxAmtB"`
-	TaxAmtC     float64    `json:"taxAmtC"`
-	TaxAmtD     float64    `json:"taxAmtD"`
-	TaxAmtE     float64    `json:"taxAmtE"`
-	TotTaxblAmt float64    `json:"totTaxblAmt"`
-	TotTaxAmt   float64    `json:"totTaxAmt"`
-	TotAmt      float64    `json:"totAmt"`
-	PmtTyCd     string     `json:"pmtTyCd"`
-	RegrId      string     `json:"regrId"`
-	RegrNm      string     `json:"regrNm"`
-	ModrId      string     `json:"modrId"`
-	ModrNm      string     `json:"modrNm"`
-}
-
-type StockMovementRequest struct {
-	Tin       string `json:"tin"`
-	BhfId     string `json:"bhfId"`
-	LastReqDt string `json:"lastReqDt"`
-}
-
-type BranchUserRequest struct {
-	Tin    string `json:"tin"`
-	BhfId  string `json:"bhfId"`
-	UserId string `json:"userId"`
-	UserNm string `json:"userNm"`
-	Pwd    string `json:"pwd"`
-	RoleCd string `json:"roleCd"`
-	UseYn  string `json:"useYn"`
-	RegrId string `json:"regrId"`
-	RegrNm string `json:"regrNm"`
-	ModrId string `json:"modrId"`
-	ModrNm string `json:"modrNm"`
-}
-
-type ItemCompositionRequest struct {
-	Tin           string  `json:"tin"`
-	BhfId         string  `json:"bhfId"`
-	ItemCd        string  `json:"itemCd"`
-	CpstItemCd    string  `json:"cpstItemCd"`
-	CpstQty       float64 `json:"cpstQty"`
-	CpstUnitCd    string  `json:"cpstUnitCd"`
-	RegrId        string  `json:"regrId"`
-	RegrNm        string  `json:"regrNm"`
-	ModrId        string  `json:"modrId"`
-	ModrNm        string  `json:"modrNm"`
-}
-
-type StockInOutRequest struct {
-	Tin        string      `json:"tin"`
-	BhfId      string      `json:"bhfId"`
-	StockItems []StockItem `json:"stockItems"`
-	LastReqDt  string      `json:"lastReqDt"`
-	RegrId     string      `json:"regrId"`
-	RegrNm     string      `json:"regrNm"`
-	ModrId     string      `json:"modrId"`
-	ModrNm     string      `json:"modrNm"`
-}
-
-type StockItem struct {
-	ItemCd     string  `json:"itemCd"`
-	ItemClsCd  string  `json:"itemClsCd"`
-	ItemNm     string  `json:"itemNm"`
-	PkgUnitCd  string  `json:"pkgUnitCd"`
-	QtyUnitCd  string  `json:"qtyUnitCd"`
-	TaxTyCd    string  `json:"taxTyCd"`
-	Bcd        string  `json:"bcd"`
-	RegBhfId   string  `json:"regBhfId"`
-	Pkg        int     `json:"pkg"`
-	Qty        int     `json:"qty"`
-	DcRt       float64 `json:"dcRt"`
-	SupplrTin  string  `json:"supplrTin"`
-	PchsTyCd   string  `json:"pchsTyCd"`
-	OrgnNatCd  string  `json:"orgnNatCd"`
-	ItemExprDt string  `json:"itemExprDt"`
-	ItemSttsCd string  `json:"itemSttsCd"`
-	RegrId     string  `json:"regrId"`
-	RegrNm     string  `json:"regrNm"`
-	ModrId     string  `json:"modrId"`
-	ModrNm     string  `json:"modrNm"`
-}
-
-type SaleItem struct {
-	ItemSeq    int     `json:"itemSeq"`
-	ItemCd     string  `json:"itemCd"`
-	ItemClsCd  string  `json:"itemClsCd"`
-	ItemNm     string  `json:"itemNm"`
-	PkgUnitCd  string  `json:"pkgUnitCd"`
-	QtyUnitCd  string  `json:"qtyUnitCd"`
-	Pkg        int     `json:"pkg"`
-	Qty        int     `json:"qty"`
-	PrcAmt     float64 `json:"prcAmt"`
-	DcRt       float64 `json:"dcRt"`
-	DcAmt      float64 `json:"dcAmt"`
-	TaxTyCd    string  `json:"taxTyCd"`
-	TaxAmt     float64 `json:"taxAmt"`
-	TotAmt     float64 `json:"totAmt"`
-	ItemExprDt string  `json:"itemExprDt"`
-}
-
-type GetItemRequest struct {
-	Tin       string `json:"tin"`
-	BhfId     string `json:"bhfId"`
-	LastReqDt string `json:"lastReqDt"`
-}
+// itemClsCd is the classification of the test item, resolved against the
+// local item classification tree before use.
+const itemClsCd = "5022110801"
 
 func main() {
 	// Configure logrus
@@ -359,17 +38,183 @@ func main() {
 	// Add file and line number to log output
 	log.SetReportCaller(true)
 
+	if len(os.Args) > 1 && os.Args[1] == "keystore-set" {
+		if err := keystoreSet(os.Args[2:]); err != nil {
+			log.WithError(err).Fatal("Failed to store secret")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "stock-moves" {
+		if err := reviewStockMoves(os.Stdout, os.Args[2:]); err != nil {
+			log.WithError(err).Fatal("Failed to review stock movements")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "outbox" {
+		if err := reviewOutbox(os.Stdout, os.Args[2:]); err != nil {
+			log.WithError(err).Fatal("Failed to review outbox")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "purchases" {
+		if err := reviewPurchases(os.Stdout, os.Args[2:]); err != nil {
+			log.WithError(err).Fatal("Failed to review purchases")
+		}
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load configuration")
+	}
+	redactor := etims.NewRedactor(cfg.Redact.Fields, cfg.Redact.Headers)
+	log.AddHook(redactor)
+
 	startTime := time.Now()
 	log.WithFields(logrus.Fields{
-		"tin":    tin,
-		"bhfId":  bhfId,
-		"cmcKey": cmcKey,
+		"profile":  cfg.Profile,
+		"tin":      cfg.Tin,
+		"branches": len(cfg.Branches),
+		"secrets":  cfg.Secrets.Source,
 	}).Info("Starting data synchronization process")
 
 	// Create a session ID for this run
 	sessionID := fmt.Sprintf("session_%d", startTime.UnixNano())
 	logger := log.WithField("session_id", sessionID)
 
+	a := &app{cfg: cfg, logger: logger, redactor: redactor}
+	a.secrets, err = newSecretSource(cfg.Secrets)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open secret source")
+	}
+	a.codes, err = etims.NewCodeRepository(filepath.Join(cfg.DataDir, "codes.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open code repository")
+	}
+	a.itemClasses, err = etims.NewItemClassTree(filepath.Join(cfg.DataDir, "itemclasses.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open item classification tree")
+	}
+	a.masterData, err = etims.NewMasterData(filepath.Join(cfg.DataDir, "masterdata.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open master data")
+	}
+	a.watermarks, err = etims.NewFileWatermarkStore(filepath.Join(cfg.DataDir, "watermarks.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open watermark store")
+	}
+	a.devices, err = etims.NewFileDeviceStore(filepath.Join(cfg.DataDir, "devices.json"), a.secrets, deviceKeyName(cfg.Branches))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open device store")
+	}
+	a.invoices, err = etims.OpenSequencer(filepath.Join(cfg.DataDir, "sequences.log"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open invoice sequencer")
+	}
+	defer a.invoices.Close()
+	a.sales, err = etims.NewSalesHistory(filepath.Join(cfg.DataDir, "sales.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open sales history")
+	}
+	a.purchases, err = etims.NewPurchaseInbox(filepath.Join(cfg.DataDir, "purchases.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open purchase inbox")
+	}
+	a.stock, err = etims.NewStockLedger(filepath.Join(cfg.DataDir, "stock.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open stock ledger")
+	}
+	a.transfers, err = etims.NewTransferRegister(filepath.Join(cfg.DataDir, "transfers.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open transfer register")
+	}
+	a.stockMoves, err = etims.NewStockMoveInbox(filepath.Join(cfg.DataDir, "stockmoves.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open stock movement inbox")
+	}
+	a.outbox, err = etims.OpenOutbox(filepath.Join(cfg.DataDir, "outbox.log"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open outbox")
+	}
+	defer a.outbox.Close()
+	a.transferService = etims.NewTransferService(a.transfers, a.stockMoves, a.invoices, a.outbox, a.stock, a.codes)
+
+	ctx := context.Background()
+	failed := 0
+	for _, branch := range cfg.Branches {
+		if err := a.syncBranch(ctx, branch); err != nil {
+			failed++
+			logger.WithError(err).WithField("bhfId", branch.BhfId).Error("Branch synchronization failed")
+		}
+	}
+	if failed > 0 {
+		a.outbox.Close()
+		logger.WithField("failed_branches", failed).Fatal("Data synchronization failed")
+	}
+
+	if err := a.transferService.CompleteTransfers(ctx, cfg.Tin); err != nil {
+		a.outbox.Close()
+		logger.WithError(err).Fatal("Failed to complete stock transfers")
+	}
+	logger.Info("Data synchronization completed successfully")
+}
+
+// app holds the state shared by every branch of the taxpayer.
+type app struct {
+	cfg         *config.Config
+	logger      logrus.FieldLogger
+	redactor    *etims.Redactor
+	secrets     secrets.Source
+	codes       *etims.CodeRepository
+	itemClasses *etims.ItemClassTree
+	masterData  *etims.MasterData
+	watermarks  *etims.FileWatermarkStore
+	devices     *etims.FileDeviceStore
+	invoices    *etims.Sequencer
+	sales       *etims.SalesHistory
+	purchases   *etims.PurchaseInbox
+	stock       *etims.StockLedger
+	transfers   *etims.TransferRegister
+	stockMoves  *etims.StockMoveInbox
+	outbox      *etims.Outbox
+
+	// transferService moves stock between the branches synchronized so
+	// far.
+	transferService *etims.TransferService
+}
+
+// syncBranch runs the synchronization sequence for one branch.
+func (a *app) syncBranch(ctx context.Context, branch config.Branch) error {
+	tin, bhfId := a.cfg.Tin, branch.BhfId
+	logger := a.logger.WithField("bhfId", bhfId)
+	codes, itemClasses, outbox := a.codes, a.itemClasses, a.outbox
+
+	// A branch initialized earlier may only have the CMC key stored in its
+	// device profile.
+	cmcKey, err := a.secrets.Secret(ctx, branch.CmcKeyName())
+	if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+		return fmt.Errorf("failed to load CMC key: %w", err)
+	}
+
+	client, err := etims.New(
+		etims.WithBaseURL(a.cfg.BaseURL),
+		etims.WithTIN(tin),
+		etims.WithBranchID(bhfId),
+		etims.WithCMCKey(cmcKey),
+		etims.WithLogger(logger),
+		etims.WithRedactor(a.redactor),
+		etims.WithCodeRepository(codes),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create eTIMS client: %w", err)
+	}
+	syncer := etims.NewSyncer(client, a.watermarks)
+	stock := etims.NewStockService(client, a.invoices, outbox, a.stock)
+	a.transferService.AddBranch(client)
+
 	// Track the number of successful and failed requests
 	stats := struct {
 		successful int
@@ -377,233 +222,260 @@ func main() {
 	}{0, 0}
 
 	// Helper function to handle common request/response pattern
-	makeRequest := func(endpoint string, requestBody []byte, description string) error {
+	makeRequest := func(endpoint string, description string, call func() (*etims.Result, error)) error {
 		requestLog := logger.WithFields(logrus.Fields{
 			"endpoint":   endpoint,
 			"request_id": fmt.Sprintf("%s_%d", description, time.Now().UnixNano()),
 		})
 
-		requestLog.WithField("request_body", string(requestBody)).Info(fmt.Sprintf("Sending %s request", description))
+		requestLog.Info(fmt.Sprintf("Sending %s request", description))
 
-		response, err := sendRequest(baseURL+endpoint, nil, requestBody)
+		result, err := call()
 		if err != nil {
 			stats.failed++
-			requestLog.WithError(err).Error(fmt.Sprintf("Failed to send %s request", description))
+			requestLog.WithError(err).WithField("class", etims.ClassOf(err)).Error(fmt.Sprintf("Failed to send %s request", description))
 			return fmt.Errorf("%s request failed: %w", description, err)
 		}
-		defer response.Body.Close()
-
-		body, err := io.ReadAll(response.Body)
-		if err != nil {
-			stats.failed++
-			requestLog.WithError(err).Error(fmt.Sprintf("Failed to read %s response body", description))
-			return fmt.Errorf("failed to read %s response body: %w", description, err)
-		}
 
 		requestLog.WithFields(logrus.Fields{
-			"status_code": response.StatusCode,
-			"headers":     response.Header,
-			"body":        string(body),
+			"result_cd":  result.ResultCd,
+			"result_msg": result.ResultMsg,
+			"result_dt":  result.ResultDt,
 		}).Info(fmt.Sprintf("Received %s response", description))
 
-		if response.StatusCode != http.StatusOK {
-			stats.failed++
-			return fmt.Errorf("%s request failed with status code: %d", description, response.StatusCode)
-		}
-
 		stats.successful++
 		return nil
 	}
 
 	// First, initialize the device
-	initRequest := InitRequest{
-		Tin:      tin,
-		BhfId:    bhfId,
-		DvcSrlNo: "7ba05e23-850a-44dd-b09a-2eac8405e592",
-	}
+	logger.WithFields(logrus.Fields{
+		"tin":      tin,
+		"bhfId":    bhfId,
+		"dvcSrlNo": branch.DvcSrlNo,
+		"force":    a.cfg.ForceInit,
+	}).Info("Initializing device")
 
-	initRequestBody, err := json.Marshal(initRequest)
+	profile, err := client.Initialize(ctx, a.devices, branch.DvcSrlNo, a.cfg.ForceInit)
 	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal init request")
+		return fmt.Errorf("initialization failed: %w", err)
 	}
-
-	logger.WithFields(logrus.Fields{
-		"tin":         tin,
-		"bhfId":       bhfId,
-		"dvcSrlNo":    initRequest.DvcSrlNo,
-		"requestBody": string(initRequestBody),
-	}).Info("Sending initialization request")
-
-	// Send initialization request
-	response, err := sendRequest(baseURL+"/initializer/selectInitInfo", map[string]string{
-		"Content-Type": "application/json; charset=utf-8",
-		"Accept":       "application/json",
-		"CMC-KEY":     cmcKey,
-		"User-Agent":  "etims-client/1.0",
-	}, initRequestBody)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to send initialization request")
+	if !profile.InitializedAt.IsZero() {
+		header := profile.ReceiptHeader()
+		logger.WithFields(logrus.Fields{
+			"taxprNm":     header.TaxprNm,
+			"bhfNm":       header.BhfNm,
+			"sdcId":       header.SdcId,
+			"mrcNo":       header.MrcNo,
+			"initialized": profile.InitializedAt.Format(time.RFC3339),
+		}).Info("Device profile loaded")
+	} else {
+		logger.Warn("Device is already initialized but no profile is stored locally")
+	}
+	invoiceKey := etims.SequenceKey{Tin: tin, BhfId: bhfId, Kind: etims.SequenceInvoice}
+	if err := a.invoices.Seed(ctx, invoiceKey, profile.Info.LastSaleInvcNo); err != nil {
+		return err
+	}
+	purchaseKey := etims.SequenceKey{Tin: tin, BhfId: bhfId, Kind: etims.SequencePurchase}
+	if err := a.invoices.Seed(ctx, purchaseKey, profile.Info.LastPchsInvcNo); err != nil {
+		return err
+	}
+	stockKey := etims.SequenceKey{Tin: tin, BhfId: bhfId, Kind: etims.SequenceStock}
+	if key := profile.Keys.CmcKey; key != "" && key != cmcKey {
+		// The device store keeps the key, in the keystore or else in its
+		// key file, until the operator stores it as the secret.
+		keyLog := logger.WithField("secret", branch.CmcKeyName())
+		if _, ok := a.secrets.(*secrets.Keystore); ok {
+			keyLog.Info("VSCU issued a new CMC key")
+		} else {
+			keyLog.WithField("key_file", a.devices.KeyFile()).Warn("Using the CMC key issued to the device; store it as the secret")
+		}
 	}
-	defer response.Body.Close()
 
-	body, err := io.ReadAll(response.Body)
+	// Send declarations queued while the VSCU was unreachable before making
+	// new ones, so they reach eTIMS in the order they were made.
+	sent, err := outbox.Drain(ctx, client, func(entry etims.OutboxEntry, receipt *etims.TrnsSalesSaveRes, err error) {
+		if err != nil {
+			// A rejected entry keeps its number until it is resubmitted
+			// or discarded with the outbox command.
+			return
+		}
+		var key etims.SequenceKey
+		var no int64
+		var record func() error
+		switch entry.Path {
+		case etims.PathSaveSales:
+			var sale etims.TrnsSalesSaveWrReq
+			if jerr := json.Unmarshal(entry.Payload, &sale); jerr != nil {
+				logger.WithError(jerr).WithField("seq", entry.Seq).Error("Failed to decode queued sale")
+				return
+			}
+			key, no = invoiceKey, sale.InvcNo
+			record = func() error {
+				return errors.Join(a.sales.Record(ctx, sale, receipt), a.declareSalesStock(ctx, stock, sale))
+			}
+		case etims.PathSavePurchases:
+			var purchase etims.TrnsPurchaseSaveReq
+			if jerr := json.Unmarshal(entry.Payload, &purchase); jerr != nil {
+				logger.WithError(jerr).WithField("seq", entry.Seq).Error("Failed to decode queued purchase")
+				return
+			}
+			key, no = purchaseKey, purchase.InvcNo
+			inboxKey := etims.PurchaseKey{Tin: purchase.Tin, BhfId: purchase.BhfId, SpplrTin: purchase.SpplrTin, SpplrBhfId: purchase.SpplrBhfId, SpplrInvcNo: purchase.SpplrInvcNo}
+			record = func() error {
+				return errors.Join(
+					a.purchases.MarkDeclared(ctx, inboxKey, purchase.PchsSttsCd, purchase.InvcNo),
+					a.declarePurchaseStock(ctx, stock, purchase),
+				)
+			}
+		case etims.PathSaveStockItems:
+			var movement etims.StockIOSaveReq
+			if jerr := json.Unmarshal(entry.Payload, &movement); jerr != nil {
+				logger.WithError(jerr).WithField("seq", entry.Seq).Error("Failed to decode queued stock movement")
+				return
+			}
+			key, no = stockKey, movement.SarNo
+			record = func() error { return stock.Post(ctx, movement) }
+		default:
+			return
+		}
+		if serr := errors.Join(a.invoices.Confirm(ctx, key, no), record()); serr != nil {
+			logger.WithError(serr).WithFields(logrus.Fields{"kind": key.Kind, "no": no}).Error("Failed to settle queued declaration")
+		}
+	})
 	if err != nil {
-		logger.WithError(err).Fatal("Failed to read initialization response body")
+		logger.WithError(err).Warn("Failed to drain outbox")
 	}
-
-	// Log response details
-	logger.WithFields(logrus.Fields{
-		"statusCode":    response.StatusCode,
-		"headers":       response.Header,
-		"responseBody": string(body),
-		"contentType":  response.Header.Get("Content-Type"),
-	}).Info("Received initialization response")
-
-	if response.StatusCode != http.StatusOK {
+	for _, status := range outbox.Status() {
+		if status.Tin != tin || status.BhfId != bhfId {
+			continue
+		}
 		logger.WithFields(logrus.Fields{
-			"statusCode": response.StatusCode,
-			"body":      string(body),
-		}).Fatal("Initialization request failed")
+			"tin":       status.Tin,
+			"bhfId":     status.BhfId,
+			"pending":   status.Pending,
+			"oldest":    status.Oldest.Format(time.RFC3339),
+			"remaining": status.Remaining(time.Now()).Round(time.Minute).String(),
+		}).Warn("Declarations waiting in outbox")
+	}
+	for _, rejected := range outbox.Rejected() {
+		if rejected.Tin != tin || rejected.BhfId != bhfId {
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"seq":        rejected.Seq,
+			"path":       rejected.Path,
+			"result_cd":  rejected.ResultCd,
+			"result_msg": rejected.ResultMsg,
+		}).Error("Queued declaration was rejected; resubmit or discard it with the outbox command")
 	}
-
-	logger.Info("Device initialization successful, proceeding with data synchronization...")
+	logger.WithField("sent", sent).Info("Drained outbox")
 
 	// 1. Code Data Sequence
-	codeRequest := CodeRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
-	}
-
-	codeRequestBody, err := json.Marshal(codeRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal code request")
-	}
-
-	if err := makeRequest("/code/selectCodes", codeRequestBody, "code list"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch code list")
+	if err := makeRequest(etims.PathSelectCodes, "code list", func() (*etims.Result, error) {
+		return syncer.SyncCodes(ctx, codes.Save)
+	}); err != nil {
+		return err
 	}
 
 	// 2. Notice List
-	noticeRequest := NoticeRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
-	}
-
-	noticeRequestBody, err := json.Marshal(noticeRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal notice request")
-	}
-
-	if err := makeRequest("/notices/selectNotices", noticeRequestBody, "notice list"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch notice list")
+	if err := makeRequest(etims.PathSelectNotices, "notice list", func() (*etims.Result, error) {
+		return syncer.SyncNotices(ctx, func(ctx context.Context, data *etims.NoticeRes) error {
+			logger.WithField("notices", len(data.NoticeList)).Info("Retrieved notice list")
+			return a.masterData.SaveNotices(ctx, data)
+		})
+	}); err != nil {
+		return err
 	}
 
 	// 3. Branch List
-	branchRequest := BranchRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
-	}
-
-	branchRequestBody, err := json.Marshal(branchRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal branch request")
-	}
-
-	if err := makeRequest("/branches/selectBranches", branchRequestBody, "branch list"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch branch list")
+	if err := makeRequest(etims.PathSelectBranches, "branch list", func() (*etims.Result, error) {
+		return syncer.SyncBranches(ctx, func(ctx context.Context, data *etims.BhfRes) error {
+			logger.WithField("branches", len(data.BhfList)).Info("Retrieved branch list")
+			return a.masterData.SaveBranches(ctx, data)
+		})
+	}); err != nil {
+		return err
 	}
 
 	// 4. Import Items
-	importRequest := ImportItemRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
-	}
-
-	importRequestBody, err := json.Marshal(importRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal import request")
-	}
-
-	if err := makeRequest("/imports/selectImportItems", importRequestBody, "import items"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch import items")
+	if err := makeRequest(etims.PathSelectImportItems, "import items", func() (*etims.Result, error) {
+		return syncer.SyncImportItems(ctx, func(ctx context.Context, data *etims.ImptItemRes) error {
+			logger.WithField("import_items", len(data.ItemList)).Info("Retrieved import items")
+			return a.masterData.SaveImportItems(ctx, tin, bhfId, data)
+		})
+	}); err != nil {
+		return err
 	}
 
 	// 5. Purchase Transactions
-	purchaseRequest := PurchaseRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
-	}
-
-	purchaseRequestBody, err := json.Marshal(purchaseRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal purchase request")
-	}
-
-	if err := makeRequest("/trnsPurchase/selectTrnsPurchaseSales", purchaseRequestBody, "purchase transactions"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch purchase transactions")
+	if err := makeRequest(etims.PathSelectTrnsPurchaseSales, "purchase transactions", func() (*etims.Result, error) {
+		return syncer.SyncPurchaseSales(ctx, func(ctx context.Context, data *etims.TrnsPurchaseSalesRes) error {
+			added, err := a.purchases.Add(ctx, tin, bhfId, data.SaleList)
+			if err != nil {
+				return err
+			}
+			logger.WithFields(logrus.Fields{"purchases": len(data.SaleList), "new": added}).Info("Retrieved purchase transactions")
+			return nil
+		})
+	}); err != nil {
+		return err
 	}
 
-	// 6. Stock Items
-	stockRequest := StockRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		ItemCd:    "KE1NTXU0000006",
-		RsdQty:    10,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
-		RegrId:    "Admin",
-		RegrNm:    "Admin",
-		ModrId:    "Admin",
-		ModrNm:    "Admin",
+	// Declare the supplier invoices accounts payable has reviewed; pending
+	// ones wait in the inbox.
+	for _, p := range a.purchases.List(tin, bhfId, etims.PurchaseAccepted, etims.PurchaseRejected) {
+		if err := a.declarePurchase(ctx, client, stock, logger, purchaseKey, p); err != nil {
+			return err
+		}
 	}
-
-	stockRequestBody, err := json.Marshal(stockRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal stock request")
+	logger.WithField("pending", len(a.purchases.List(tin, bhfId, etims.PurchasePending))).Info("Supplier invoices awaiting review")
+
+	// 6. Stock Movements: keep what other branches and taxpayers moved to
+	// this branch in the inbox until an operator approves it.
+	if err := makeRequest(etims.PathSelectStockItems, "stock movement", func() (*etims.Result, error) {
+		return syncer.SyncStockMoves(ctx, func(ctx context.Context, data *etims.StockMoveRes) error {
+			added, err := a.stockMoves.Add(ctx, tin, bhfId, data.StockList)
+			if err != nil {
+				return err
+			}
+			logger.WithFields(logrus.Fields{"stock_movements": len(data.StockList), "new": added}).Info("Retrieved stock movements")
+			return a.reconcileTransfers(ctx, logger, tin, bhfId, data.StockList)
+		})
+	}); err != nil {
+		return err
 	}
-
-	if err := makeRequest("/stock/selectStockItems", stockRequestBody, "stock items"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch stock items")
+	for _, m := range a.stockMoves.List(tin, bhfId, etims.StockMoveApproved) {
+		if err := a.receiveStock(ctx, stock, logger, m); err != nil {
+			return err
+		}
 	}
+	logger.WithField("pending", len(a.stockMoves.List(tin, bhfId, etims.StockMovePending))).Info("Stock movements awaiting approval")
 
 	// 7. Item Classification List
-	itemClassRequest := ItemClassRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
-	}
-
-	itemClassRequestBody, err := json.Marshal(itemClassRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal item classification request")
-	}
-
-	if err := makeRequest("/itemClass/selectItemsClass", itemClassRequestBody, "item classification list"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch item classification list")
+	if err := makeRequest(etims.PathSelectItemsClass, "item classification list", func() (*etims.Result, error) {
+		return syncer.SyncItemClasses(ctx, func(ctx context.Context, data *etims.ItemClsRes) error {
+			logger.WithField("item_classes", len(data.ItemClsList)).Info("Retrieved item classifications")
+			return itemClasses.Save(ctx, data)
+		})
+	}); err != nil {
+		return err
 	}
 
 	// 8. Customer List (PIN List)
-	customerRequest := CustomerRequest{
+	customerRequest := etims.CustomerRequest{
 		Tin:      tin,
 		BhfId:    bhfId,
 		CustmTin: "A123456789Z", // Must be between 9-15 characters
 	}
 
-	customerRequestBody, err := json.Marshal(customerRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal customer request")
-	}
-
-	if err := makeRequest("/customers/selectCustomer", customerRequestBody, "customer list"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch customer list")
+	if err := makeRequest(etims.PathSelectCustomer, "customer list", func() (*etims.Result, error) {
+		return result(client.SelectCustomer(ctx, customerRequest))
+	}); err != nil {
+		return err
 	}
 
 	// 9. Send Branch Customer Information
-	branchCustomerRequest := BranchCustomerRequest{
+	branchCustomerRequest := etims.BranchCustomerRequest{
 		Tin:     tin,
 		BhfId:   bhfId,
 		CustNo:  "CUST001",
@@ -616,17 +488,14 @@ func main() {
 		ModrId:  "Admin",
 	}
 
-	branchCustomerRequestBody, err := json.Marshal(branchCustomerRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal branch customer request")
-	}
-
-	if err := makeRequest("/branches/saveBrancheCustomers", branchCustomerRequestBody, "branch customer information"); err != nil {
-		logger.WithError(err).Fatal("Failed to send branch customer information")
+	if err := makeRequest(etims.PathSaveBranchCustomers, "branch customer information", func() (*etims.Result, error) {
+		return client.SaveBranchCustomer(ctx, branchCustomerRequest)
+	}); err != nil {
+		return err
 	}
 
 	// 10. Send Branch User Account
-	branchUserRequest := BranchUserRequest{
+	branchUserRequest := etims.BranchUserRequest{
 		Tin:    tin,
 		BhfId:  bhfId,
 		UserId: "user001",
@@ -640,38 +509,36 @@ func main() {
 		ModrNm: "Admin",
 	}
 
-	branchUserRequestBody, err := json.Marshal(branchUserRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal branch user request")
-	}
-
-	if err := makeRequest("/branches/saveBrancheUsers", branchUserRequestBody, "branch user account"); err != nil {
-		logger.WithError(err).Fatal("Failed to send branch user account")
+	if err := makeRequest(etims.PathSaveBranchUsers, "branch user account", func() (*etims.Result, error) {
+		return client.SaveBranchUser(ctx, branchUserRequest)
+	}); err != nil {
+		return err
 	}
 
 	// 11. Item Classification
-	itemClassRequest = ItemClassRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
-	}
-
-	itemClassRequestBody, err = json.Marshal(itemClassRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal item classification request")
-	}
-
-	if err := makeRequest("/itemClass/selectItemsClass", itemClassRequestBody, "item classification"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch item classification")
+	if itemCls, ok := itemClasses.Lookup(itemClsCd); ok {
+		var clsPath []string
+		for _, cls := range itemClasses.Ancestors(itemClsCd) {
+			clsPath = append(clsPath, cls.ItemClsNm)
+		}
+		logger.WithFields(logrus.Fields{
+			"item_cls_cd":  itemCls.ItemClsCd,
+			"item_cls_nm":  itemCls.ItemClsNm,
+			"item_cls_lvl": itemCls.ItemClsLvl,
+			"path":         strings.Join(clsPath, " > "),
+			"tax_ty_cd":    itemClasses.DefaultTaxType(itemClsCd),
+		}).Info("Resolved item classification")
+	} else {
+		logger.WithField("item_cls_cd", itemClsCd).Warn("Item classification is not in the local tree")
 	}
 
 	// 12. Branch Insurance
-	branchInsuranceRequest := BranchInsuranceRequest{
+	branchInsuranceRequest := etims.BranchInsuranceRequest{
 		Tin:     tin,
 		BhfId:   bhfId,
 		IsrccCd: "ISRCC01",
 		IsrccNm: "Sample Insurance",
-		IsrcRt:  16.0,
+		IsrcRt:  etims.NewDecimal(16),
 		UseYn:   "Y",
 		RegrNm:  "Admin",
 		RegrId:  "Admin",
@@ -679,21 +546,18 @@ func main() {
 		ModrId:  "Admin",
 	}
 
-	branchInsuranceRequestBody, err := json.Marshal(branchInsuranceRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal branch insurance request")
-	}
-
-	if err := makeRequest("/branches/saveBrancheInsurances", branchInsuranceRequestBody, "branch insurance"); err != nil {
-		logger.WithError(err).Fatal("Failed to send branch insurance")
+	if err := makeRequest(etims.PathSaveBranchInsurances, "branch insurance", func() (*etims.Result, error) {
+		return client.SaveBranchInsurance(ctx, branchInsuranceRequest)
+	}); err != nil {
+		return err
 	}
 
 	// 13. Save Item
-	itemRequest := ItemRequest{
+	itemRequest := etims.ItemRequest{
 		Tin:         tin,
 		BhfId:       bhfId,
 		ItemCd:      "KE1NTXU0000007",
-		ItemClsCd:   "5022110801",
+		ItemClsCd:   itemClsCd,
 		ItemTyCd:    "1",
 		ItemNm:      "Test Item",
 		ItemStdNm:   "Standard Item",
@@ -702,7 +566,7 @@ func main() {
 		QtyUnitCd:   "U",
 		TaxTyCd:     "B",
 		BtchNo:      "",
-		DftPrc:      1000.00,
+		DftPrc:      etims.NewDecimal(1000),
 		IsrcAplcbYn: "N",
 		UseYn:       "Y",
 		RegrNm:      "Admin",
@@ -711,55 +575,32 @@ func main() {
 		ModrId:      "Admin",
 	}
 
-	itemRequestBody, err := json.Marshal(itemRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal item request")
-	}
-
-	if err := makeRequest("/items/saveItems", itemRequestBody, "item"); err != nil {
-		logger.WithError(err).Fatal("Failed to send item")
-	}
-
-	// 14. Stock Master
-	stockMasterRequest := StockMasterRequest{
-		Tin:    tin,
-		BhfId:  bhfId,
-		ItemCd: "KE1NTXU0000007",
-		RsdQty: 100,
-		RegrId: "Admin",
-		RegrNm: "Admin",
-		ModrId: "Admin",
-		ModrNm: "Admin",
-	}
-
-	stockMasterRequestBody, err := json.Marshal(stockMasterRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal stock master request")
-	}
-
-	if err := makeRequest("/stockMaster/saveStockMaster", stockMasterRequestBody, "stock master"); err != nil {
-		logger.WithError(err).Fatal("Failed to send stock master")
+	if err := makeRequest(etims.PathSaveItems, "item", func() (*etims.Result, error) {
+		return client.SaveItem(ctx, itemRequest)
+	}); err != nil {
+		return err
 	}
 
 	// Test Customer Information
-	customerInfoRequest := CustomerInfoRequest{
+	customerInfoRequest := etims.CustomerInfoRequest{
 		Tin:        tin,
 		CustmTin:   "A123456789Z",
 		CustmBhfId: "00",
 		LastReqDt:  time.Now().Format("20060102150405"), // Current timestamp
 	}
 
-	customerInfoRequestBody, err := json.Marshal(customerInfoRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal customer info request")
-	}
-
-	if err := makeRequest("/customers/selectCustomer", customerInfoRequestBody, "customer info"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch customer info")
+	if err := makeRequest(etims.PathSelectCustomer, "customer info", func() (*etims.Result, error) {
+		var res etims.Response[etims.CustRes]
+		if err := client.Do(ctx, etims.PathSelectCustomer, customerInfoRequest, &res); err != nil {
+			return nil, err
+		}
+		return &res.Result, nil
+	}); err != nil {
+		return err
 	}
 
 	// Save Branch Customer
-	branchCustomerRequest = BranchCustomerRequest{
+	branchCustomerRequest = etims.BranchCustomerRequest{
 		Tin:     tin,
 		BhfId:   bhfId,
 		CustNo:  "CUST001",
@@ -772,17 +613,14 @@ func main() {
 		ModrNm:  "Admin",
 	}
 
-	branchCustomerRequestBody, err = json.Marshal(branchCustomerRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal branch customer request")
-	}
-
-	if err := makeRequest("/branches/saveBrancheCustomers", branchCustomerRequestBody, "branch customer"); err != nil {
-		logger.WithError(err).Fatal("Failed to send branch customer")
+	if err := makeRequest(etims.PathSaveBranchCustomers, "branch customer", func() (*etims.Result, error) {
+		return client.SaveBranchCustomer(ctx, branchCustomerRequest)
+	}); err != nil {
+		return err
 	}
 
 	// Save Branch User Account
-	branchUserRequest = BranchUserRequest{
+	branchUserRequest = etims.BranchUserRequest{
 		Tin:    tin,
 		BhfId:  bhfId,
 		UserId: "USER001",
@@ -796,22 +634,19 @@ func main() {
 		ModrNm: "Admin",
 	}
 
-	branchUserRequestBody, err = json.Marshal(branchUserRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal branch user request")
-	}
-
-	if err := makeRequest("/branches/saveBrancheUsers", branchUserRequestBody, "branch user account"); err != nil {
-		logger.WithError(err).Fatal("Failed to send branch user account")
+	if err := makeRequest(etims.PathSaveBranchUsers, "branch user account", func() (*etims.Result, error) {
+		return client.SaveBranchUser(ctx, branchUserRequest)
+	}); err != nil {
+		return err
 	}
 
 	// Save Item Composition
-	itemCompositionRequest := ItemCompositionRequest{
+	itemCompositionRequest := etims.ItemCompositionRequest{
 		Tin:        tin,
 		BhfId:      bhfId,
 		ItemCd:     "KE1NTXU0000007", // Using the item we created earlier
 		CpstItemCd: "KE1NTXU0000006", // Using existing item from stock request
-		CpstQty:    1.0,
+		CpstQty:    etims.NewDecimal(1),
 		CpstUnitCd: "U",
 		RegrId:     "Admin",
 		RegrNm:     "Admin",
@@ -819,268 +654,657 @@ func main() {
 		ModrNm:     "Admin",
 	}
 
-	itemCompositionRequestBody, err := json.Marshal(itemCompositionRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal item composition request")
-	}
-
-	if err := makeRequest("/items/saveItemComposition", itemCompositionRequestBody, "item composition"); err != nil {
-		logger.WithError(err).Fatal("Failed to send item composition")
-	}
-
-	// Stock In/Out
-	stockInOutRequest := StockInOutRequest{
-		Tin:    tin,
-		BhfId:  bhfId,
-		StockItems: []StockItem{
-			{
-				ItemCd:     "KE1NTXU0000007", // Using the item we created earlier
-				ItemClsCd:  "5022110801",
-				ItemNm:     "Test Item",
-				PkgUnitCd:  "NT",
-				QtyUnitCd:  "U",
-				TaxTyCd:    "B",
-				Bcd:        "",
-				RegBhfId:   bhfId,
-				Pkg:        1,
-				Qty:        10,
-				DcRt:       0,
-				SupplrTin:  tin,           // Using our own TIN as supplier
-				PchsTyCd:   "NS",          // Changed to NS (Normal Stock)
-				OrgnNatCd:  "KE",          // Origin nation code
-				ItemExprDt: "20241231",    // Item expiry date
-				ItemSttsCd: "01",          // Item status code
-				RegrId:     "Admin",
-				RegrNm:     "Admin",
-				ModrId:     "Admin",
-				ModrNm:     "Admin",
-			},
-		},
-		LastReqDt: time.Now().Format("20060102150405"), // Using current timestamp
-		RegrId:    "Admin",
-		RegrNm:    "Admin",
-		ModrId:    "Admin",
-		ModrNm:    "Admin",
-	}
-
-	stockInOutRequestBody, err := json.Marshal(stockInOutRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal stock in/out request")
-	}
-
-	if err := makeRequest("/stock/saveStockItems", stockInOutRequestBody, "stock in/out"); err != nil {
-		logger.WithError(err).Fatal("Failed to send stock in/out")
+	if err := makeRequest(etims.PathSaveItemComposition, "item composition", func() (*etims.Result, error) {
+		return client.SaveItemComposition(ctx, itemCompositionRequest)
+	}); err != nil {
+		return err
 	}
 
 	// Get Item Information
-	itemInfoRequest := GetItemRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
-	}
-
-	itemInfoRequestBody, err := json.Marshal(itemInfoRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal item info request")
-	}
-
-	if err := makeRequest("/items/selectItems", itemInfoRequestBody, "item information"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch item information")
+	if err := makeRequest(etims.PathSelectItems, "item information", func() (*etims.Result, error) {
+		return syncer.SyncItems(ctx, func(ctx context.Context, data *etims.ItemRes) error {
+			logger.WithField("items", len(data.ItemList)).Info("Retrieved item information")
+			return a.masterData.SaveItems(ctx, data)
+		})
+	}); err != nil {
+		return err
 	}
 
 	// Send Converted Import Item Information
-	importUpdateRequest := struct {
-		Tin            string  `json:"tin"`
-		BhfId          string  `json:"bhfId"`
-		TaskCd         string  `json:"taskCd"`
-		DclDe          string  `json:"dclDe"`
-		ItemSeq        int     `json:"itemSeq"`
-		HsCd           string  `json:"hsCd"`
-		ItemClsCd      string  `json:"itemClsCd"`
-		ItemCd         string  `json:"itemCd"`
-		ImptItemSttsCd string  `json:"imptItemSttsCd"`
-		Remark         string  `json:"remark"`
-		ModrNm         string  `json:"modrNm"`
-		ModrId         string  `json:"modrId"`
-	}{
+	importUpdateRequest := etims.ImportItemUpdateRequest{
 		Tin:            tin,
 		BhfId:          bhfId,
 		TaskCd:         "2231943",
 		DclDe:          "20240101",
 		ItemSeq:        1,
 		HsCd:           "1231531231",
-		ItemClsCd:      "5022110801",
+		ItemClsCd:      itemClsCd,
 		ItemCd:         "KE1NTXU0000001",
-		ImptItemSttsCd: "1",
+		ImptItemSttsCd: etims.ImportItemApproved,
 		Remark:         "Import update",
 		ModrNm:         "Admin",
 		ModrId:         "Admin",
 	}
 
-	importUpdateRequestBody, err := json.Marshal(importUpdateRequest)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal import update request")
+	if err := makeRequest(etims.PathUpdateImportItems, "import update", func() (*etims.Result, error) {
+		return client.UpdateImportItem(ctx, importUpdateRequest)
+	}); err != nil {
+		return err
 	}
-
-	if err := makeRequest("/imports/updateImportItems", importUpdateRequestBody, "import update"); err != nil {
-		logger.WithError(err).Fatal("Failed to update import items")
+	if err := a.declareImportStock(ctx, stock, logger, importUpdateRequest); err != nil {
+		return err
 	}
 
 	// Sales Transaction
-	salesTransactionRequest := SalesTransactionRequest{
-		Tin:         tin,
-		BhfId:       bhfId,
-		SalesTyCd:   "NS",        // Changed to NS (Normal Sale)
-		RcptTyCd:    "NR",        // Changed to NR (Normal Receipt)
-		CustTin:     tin,         // Using our own TIN as customer
-		CustNm:      "Test Customer",
-		CustBhfId:   bhfId,
-		SalesSttsCd: "02",        // 02: Completed
-		CfmDt:       "20241211085127", // Current timestamp
-		SaleItems: []SaleItem{
+	tax, err := etims.NewTaxCalculator(codes, etims.TaxExclusive, etims.RoundHalfUp)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	trdInvcNo := fmt.Sprintf("TRD-%s-%s", bhfId, now.Format("20060102150405"))
+	invcNo, err := a.invoices.Next(ctx, invoiceKey, trdInvcNo)
+	if err != nil {
+		return fmt.Errorf("failed to allocate invoice number: %w", err)
+	}
+	salesTransactionRequest := etims.TrnsSalesSaveWrReq{
+		Tin:          tin,
+		BhfId:        bhfId,
+		TrdInvcNo:    trdInvcNo,
+		InvcNo:       invcNo,
+		CustTin:      tin, // Using our own TIN as customer
+		CustNm:       "Test Customer",
+		SalesTyCd:    "N",  // N: Normal
+		RcptTyCd:     "S",  // S: Sale
+		PmtTyCd:      "01", // 01: Cash
+		SalesSttsCd:  "02", // 02: Approved
+		CfmDt:        now.Format("20060102150405"),
+		SalesDt:      now.Format("20060102"),
+		StockRlsDt:   now.Format("20060102150405"),
+		PrchrAcptcYn: "N",
+		RegrId:       "Admin",
+		RegrNm:       "Admin",
+		ModrId:       "Admin",
+		ModrNm:       "Admin",
+		Receipt: etims.TrnsSalesSaveWrReceipt{
+			CustTin:      tin,
+			RptNo:        1,
+			TopMsg:       "Test Shop",
+			BtmMsg:       "Thank you",
+			PrchrAcptcYn: "N",
+		},
+		ItemList: []etims.TrnsSalesSaveWrItem{
 			{
-				ItemSeq:    1,
-				ItemCd:     "KE1NTXU0000007", // Using the item we created earlier
-				ItemClsCd:  "5022110801",
-				ItemNm:     "Test Item",
-				PkgUnitCd:  "NT",
-				QtyUnitCd:  "U",
-				Pkg:        1,
-				Qty:        1,
-				PrcAmt:     1000.00,
-				DcRt:       0,
-				DcAmt:      0,
-				TaxTyCd:    "B",
-				TaxAmt:     160.00,
-				TotAmt:     1160.00,
-				ItemExprDt: "20241231",
+				ItemSeq:   1,
+				ItemClsCd: itemClsCd,
+				ItemCd:    "KE1NTXU0000007", // Using the item we created earlier
+				ItemNm:    "Test Item",
+				PkgUnitCd: "NT",
+				Pkg:       etims.NewDecimal(1),
+				QtyUnitCd: "U",
+				Qty:       etims.NewDecimal(1),
+				Prc:       etims.NewDecimal(1000),
+				TaxTyCd:   "B",
 			},
 		},
-		TotItemCnt:  1,
-		TaxblAmtA:   0,
-		TaxblAmtB:   1000.00,
-		TaxblAmtC:   0,
-		TaxblAmtD:   0,
-		TaxblAmtE:   0,
-		TaxRtA:      0,
-		TaxRtB:      16,
-		TaxRtC:      0,
-		TaxRtD:      0,
-		TaxRtE:      0,
-		TaxAmtA:     0,
-		TaxAmtB:     160.00,
-		TaxAmtC:     0,
-		TaxAmtD:     0,
-		TaxAmtE:     0,
-		TotTaxblAmt: 1000.00,
-		TotTaxAmt:   160.00,
-		TotAmt:      1160.00,
-		PmtTyCd:     "01",       // 01: Cash
-		RegrId:      "Admin",
-		RegrNm:      "Admin",
-		ModrId:      "Admin",
-		ModrNm:      "Admin",
+	}
+	if err := tax.ApplySales(&salesTransactionRequest); err != nil {
+		return err
 	}
 
-	salesTransactionRequestBody, err := json.Marshal(salesTransactionRequest)
+	var receipt *etims.TrnsSalesSaveRes
+	if err := makeRequest(etims.PathSaveSales, "sales transaction", func() (*etims.Result, error) {
+		res, err := client.SaveSales(ctx, salesTransactionRequest)
+		if err == nil {
+			receipt = res.Data
+		}
+		return result(res, err)
+	}); etims.IsTransport(err) {
+		// The invoice number stays allocated, and shows as pending in the
+		// audit, until the queued sale is delivered.
+		if _, err := outbox.EnqueueSales(ctx, salesTransactionRequest); err != nil {
+			return fmt.Errorf("failed to queue sales transaction: %w", err)
+		}
+		logger.Warn("VSCU unreachable, sales transaction queued in outbox")
+	} else if err != nil {
+		if verr := a.invoices.Void(ctx, invoiceKey, invcNo, err.Error()); verr != nil {
+			logger.WithError(verr).Error("Failed to void invoice number")
+		}
+		return err
+	} else if err := a.invoices.Confirm(ctx, invoiceKey, invcNo); err != nil {
+		return err
+	} else if err := a.sales.Record(ctx, salesTransactionRequest, receipt); err != nil {
+		return err
+	} else if err := a.declareSalesStock(ctx, stock, salesTransactionRequest); err != nil {
+		return err
+	}
+
+	// Credit Note for the sale, if it was accepted
+	if _, ok := a.sales.Sale(tin, bhfId, invcNo); ok {
+		var note *etims.CreditNote
+		err := makeRequest(etims.PathSaveSales, "credit note", func() (*etims.Result, error) {
+			var err error
+			note, err = client.CreateCreditNote(ctx, a.sales, a.invoices, invcNo, []etims.CreditNoteLine{
+				{ItemSeq: 1, Qty: etims.NewDecimal(1)},
+			}, etims.CreditNoteRefund)
+			if err != nil {
+				return nil, err
+			}
+			return &note.Response.Result, nil
+		})
+		if etims.IsTransport(err) {
+			if _, err := outbox.EnqueueSales(ctx, note.Request); err != nil {
+				return fmt.Errorf("failed to queue credit note: %w", err)
+			}
+			logger.Warn("VSCU unreachable, credit note queued in outbox")
+		} else if err != nil {
+			return err
+		} else {
+			logger.WithFields(logrus.Fields{
+				"invc_no":     note.Request.InvcNo,
+				"org_invc_no": note.Request.OrgInvcNo,
+				"tot_amt":     note.Request.TotAmt.String(),
+			}).Info("Credit note issued")
+			if err := a.declareSalesStock(ctx, stock, note.Request); err != nil {
+				return err
+			}
+		}
+	}
+
+	audit := a.invoices.Audit(invoiceKey)
+	auditLog := logger.WithFields(logrus.Fields{
+		"last_invc_no": audit.Last,
+		"pending":      len(audit.Pending),
+		"voided":       len(audit.Voided),
+		"missing":      audit.Missing,
+	})
+	if audit.Clean() {
+		auditLog.Info("Invoice sequence is complete")
+	} else {
+		auditLog.Warn("Invoice sequence has unaccounted numbers")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"successful_requests": stats.successful,
+		"failed_requests":     stats.failed,
+	}).Info("Branch synchronization completed")
+	return nil
+}
+
+// declarePurchase declares a reviewed supplier invoice of the inbox as
+// approved or canceled. A declaration the VSCU could not be reached for is
+// queued in the outbox; one it refused goes back to pending for review.
+func (a *app) declarePurchase(ctx context.Context, client *etims.Client, stock *etims.StockService, logger logrus.FieldLogger, key etims.SequenceKey, p etims.InboxPurchase) error {
+	log := logger.WithField("supplier_invoice", p.Key().String())
+
+	req, err := p.Declaration()
 	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal sales transaction request")
+		return err
+	}
+	// A supplier item the taxpayer registered under the same code is
+	// declared as its own, so the purchase can bring it into stock.
+	for i, item := range req.ItemList {
+		if _, ok := a.masterData.Item(req.Tin, item.SpplrItemCd); ok && item.ItemCd == "" {
+			req.ItemList[i].ItemCd = item.SpplrItemCd
+		}
 	}
+	req.RegrId, req.RegrNm = "Admin", "Admin"
+	req.ModrId, req.ModrNm = "Admin", "Admin"
+
+	resend := false
+	invcNo, err := a.invoices.Next(ctx, key, p.Ref())
+	if errors.Is(err, etims.ErrDuplicateReference) {
+		// Numbered on an earlier run, which stopped before updating the
+		// inbox.
+		n, _ := a.invoices.Lookup(key, p.Ref())
+		log := log.WithField("invc_no", n.No)
+		switch {
+		case n.State == etims.NumberConfirmed:
+			req.InvcNo = n.No
+			return errors.Join(
+				a.purchases.MarkDeclared(ctx, p.Key(), req.PchsSttsCd, n.No),
+				a.declarePurchaseStock(ctx, stock, req),
+			)
+		case n.State == etims.NumberVoided:
+			return a.purchases.Reopen(ctx, p.Key(), n.Reason)
+		case a.outbox.Queued(req.Tin, req.BhfId, etims.PathSavePurchases, n.No):
+			log.Info("Purchase already queued")
+			return nil
+		}
+		// The earlier run may have stopped before or after sending it.
+		invcNo, err, resend = n.No, nil, true
+	}
+	if err != nil {
+		return fmt.Errorf("failed to allocate purchase number: %w", err)
+	}
+
+	req.InvcNo = invcNo
 
-	if err := makeRequest("/trnsSales/saveSales", salesTransactionRequestBody, "sales transaction"); err != nil {
-		logger.WithError(err).Fatal("Failed to send sales transaction")
+	_, err = client.SavePurchase(ctx, req)
+	switch {
+	case etims.IsTransport(err):
+		if _, err := a.outbox.EnqueuePurchase(ctx, req); err != nil {
+			return fmt.Errorf("failed to queue purchase: %w", err)
+		}
+		log.Warn("VSCU unreachable, purchase queued in outbox")
+		return nil
+	case resend && etims.IsDuplicate(err):
+		// The earlier run's request reached the VSCU, which holds the
+		// number already.
+	case err != nil:
+		log.WithError(err).Warn("Purchase declaration rejected")
+		return errors.Join(
+			a.invoices.Void(ctx, key, invcNo, err.Error()),
+			a.purchases.Reopen(ctx, p.Key(), err.Error()),
+		)
+	}
+	log.WithFields(logrus.Fields{"invc_no": invcNo, "status": p.Status}).Info("Purchase declared")
+	return errors.Join(
+		a.invoices.Confirm(ctx, key, invcNo),
+		a.purchases.MarkDeclared(ctx, p.Key(), req.PchsSttsCd, invcNo),
+		a.declarePurchaseStock(ctx, stock, req),
+	)
+}
+
+// declareImportStock declares the stock movement of an import item the
+// VSCU accepted update for: an approved item comes into stock. The item
+// must have been retrieved with the import items.
+func (a *app) declareImportStock(ctx context.Context, stock *etims.StockService, logger logrus.FieldLogger, update etims.ImportItemUpdateRequest) error {
+	item, ok := a.masterData.ImportItem(update.Tin, update.BhfId, update.TaskCd, update.DclDe, update.ItemSeq)
+	if !ok {
+		if update.ImptItemSttsCd == etims.ImportItemApproved {
+			logger.WithFields(logrus.Fields{"task_cd": update.TaskCd, "item_seq": update.ItemSeq}).Warn("Approved import item was never retrieved, no stock declared")
+		}
+		return nil
 	}
+	movement, ok, err := etims.ImportStockMovement(update, item)
+	if !ok {
+		return err
+	}
+	_, err = stock.Declare(ctx, movement, fmt.Sprintf("import/%s/%s/%d", update.TaskCd, update.DclDe, update.ItemSeq))
+	return err
+}
+
+// declarePurchaseStock declares the stock movement of a purchase accepted
+// by the VSCU: a confirmed purchase brings its lines into stock.
+func (a *app) declarePurchaseStock(ctx context.Context, stock *etims.StockService, purchase etims.TrnsPurchaseSaveReq) error {
+	movement, ok := etims.PurchaseStockMovement(purchase)
+	if !ok {
+		return nil
+	}
+	_, err := stock.Declare(ctx, movement, fmt.Sprintf("pchsInvcNo/%d", purchase.InvcNo))
+	return err
+}
 
-	// Stock Movement
-	stockMovementRequest := StockMovementRequest{
-		Tin:       tin,
-		BhfId:     bhfId,
-		LastReqDt: time.Now().Format("20060102150405"), // Current timestamp
+// declareSalesStock declares the stock movement of an invoice accepted by
+// the VSCU: its lines go out of stock for a sale and come back for a credit
+// note.
+func (a *app) declareSalesStock(ctx context.Context, stock *etims.StockService, sale etims.TrnsSalesSaveWrReq) error {
+	movement, ok := etims.SalesStockMovement(sale)
+	if !ok {
+		return nil
 	}
+	_, err := stock.Declare(ctx, movement, fmt.Sprintf("invcNo/%d", sale.InvcNo))
+	return err
+}
 
-	stockMovementRequestBody, err := json.Marshal(stockMovementRequest)
+// reconcileTransfers reconciles the stock movements the branch retrieved
+// with the transfers its sibling branches declared to it, and logs those
+// that do not match.
+func (a *app) reconcileTransfers(ctx context.Context, logger logrus.FieldLogger, tin, bhfId string, moves []etims.StockMove) error {
+	rec, err := a.transferService.ReconcileTransfers(ctx, tin, bhfId, moves)
 	if err != nil {
-		logger.WithError(err).Fatal("Failed to marshal stock movement request")
+		return err
+	}
+	logger.WithFields(logrus.Fields{
+		"matched":    len(rec.Matched),
+		"mismatched": len(rec.Mismatched),
+		"unknown":    len(rec.Unknown),
+		"missing":    len(rec.Missing),
+	}).Info("Reconciled incoming stock transfers")
+	for _, m := range rec.Mismatched {
+		logger.WithFields(logrus.Fields{
+			"from_bhf_id": m.Transfer.FromBhfId,
+			"sar_no":      m.Transfer.OutSarNo,
+			"problems":    m.Problems,
+		}).Warn("Incoming stock transfer differs from what was sent")
+	}
+	for _, move := range rec.Unknown {
+		logger.WithFields(logrus.Fields{
+			"cust_bhf_id": move.CustBhfId,
+			"sar_no":      move.SarNo,
+		}).Warn("Incoming stock transfer was never declared by its sender")
 	}
+	return nil
+}
 
-	if err := makeRequest("/stock/selectStockItems", stockMovementRequestBody, "stock movement"); err != nil {
-		logger.WithError(err).Fatal("Failed to fetch stock movement")
+// receiveStock declares a stock movement an operator approved in the inbox
+// as a movement of the receiving branch, so that the remaining quantities
+// it reports follow declared movements, and posts it to the ledger. A
+// movement the transfer register accounts for, or that the branch cannot
+// declare, is rejected in the inbox instead. Goods from another taxpayer
+// come into stock with the purchase of their supplier invoice, so such a
+// movement is only matched to it.
+func (a *app) receiveStock(ctx context.Context, stock *etims.StockService, logger logrus.FieldLogger, m etims.InboxStockMove) error {
+	log := logger.WithField("stock_move", m.Key().String())
+	if t, ok := a.transfers.Covers(m.Tin, m.BhfId, m.Move); ok {
+		log.Warn("Stock movement is a stock transfer, not posted again")
+		return a.stockMoves.Reject(ctx, m.Key(), fmt.Sprintf("stock transfer %d from branch %s", t.OutSarNo, t.FromBhfId))
+	}
+	movement, err := m.Move.Movement(m.Tin, m.BhfId)
+	if errors.Is(err, etims.ErrPurchasedStock) {
+		return a.matchPurchasedStock(ctx, log, m)
 	}
+	if err != nil {
+		log.WithError(err).Warn("Stock movement cannot be received")
+		return a.stockMoves.Reject(ctx, m.Key(), err.Error())
+	}
+	movement.RegrId, movement.RegrNm = "Admin", "Admin"
+	movement.ModrId, movement.ModrNm = "Admin", "Admin"
+
+	sarNo, err := stock.Declare(ctx, movement, "received/"+m.Key().String())
+	var re *etims.ResultError
+	switch {
+	case errors.As(err, &re):
+		log.WithError(err).Warn("Received stock movement rejected by the VSCU")
+		return a.stockMoves.Reject(ctx, m.Key(), err.Error())
+	case err != nil:
+		return err
+	}
+	note := fmt.Sprintf("declared as sarNo %d", sarNo)
+	if m.Note != "" {
+		note = m.Note + "; " + note
+	}
+	if err := a.stockMoves.MarkPosted(ctx, m.Key(), note); err != nil {
+		return err
+	}
+	log.WithField("sar_no", sarNo).Info("Stock movement received")
+	return nil
+}
 
-	logger.WithFields(logrus.Fields{
-		"successful_requests": stats.successful,
-		"failed_requests":     stats.failed,
-	}).Info("Data synchronization completed")
+// matchPurchasedStock settles a stock movement from another taxpayer
+// against the supplier invoice it delivered the goods of. The goods are in
+// the ledger once the invoice is declared as a purchase, so the movement is
+// marked posted then, and rejected if the invoice was; until then it waits.
+func (a *app) matchPurchasedStock(ctx context.Context, logger logrus.FieldLogger, m etims.InboxStockMove) error {
+	p, ok := a.purchases.Covering(m.Tin, m.BhfId, m.Move)
+	if !ok {
+		logger.Warn("No supplier invoice matches the stock movement, which waits for one")
+		return nil
+	}
+	log := logger.WithField("supplier_invoice", p.Key().String())
+	switch {
+	case p.Status == etims.PurchaseDeclared && p.PchsSttsCd == etims.TransactionApproved:
+		log.Info("Stock movement came into stock with its purchase")
+		return a.stockMoves.MarkPosted(ctx, m.Key(), fmt.Sprintf("in stock with purchase %d of supplier invoice %s", p.PchsInvcNo, p.Key()))
+	case p.Status == etims.PurchaseRejected, p.Status == etims.PurchaseDeclared:
+		log.Warn("Supplier invoice of the stock movement was rejected")
+		return a.stockMoves.Reject(ctx, m.Key(), fmt.Sprintf("supplier invoice %s rejected", p.Key()))
+	}
+	log.Info("Stock movement waits for its supplier invoice to be declared")
+	return nil
+}
 
-	logger.Info("Data synchronization completed successfully")
+// newSecretSource opens the secret source selected by the configuration.
+// deviceKeyName names the device keys in the secret source, the CMC key of
+// a branch as its cmcKeySecret.
+func deviceKeyName(branches []config.Branch) func(kind, bhfId string) string {
+	return func(kind, bhfId string) string {
+		for _, b := range branches {
+			if kind == "cmc" && b.BhfId == bhfId {
+				return b.CmcKeyName()
+			}
+		}
+		return etims.DeviceKeyName(kind, bhfId)
+	}
 }
 
-func sendRequest(url string, headers map[string]string, requestBody []byte) (*http.Response, error) {
-	log := logrus.WithFields(logrus.Fields{
-		"url":     url,
-		"headers": headers,
-		"method":  "POST",
-	})
+func newSecretSource(cfg config.Secrets) (secrets.Source, error) {
+	switch cfg.Source {
+	case config.SecretsFile:
+		return secrets.FileSource{Dir: cfg.Dir}, nil
+	case config.SecretsKeystore:
+		return secrets.OpenKeystore(cfg.Keystore, os.Getenv("ETIMS_KEYSTORE_PASSPHRASE"))
+	}
+	return secrets.EnvSource{Prefix: "ETIMS_"}, nil
+}
 
-	// Generate request ID for tracing
-	requestID := fmt.Sprintf("%d", time.Now().UnixNano())
-	log = log.WithField("request_id", requestID)
+// keystoreSet implements "keystore-set PATH NAME": it reads a secret from
+// standard input and stores it as NAME in the keystore at PATH, encrypted
+// with ETIMS_KEYSTORE_PASSPHRASE.
+func keystoreSet(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: keystore-set PATH NAME < secret")
+	}
+	ks, err := secrets.OpenKeystore(args[0], os.Getenv("ETIMS_KEYSTORE_PASSPHRASE"))
+	if err != nil {
+		return err
+	}
+	value, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	return ks.Set(args[1], strings.TrimSpace(string(value)))
+}
 
-	// Create request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+// reviewPurchases lists the supplier invoices of a purchase inbox, or
+// accepts or rejects one of them for declaration on the next run.
+func reviewPurchases(w io.Writer, args []string) error {
+	const usage = "usage: purchases PATH list TIN BHFID | purchases PATH accept|reject TIN BHFID SPPLRTIN SPPLRBHFID SPPLRINVCNO [NOTE]"
+	if len(args) < 2 {
+		return errors.New(usage)
+	}
+	inbox, err := etims.NewPurchaseInbox(args[0])
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
+	ctx := context.Background()
 
-	// Set default headers
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("X-Request-ID", requestID)
-	req.Header.Set("CMC-KEY", cmcKey)
-	req.Header.Set("User-Agent", "etims-client/1.0")
+	switch cmd := args[1]; cmd {
+	case "list":
+		if len(args) != 4 {
+			return errors.New(usage)
+		}
+		for _, p := range inbox.List(args[2], args[3]) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Key(), p.Sale.SpplrNm, p.Sale.TotAmt, p.Status, p.Note)
+		}
+		return nil
+	case "accept", "reject":
+		if len(args) < 7 || len(args) > 8 {
+			return errors.New(usage)
+		}
+		invcNo, err := strconv.ParseInt(args[6], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid supplier invoice number %q", args[6])
+		}
+		key := etims.PurchaseKey{Tin: args[2], BhfId: args[3], SpplrTin: args[4], SpplrBhfId: args[5], SpplrInvcNo: invcNo}
+		note := ""
+		if len(args) == 8 {
+			note = args[7]
+		}
+		if cmd == "accept" {
+			return inbox.Accept(ctx, key, note)
+		}
+		return inbox.Reject(ctx, key, note)
+	default:
+		return errors.New(usage)
+	}
+}
 
-	// Set custom headers
-	for key, value := range headers {
-		req.Header.Set(key, value)
+// reviewStockMoves lists the movements of a stock movement inbox, or
+// approves or rejects one of them for the stock ledger on the next run. A
+// stock transfer in the transfer register next to the inbox cannot be
+// approved, as it is already accounted for.
+func reviewStockMoves(w io.Writer, args []string) error {
+	const usage = "usage: stock-moves PATH list TIN BHFID | stock-moves PATH approve|reject TIN BHFID CUSTTIN CUSTBHFID SARNO [NOTE]"
+	if len(args) < 2 {
+		return errors.New(usage)
+	}
+	inbox, err := etims.NewStockMoveInbox(args[0])
+	if err != nil {
+		return err
 	}
+	ctx := context.Background()
 
-	// Log request details
-	log.WithFields(logrus.Fields{
-		"body_size":     len(requestBody),
-		"body":          string(requestBody),
-		"request_headers": req.Header,
-	}).Info("Sending request")
-
-	// Record start time for request duration
-	start := time.Now()
-
-	// Send request with longer timeout
-	client := &http.Client{
-		Timeout: time.Second * 360,
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-			IdleConnTimeout:     90 * time.Second,
-			TLSHandshakeTimeout: 10 * time.Second,
-		},
+	switch cmd := args[1]; cmd {
+	case "list":
+		if len(args) != 4 {
+			return errors.New(usage)
+		}
+		for _, m := range inbox.List(args[2], args[3]) {
+			fmt.Fprintf(w, "%s\t%s\t%d items\t%s\t%s\t%s\n", m.Key(), m.Move.OcrnDt, m.Move.TotItemCnt, m.Move.TotAmt, m.Status, m.Note)
+		}
+		return nil
+	case "approve", "reject":
+		if len(args) < 7 || len(args) > 8 {
+			return errors.New(usage)
+		}
+		sarNo, err := strconv.ParseInt(args[6], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid sarNo %q", args[6])
+		}
+		key := etims.StockMoveKey{Tin: args[2], BhfId: args[3], CustTin: args[4], CustBhfId: args[5], SarNo: sarNo}
+		note := ""
+		if len(args) == 8 {
+			note = args[7]
+		}
+		if cmd == "reject" {
+			return inbox.Reject(ctx, key, note)
+		}
+		m, ok := inbox.StockMove(key)
+		if !ok {
+			return fmt.Errorf("%w: %s", etims.ErrUnknownStockMove, key)
+		}
+		transfers, err := etims.NewTransferRegister(filepath.Join(filepath.Dir(args[0]), "transfers.json"))
+		if err != nil {
+			return err
+		}
+		if t, ok := transfers.Covers(key.Tin, key.BhfId, m.Move); ok {
+			return fmt.Errorf("stock movement %s is stock transfer %d from branch %s, which is already accounted for", key, t.OutSarNo, t.FromBhfId)
+		}
+		if _, err := m.Move.Movement(key.Tin, key.BhfId); err != nil && !errors.Is(err, etims.ErrPurchasedStock) {
+			return err
+		}
+		return inbox.Approve(ctx, key, note)
+	default:
+		return errors.New(usage)
+	}
+}
+
+// reviewOutbox lists the declarations the VSCU rejected from the outbox in
+// data directory DIR, or resubmits or discards one of them. Discarding
+// voids the number the declaration carried, and reopens a purchase for
+// review.
+func reviewOutbox(w io.Writer, args []string) error {
+	const usage = "usage: outbox DIR list | outbox DIR resubmit SEQ | outbox DIR discard SEQ [REASON]"
+	if len(args) < 2 {
+		return errors.New(usage)
+	}
+	outbox, err := etims.OpenOutbox(filepath.Join(args[0], "outbox.log"))
+	if err != nil {
+		return err
+	}
+	defer outbox.Close()
+	ctx := context.Background()
+
+	switch cmd := args[1]; cmd {
+	case "list":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		for _, r := range outbox.Rejected() {
+			fmt.Fprintf(w, "%d\t%s/%s\t%s\t%s\t%s\n", r.Seq, r.Tin, r.BhfId, r.Path, r.ResultCd, r.ResultMsg)
+		}
+		return nil
+	case "resubmit", "discard":
+		if len(args) < 3 || len(args) > 4 || (cmd == "resubmit" && len(args) != 3) {
+			return errors.New(usage)
+		}
+		seq, err := strconv.ParseUint(args[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid outbox sequence number %q", args[2])
+		}
+		if cmd == "resubmit" {
+			return outbox.Resubmit(ctx, seq)
+		}
+		reason := "discarded from the outbox"
+		if len(args) == 4 {
+			reason = args[3]
+		}
+		return discardQueued(ctx, args[0], outbox, seq, reason)
+	default:
+		return errors.New(usage)
 	}
-	resp, err := client.Do(req)
+}
+
+// discardQueued discards rejected outbox entry seq, voids the number it
+// carried and undoes what was waiting for it: a held credit note is
+// released and a purchase reopened.
+func discardQueued(ctx context.Context, dir string, outbox *etims.Outbox, seq uint64, reason string) error {
+	sequences, err := etims.OpenSequencer(filepath.Join(dir, "sequences.log"))
 	if err != nil {
-		log.WithError(err).Error("Request failed")
-		return nil, fmt.Errorf("request failed: %w", err)
+		return err
 	}
+	defer sequences.Close()
 
-	// Calculate request duration
-	duration := time.Since(start)
+	r, err := outbox.Discard(ctx, seq)
+	if err != nil {
+		return err
+	}
+	key := etims.SequenceKey{Tin: r.Tin, BhfId: r.BhfId}
+	var no int64
+	var release func() error
+	switch r.Path {
+	case etims.PathSaveSales:
+		var sale etims.TrnsSalesSaveWrReq
+		if err := json.Unmarshal(r.Payload, &sale); err != nil {
+			return fmt.Errorf("failed to decode discarded sale: %w", err)
+		}
+		key.Kind, no = etims.SequenceInvoice, sale.InvcNo
+		if sale.RcptTyCd == etims.ReceiptTypeCreditNote {
+			release = func() error {
+				history, err := etims.NewSalesHistory(filepath.Join(dir, "sales.json"))
+				if err != nil {
+					return err
+				}
+				return history.Release(ctx, sale.Tin, sale.BhfId, sale.InvcNo)
+			}
+		}
+	case etims.PathSavePurchases:
+		var purchase etims.TrnsPurchaseSaveReq
+		if err := json.Unmarshal(r.Payload, &purchase); err != nil {
+			return fmt.Errorf("failed to decode discarded purchase: %w", err)
+		}
+		key.Kind, no = etims.SequencePurchase, purchase.InvcNo
+		release = func() error {
+			inbox, err := etims.NewPurchaseInbox(filepath.Join(dir, "purchases.json"))
+			if err != nil {
+				return err
+			}
+			return inbox.Reopen(ctx, etims.PurchaseKey{Tin: purchase.Tin, BhfId: purchase.BhfId, SpplrTin: purchase.SpplrTin, SpplrBhfId: purchase.SpplrBhfId, SpplrInvcNo: purchase.SpplrInvcNo}, reason)
+		}
+	case etims.PathSaveStockItems:
+		var movement etims.StockIOSaveReq
+		if err := json.Unmarshal(r.Payload, &movement); err != nil {
+			return fmt.Errorf("failed to decode discarded stock movement: %w", err)
+		}
+		key.Kind, no = etims.SequenceStock, movement.SarNo
+	default:
+		return nil
+	}
+	if err := sequences.Void(ctx, key, no, reason); err != nil {
+		return err
+	}
+	if release != nil {
+		return release()
+	}
+	return nil
+}
 
-	// Log response details
-	log.WithFields(logrus.Fields{
-		"status_code":       resp.StatusCode,
-		"duration_ms":       duration.Milliseconds(),
-		"content_length":    resp.ContentLength,
-		"response_headers":  resp.Header,
-		"content_type":      resp.Header.Get("Content-Type"),
-	}).Info("Received response")
-
-	return resp, nil
+// result drops the data payload of a typed response so makeRequest can log
+// its envelope.
+func result[T any](res *etims.Response[T], err error) (*etims.Result, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &res.Result, nil
 }
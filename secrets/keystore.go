@@ -0,0 +1,176 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt parameters recommended for interactive use.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	keystoreSalt = 16
+)
+
+// keystoreFile is the on-disk form of a Keystore. Ciphertext is the
+// AES-256-GCM encryption of the JSON-encoded secrets, under a key derived
+// from the passphrase and Salt with scrypt.
+type keystoreFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Keystore is a Source backed by a passphrase-encrypted local file.
+type Keystore struct {
+	path string
+	salt []byte
+	aead cipher.AEAD
+
+	mu      sync.RWMutex
+	secrets map[string]string
+}
+
+// OpenKeystore decrypts the keystore at path with passphrase. A missing
+// file is treated as an empty keystore that is created on first Set.
+func OpenKeystore(path, passphrase string) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, errors.New("secrets: keystore passphrase is required")
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		salt := make([]byte, keystoreSalt)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("secrets: %w", err)
+		}
+		return newKeystore(path, passphrase, salt, make(map[string]string))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secrets: failed to read keystore: %w", err)
+	}
+
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("secrets: failed to decode keystore %s: %w", path, err)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("secrets: unsupported keystore version %d", file.Version)
+	}
+
+	ks, err := newKeystore(path, passphrase, file.Salt, nil)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := ks.aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("secrets: wrong keystore passphrase or corrupted keystore")
+	}
+	if err := json.Unmarshal(plaintext, &ks.secrets); err != nil {
+		return nil, fmt.Errorf("secrets: failed to decode keystore contents: %w", err)
+	}
+	return ks, nil
+}
+
+func newKeystore(path, passphrase string, salt []byte, secrets map[string]string) (*Keystore, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %w", err)
+	}
+	return &Keystore{path: path, salt: salt, aead: aead, secrets: secrets}, nil
+}
+
+func (k *Keystore) Secret(ctx context.Context, name string) (string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	v, ok := k.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: keystore entry %s", ErrNotFound, name)
+	}
+	return v, nil
+}
+
+// Set stores value under name and rewrites the keystore.
+func (k *Keystore) Set(name, value string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	previous, existed := k.secrets[name]
+	k.secrets[name] = value
+	if err := k.write(); err != nil {
+		if existed {
+			k.secrets[name] = previous
+		} else {
+			delete(k.secrets, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// write encrypts the secrets under a fresh nonce and replaces the file
+// atomically. k.mu must be held.
+func (k *Keystore) write() error {
+	plaintext, err := json.Marshal(k.secrets)
+	if err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+	data, err := json.MarshalIndent(keystoreFile{
+		Version:    1,
+		Salt:       k.salt,
+		Nonce:      nonce,
+		Ciphertext: k.aead.Seal(nil, nonce, plaintext, nil),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0o700); err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), filepath.Base(k.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("secrets: failed to write keystore: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("secrets: failed to write keystore: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("secrets: failed to write keystore: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		return fmt.Errorf("secrets: failed to write keystore: %w", err)
+	}
+	return nil
+}
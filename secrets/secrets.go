@@ -0,0 +1,62 @@
+// Package secrets loads credentials such as the VSCU CMC key from outside
+// the program: the environment, files, or an encrypted local keystore.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when a source has no secret of the given name.
+var ErrNotFound = errors.New("secrets: not found")
+
+// Source looks up secrets by name, e.g. "cmc-key-00".
+type Source interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// EnvSource reads secrets from environment variables. The variable for a
+// name is Prefix followed by the name upper-cased with "-" and "." turned
+// into "_", so "cmc-key-00" is ETIMS_CMC_KEY_00 with the prefix "ETIMS_".
+type EnvSource struct {
+	Prefix string
+}
+
+func (s EnvSource) Secret(ctx context.Context, name string) (string, error) {
+	key := s.Prefix + strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(name))
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return "", fmt.Errorf("%w: environment variable %s", ErrNotFound, key)
+	}
+	return v, nil
+}
+
+// FileSource reads each secret from the file of the same name in Dir, as
+// mounted by Docker or Kubernetes secrets. Surrounding whitespace is
+// trimmed.
+type FileSource struct {
+	Dir string
+}
+
+func (s FileSource) Secret(ctx context.Context, name string) (string, error) {
+	if name != filepath.Base(name) {
+		return "", fmt.Errorf("secrets: invalid secret name %q", name)
+	}
+	path := filepath.Join(s.Dir, name)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: file %s", ErrNotFound, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("secrets: %w", err)
+	}
+	v := strings.TrimSpace(string(data))
+	if v == "" {
+		return "", fmt.Errorf("%w: file %s is empty", ErrNotFound, path)
+	}
+	return v, nil
+}